@@ -17,14 +17,19 @@ limitations under the License.
 package v1alpha1
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // NSOSpec defines the desired state of NSO.
+// +kubebuilder:validation:XValidation:rule="self.deletionPolicy != 'BackupThenDelete' || has(self.backup)",message="backup is required when deletionPolicy is BackupThenDelete"
+// +kubebuilder:validation:XValidation:rule="!has(self.upgrade) || has(self.backup)",message="backup is required when upgrade is set"
+// +kubebuilder:validation:XValidation:rule="!has(self.terminationGracePeriodSeconds) || !has(self.commitQueueDrainTimeout) || duration(self.commitQueueDrainTimeout) < duration(string(self.terminationGracePeriodSeconds) + 's')",message="commitQueueDrainTimeout must be shorter than terminationGracePeriodSeconds"
 type NSOSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -61,6 +66,29 @@ type NSOSpec struct {
 	// NSO environment variables.
 	Env []corev1.EnvVar `json:"env"`
 
+	// +kubebuilder:validation:Optional
+	// Pins the NSO pods to the digest the image resolves to, so that a
+	// retagged image does not change what runs after a pod restart. The
+	// digest is resolved again when the image changes or on demand with the
+	// ResolveImageAnnotation.
+	PinImageDigest bool `json:"pinImageDigest,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// ConfigMaps and Secrets whose keys are exposed as NSO environment
+	// variables.
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Secrets holding the credentials of the registries the NSO images are
+	// pulled from.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// When the NSO image is pulled. Defaults to Always for the latest tag and
+	// to IfNotPresent otherwise.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// NSO volume mounts.
 	VolumeMounts []corev1.VolumeMount `json:"volumeMounts"`
@@ -68,6 +96,204 @@ type NSOSpec struct {
 	// +kubebuilder:validation:Optional
 	// NSO volumes.
 	Volumes []corev1.Volume `json:"volumes"`
+
+	// +kubebuilder:validation:Optional
+	// Containers run in order before NSO starts, e.g. to seed CDB init files.
+	// They can mount the NSO volumes.
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Containers run next to NSO for the lifetime of the pod, e.g. log
+	// shippers. They are started before NSO as native sidecars where the
+	// cluster supports them. They can mount the NSO volumes.
+	Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="volumeClaimTemplates is immutable"
+	// Persistent volume claims created for every NSO replica, e.g. to keep the
+	// CDB across restarts. Mount them with volumeMounts. They can not be
+	// changed once set, as the StatefulSet does not allow it.
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Extra labels and annotations for the NSO pods. They do not change the
+	// StatefulSet selector.
+	PodMetadata *EmbeddedMetadata `json:"podMetadata,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Extra labels and annotations for the NSO Service.
+	ServiceMetadata *EmbeddedMetadata `json:"serviceMetadata,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Extra labels and annotations for the persistent volume claims of the
+	// replicas.
+	VolumeClaimMetadata *EmbeddedMetadata `json:"volumeClaimMetadata,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// Pod template strategic-merge-patched over the one generated for the NSO,
+	// for the pod settings the NSO spec does not model. The selector,
+	// instance and managed-by labels and the ncs container can not be changed,
+	// nor the ncs image when its digest is pinned.
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Retain
+	// What happens to the NSO data when the NSO is deleted. The data is kept
+	// unless Delete or BackupThenDelete is set.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Rejects the deletion of the NSO while set. It must be turned off in a
+	// separate update before the NSO can be deleted.
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Location the NSO backups are written to.
+	Backup *BackupLocation `json:"backup,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Never
+	// How an existing StatefulSet or Service with the name of the NSO objects,
+	// not created by the operator, is handled.
+	AdoptionPolicy AdoptionPolicy `json:"adoptionPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Orchestrates the changes of the NSO version: every replica is backed up,
+	// upgraded and checked in turn, and the upgrade is rolled back when one
+	// fails. Without it, a new image is rolled out like any other change.
+	Upgrade *UpgradeSpec `json:"upgrade,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:XValidation:rule="!has(self.rollingUpdate) || !has(self.type) || self.type == 'RollingUpdate'",message="rollingUpdate requires the RollingUpdate type"
+	// How the NSO pods are replaced when their template changes. A
+	// RollingUpdate partition stages the rollout on the replicas from the
+	// partition ordinal up, see the PromoteAnnotation. OnDelete leaves the
+	// replacement to manual pod deletions. Orchestrated upgrades manage the
+	// partition themselves.
+	UpdateStrategy *appsv1.StatefulSetUpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=OrderedReady;Parallel
+	// +kubebuilder:default=OrderedReady
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="podManagementPolicy is immutable"
+	// Whether the NSO pods are created and deleted one at a time, waiting for
+	// each to be ready, or all at once.
+	PodManagementPolicy appsv1.PodManagementPolicyType `json:"podManagementPolicy,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Restarts the NSO pods one at a time when set to a new time, e.g. the
+	// current one. Each pod must run NSO with all its packages up before the
+	// next one is restarted.
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=120
+	// Seconds the NSO pods are given to shut down, the commit queue drain
+	// included, before they are killed.
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="90s"
+	// Time the NSO pods wait on shutdown for the commit queue items to be
+	// pushed to the devices. New northbound write transactions are rejected
+	// meanwhile, then NSO is stopped.
+	CommitQueueDrainTimeout metav1.Duration `json:"commitQueueDrainTimeout,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// How the replicas are polled through the RESTCONF API for their NSO
+	// version and packages. They are polled over HTTP every minute by
+	// default.
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+}
+
+// MonitoringSpec configures the polling of the NSO replicas through their
+// RESTCONF API.
+type MonitoringSpec struct {
+	// +kubebuilder:validation:Optional
+	// Stops the polling, e.g. when the RESTCONF API is not enabled in the NSO
+	// configuration.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="1m"
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('10s')",message="pollInterval must be at least 10s"
+	// Time between two polls of the replicas.
+	PollInterval metav1.Duration `json:"pollInterval,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=http;https
+	// +kubebuilder:default=http
+	// Scheme of the RESTCONF API, served on the http port 8080 or the https
+	// port 8888 of the NSO container.
+	Scheme string `json:"scheme,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Name of a Secret whose ca.crt key verifies the certificate of the NSO
+	// replicas over https. The system roots are used when empty.
+	CASecretRef string `json:"caSecretRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Skips the verification of the certificate of the NSO replicas over
+	// https.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// UpgradeSpec configures the orchestrated upgrades of the NSO version.
+type UpgradeSpec struct {
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="10m"
+	// Time each replica has to be backed up, run the new version and report
+	// all its packages up before the upgrade is rolled back.
+	ReplicaTimeout metav1.Duration `json:"replicaTimeout,omitempty"`
+}
+
+// AdoptionPolicy defines how existing objects not created by the operator are handled.
+// +kubebuilder:validation:Enum=Never;DryRun;Converge
+type AdoptionPolicy string
+
+const (
+	// Existing objects are left untouched and reported as a conflict.
+	AdoptionPolicyNever AdoptionPolicy = "Never"
+	// Compatible objects are adopted and the changes the operator would make
+	// to them are reported in the status without being applied.
+	AdoptionPolicyDryRun AdoptionPolicy = "DryRun"
+	// Compatible objects are adopted and converged to the NSO spec.
+	AdoptionPolicyConverge AdoptionPolicy = "Converge"
+)
+
+// EmbeddedMetadata holds the labels and annotations added to an object created for the NSO.
+type EmbeddedMetadata struct {
+	// +kubebuilder:validation:Optional
+	// Labels to add to the object.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Annotations to add to the object.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// DeletionPolicy defines what happens to the NSO data when the NSO is deleted.
+// +kubebuilder:validation:Enum=Delete;Retain;BackupThenDelete
+type DeletionPolicy string
+
+const (
+	// The persistent volume claims of the NSO are deleted with it.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// The persistent volume claims of the NSO are kept after it is deleted.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// An NSO backup is taken before the NSO and its claims are deleted.
+	DeletionPolicyBackupThenDelete DeletionPolicy = "BackupThenDelete"
+)
+
+// BackupLocation for NSO backups.
+type BackupLocation struct {
+	// +kubebuilder:validation:Required
+	// Name of an existing persistent volume claim mounted as the NSO backup
+	// directory. Use a ReadWriteMany claim when running several replicas.
+	ClaimName string `json:"claimName"`
 }
 
 // Credentials for admin user.
@@ -85,8 +311,243 @@ type Credentials struct {
 type NSOStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=type
+	// Latest available observations of the NSO state.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Changes the operator would make to the adopted objects, reported while
+	// the adoption policy is DryRun.
+	AdoptionDiff []string `json:"adoptionDiff,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Objects the operator would delete as they are no longer part of the
+	// NSO, reported while the prune dry-run annotation is set.
+	StaleObjects []string `json:"staleObjects,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Digest the NSO pods are pinned to while pinImageDigest is set.
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Image the imageDigest was resolved from.
+	PinnedImage string `json:"pinnedImage,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Progress of the ongoing or last rolled back upgrade of the NSO version.
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Progress of the rolling restart requested by restartedAt.
+	Restart *RestartStatus `json:"restart,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// NSO version and packages of each replica, as last polled through the
+	// RESTCONF API.
+	ReplicaStatuses []ReplicaStatus `json:"replicaStatuses,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Time the replicas were last polled.
+	LastPollTime *metav1.Time `json:"lastPollTime,omitempty"`
+}
+
+// ReplicaStatus is the state of an NSO replica as reported by NSO.
+type ReplicaStatus struct {
+	// Name of the pod of the replica.
+	Pod string `json:"pod"`
+
+	// +kubebuilder:validation:Optional
+	// NSO version the replica runs, e.g. 6.3.1.
+	Version string `json:"version,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Packages loaded by the replica.
+	Packages []PackageStatus `json:"packages,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Why the replica could not be polled.
+	Error string `json:"error,omitempty"`
+}
+
+// PackageStatus is an NSO package and the outcome of its loading.
+type PackageStatus struct {
+	// Name of the package.
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Optional
+	// Version of the package.
+	Version string `json:"version,omitempty"`
+
+	// up, or the case of the failure, e.g. java-uninitialized.
+	OperStatus string `json:"operStatus"`
+
+	// +kubebuilder:validation:Optional
+	// Why the package failed to load.
+	ErrorInfo string `json:"errorInfo,omitempty"`
+}
+
+// UpgradePhase is the step an upgrade of the NSO version is at.
+// +kubebuilder:validation:Enum=BackingUp;RollingOut;Verifying;RollingBack;RolledBack
+type UpgradePhase string
+
+const (
+	// The replica being upgraded is backed up.
+	UpgradePhaseBackingUp UpgradePhase = "BackingUp"
+	// The replica is restarted with the new image.
+	UpgradePhaseRollingOut UpgradePhase = "RollingOut"
+	// The packages of the upgraded replica are checked.
+	UpgradePhaseVerifying UpgradePhase = "Verifying"
+	// The replicas are restarted with the previous image and their backup
+	// restored.
+	UpgradePhaseRollingBack UpgradePhase = "RollingBack"
+	// The replicas run the previous image again. The upgrade is not tried
+	// again until the image changes.
+	UpgradePhaseRolledBack UpgradePhase = "RolledBack"
+)
+
+// UpgradeStatus is the progress of an upgrade of the NSO version.
+type UpgradeStatus struct {
+	// Step the upgrade is at.
+	Phase UpgradePhase `json:"phase"`
+
+	// Image the replicas ran before the upgrade.
+	FromImage string `json:"fromImage"`
+
+	// Image the replicas are upgraded to.
+	ToImage string `json:"toImage"`
+
+	// Ordinal of the replica being upgraded. Replicas are upgraded from the
+	// highest ordinal down.
+	Replica int32 `json:"replica"`
+
+	// Time the upgrade of the replica started.
+	ReplicaStartTime metav1.Time `json:"replicaStartTime"`
+
+	// +kubebuilder:validation:Optional
+	// Backups taken of the replicas before upgrading them.
+	Backups []ReplicaBackup `json:"backups,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Why the upgrade is rolled back.
+	FailureMessage string `json:"failureMessage,omitempty"`
 }
 
+// ReplicaBackup is a backup taken of an NSO replica.
+type ReplicaBackup struct {
+	// Name of the pod the backup was taken of.
+	Pod string `json:"pod"`
+
+	// Path of the backup file in the NSO container.
+	File string `json:"file"`
+}
+
+// RestartStatus is the progress of a rolling restart of the NSO pods.
+type RestartStatus struct {
+	// Restart time of the spec being rolled out.
+	RestartedAt metav1.Time `json:"restartedAt"`
+
+	// Ordinal of the replica being restarted. Replicas are restarted from the
+	// highest ordinal down.
+	Replica int32 `json:"replica"`
+
+	// Time the restart of the replica started.
+	ReplicaStartTime metav1.Time `json:"replicaStartTime"`
+}
+
+// Annotations understood by the operator on NSO resources.
+const (
+	// Set to "true" to stop the operator from changing any object of the NSO,
+	// e.g. while the StatefulSet is edited by hand during maintenance.
+	PausedAnnotation = "nso.orchestration.cisco.com/paused"
+	// Set to "true" to only report, through Events, the owned objects the
+	// operator would delete because they are no longer part of the NSO.
+	PruneDryRunAnnotation = "nso.orchestration.cisco.com/prune-dry-run"
+	// Set to any value to resolve the image digest again while
+	// pinImageDigest is set. The operator removes it once resolved.
+	ResolveImageAnnotation = "nso.orchestration.cisco.com/resolve-image"
+	// Set to the ordinal to move the updateStrategy partition down to once
+	// the replicas from the current partition up run the new template and are
+	// ready. The operator removes it once the partition is moved.
+	PromoteAnnotation = "nso.orchestration.cisco.com/promote"
+)
+
+// Condition types reported in the NSO status.
+const (
+	// All the ConfigMaps and Secrets referenced by the NSO exist.
+	ConditionDependenciesResolved = "DependenciesResolved"
+	// Reconciliation of the NSO is paused by the PausedAnnotation.
+	ConditionPaused = "Paused"
+	// The NSO is being deleted according to its deletion policy.
+	ConditionDeleting = "Deleting"
+	// Existing objects not created by the operator have been adopted.
+	ConditionAdopted = "Adopted"
+	// The podTemplate override has been applied to the NSO pods.
+	ConditionPodTemplateApplied = "PodTemplateApplied"
+	// The images of the NSO pods have been pulled.
+	ConditionImagesPulled = "ImagesPulled"
+	// The NSO image has been resolved to the digest the pods are pinned to.
+	ConditionImagePinned = "ImagePinned"
+	// The images of the NSO pods comply with the image policy of the operator.
+	ConditionImageAllowed = "ImageAllowed"
+	// A new NSO version is being rolled out, the reason is the upgrade phase.
+	ConditionUpgrading = "Upgrading"
+	// The NSO pods are being restarted one at a time.
+	ConditionRestarting = "Restarting"
+	// Every package of every replica is up, as last polled through the
+	// RESTCONF API.
+	ConditionPackagesHealthy = "PackagesHealthy"
+)
+
+// Condition reasons reported in the NSO status.
+const (
+	ReasonDependenciesFound   = "DependenciesFound"
+	ReasonDependenciesMissing = "DependenciesMissing"
+
+	ReasonReconciliationPaused  = "ReconciliationPaused"
+	ReasonReconciliationResumed = "ReconciliationResumed"
+
+	ReasonDeletionProtected = "DeletionProtected"
+	ReasonBackupInProgress  = "BackupInProgress"
+	ReasonBackupFailed      = "BackupFailed"
+	ReasonBackupNotPossible = "BackupNotPossible"
+	ReasonBackupCompleted   = "BackupCompleted"
+	ReasonReleasing         = "Releasing"
+
+	ReasonAdoptionDisabled = "AdoptionDisabled"
+	ReasonIncompatible     = "Incompatible"
+	ReasonChangesPending   = "ChangesPending"
+	ReasonConverged        = "Converged"
+
+	ReasonOverrideApplied    = "OverrideApplied"
+	ReasonInvalidPodTemplate = "InvalidPodTemplate"
+
+	ReasonPulled           = "Pulled"
+	ReasonImagePullBackOff = "ImagePullBackOff"
+
+	ReasonDigestResolved   = "DigestResolved"
+	ReasonResolutionFailed = "ResolutionFailed"
+
+	ReasonPolicySatisfied = "PolicySatisfied"
+	ReasonPolicyViolation = "PolicyViolation"
+
+	ReasonBackingUp        = "BackingUp"
+	ReasonRollingOut       = "RollingOut"
+	ReasonVerifying        = "Verifying"
+	ReasonRollingBack      = "RollingBack"
+	ReasonRolledBack       = "RolledBack"
+	ReasonUpgradeCompleted = "UpgradeCompleted"
+
+	ReasonRestartingReplica = "RestartingReplica"
+	ReasonRestartCompleted  = "RestartCompleted"
+
+	ReasonPackagesUp    = "PackagesUp"
+	ReasonPackagesNotUp = "PackagesNotUp"
+	ReasonPollFailed    = "PollFailed"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -0,0 +1,237 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PackageBundleSpec defines the desired state of PackageBundle.
+// +kubebuilder:validation:XValidation:rule="self.origin == 'SCM' || !has(self.source.branch)",message="source.branch is only supported with the SCM origin"
+// +kubebuilder:validation:XValidation:rule="self.origin == 'URL' || !has(self.source.checksum)",message="source.checksum is only supported with the URL origin"
+// +kubebuilder:validation:XValidation:rule="self.origin == 'SCM' || !has(self.credentials) || !has(self.credentials.sshKeySecretRef)",message="credentials.sshKeySecretRef is only supported with the SCM origin"
+// +kubebuilder:validation:XValidation:rule="self.origin != 'OCI' || !has(self.credentials) || !has(self.credentials.httpAuthSecretRef)",message="credentials.httpAuthSecretRef is not supported with the OCI origin"
+// +kubebuilder:validation:XValidation:rule="self.origin == 'OCI' || !has(self.credentials) || !has(self.credentials.dockerConfigSecretRef)",message="credentials.dockerConfigSecretRef is only supported with the OCI origin"
+type PackageBundleSpec struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// Name of the NSO, in the namespace of the PackageBundle, the packages are
+	// loaded into.
+	TargetName string `json:"targetName"`
+
+	// +kubebuilder:validation:Required
+	// Kind of source the packages are downloaded from.
+	Origin OriginType `json:"origin"`
+
+	// +kubebuilder:validation:Required
+	// Location of the packages.
+	Source PackageSource `json:"source"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default="5Gi"
+	// Size of the persistent volume claim the packages are downloaded to.
+	StorageSize resource.Quantity `json:"storageSize,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Storage class of the persistent volume claim. The default class of the
+	// cluster is used when empty.
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default={ReadWriteOnce}
+	// Access modes of the persistent volume claim. The Jobs of the bundle and
+	// every NSO pod mount the claim, so with ReadWriteOnce they all have to
+	// run on the node the volume is attached to. Use ReadWriteMany when the
+	// NSO pods run on several nodes.
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Accepts self-signed certificates when downloading the packages.
+	InsecureTLS bool `json:"insecureTLS,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Credentials of the source.
+	Credentials *AccessCredentials `json:"credentials,omitempty"`
+}
+
+// OriginType is the kind of source the packages of a bundle come from.
+// +kubebuilder:validation:Enum=SCM;URL;OCI
+type OriginType string
+
+const (
+	// The packages are checked out of a Git repository.
+	OriginSCM OriginType = "SCM"
+	// The packages are unpacked from a gzip compressed tar archive downloaded
+	// over HTTP(S).
+	OriginURL OriginType = "URL"
+	// The packages are extracted from the layers of an OCI artifact pulled
+	// from a container registry.
+	OriginOCI OriginType = "OCI"
+)
+
+// PackageSource is the location of the packages of a bundle.
+type PackageSource struct {
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	// URL of the Git repository, over https or ssh, of the .tar.gz archive,
+	// over http or https, or reference of the OCI artifact, by tag or digest.
+	URL string `json:"url"`
+
+	// +kubebuilder:validation:Optional
+	// Git branch, tag or commit hash the packages are checked out at. The
+	// default branch of the repository when empty.
+	Branch string `json:"branch,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Directory of the source holding the packages, one per subdirectory or
+	// package tarball, or a single package. The root of the source when empty.
+	Path string `json:"path,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	// sha256 digest the archive must match, as sha256:<hex>. Nothing is
+	// unpacked from an archive that does not match.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// AccessCredentials are the Secrets holding the credentials of a source.
+// +kubebuilder:validation:XValidation:rule="[has(self.sshKeySecretRef), has(self.httpAuthSecretRef), has(self.dockerConfigSecretRef)].filter(x, x).size() <= 1",message="sshKeySecretRef, httpAuthSecretRef and dockerConfigSecretRef are mutually exclusive"
+type AccessCredentials struct {
+	// +kubebuilder:validation:Optional
+	// Name of a Secret holding the ssh-privatekey the Git repository is
+	// cloned with over ssh, and the known_hosts its host key is verified with.
+	SSHKeySecretRef string `json:"sshKeySecretRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Name of a Secret holding the username and password the source is
+	// accessed with over https. The archives of the URL origin may also be
+	// downloaded with the bearer token of its token key.
+	HTTPAuthSecretRef string `json:"httpAuthSecretRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Name of a kubernetes.io/dockerconfigjson Secret holding the credentials
+	// of the registry the OCI artifact is pulled from.
+	DockerConfigSecretRef string `json:"dockerConfigSecretRef,omitempty"`
+}
+
+// PackageBundlePhase is the step the download of the packages is at.
+// +kubebuilder:validation:Enum=Pending;ContainerCreating;Downloading;Downloaded;FailedToDownload
+type PackageBundlePhase string
+
+const (
+	// The download Job is being created.
+	PackageBundlePhasePending PackageBundlePhase = "Pending"
+	// The pod of the download Job is starting.
+	PackageBundlePhaseContainerCreating PackageBundlePhase = "ContainerCreating"
+	// The packages are being downloaded.
+	PackageBundlePhaseDownloading PackageBundlePhase = "Downloading"
+	// The packages are downloaded and mounted into the target NSO.
+	PackageBundlePhaseDownloaded PackageBundlePhase = "Downloaded"
+	// The download Job failed. It is not retried until the spec changes.
+	PackageBundlePhaseFailedToDownload PackageBundlePhase = "FailedToDownload"
+)
+
+// PackageBundleStatus defines the observed state of PackageBundle.
+type PackageBundleStatus struct {
+	// +kubebuilder:validation:Optional
+	// Step the download of the packages is at.
+	Phase PackageBundlePhase `json:"phase,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Details of the phase.
+	Message string `json:"message,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Name of the Job downloading the packages of the current spec.
+	JobName string `json:"jobName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Time the phase last changed.
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Git commit of the downloaded packages.
+	Revision string `json:"revision,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// sha256 digest of the archive of the downloaded packages, or of the
+	// manifest the tag of the OCI artifact resolved to.
+	Digest string `json:"digest,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Names of the downloaded packages, as mounted into the NSO packages
+	// directory.
+	Packages []string `json:"packages,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Directory of the persistent volume claim holding the downloaded
+	// packages. Every download goes to a new directory, so that the NSO pods
+	// keep their packages until they are restarted.
+	StoragePath string `json:"storagePath,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +listType=map
+	// +listMapKey=type
+	// Latest available observations of the PackageBundle state.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Condition types reported in the PackageBundle status.
+const (
+	// The packages of the current spec are downloaded.
+	ConditionDownloaded = "Downloaded"
+)
+
+// Condition reasons reported in the PackageBundle status.
+const (
+	ReasonPackagesDownloaded = "PackagesDownloaded"
+	ReasonDownloadInProgress = "DownloadInProgress"
+	ReasonDownloadFailed     = "DownloadFailed"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=pb
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.targetName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Revision",type=string,JSONPath=`.status.revision`
+// +kubebuilder:printcolumn:name="Digest",type=string,JSONPath=`.status.digest`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PackageBundle is the Schema for the packagebundles API.
+type PackageBundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PackageBundleSpec   `json:"spec,omitempty"`
+	Status PackageBundleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PackageBundleList contains a list of PackageBundle.
+type PackageBundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PackageBundle `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PackageBundle{}, &PackageBundleList{})
+}
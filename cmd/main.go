@@ -21,16 +21,20 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -39,6 +43,9 @@ import (
 
 	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
 	"github.com/carlosgrillet/nso-operator/internal/controller"
+	"github.com/carlosgrillet/nso-operator/internal/imagepolicy"
+	"github.com/carlosgrillet/nso-operator/internal/packages"
+	webhookv1alpha1 "github.com/carlosgrillet/nso-operator/internal/webhook/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -56,6 +63,14 @@ func init() {
 
 // nolint:gocyclo
 func main() {
+	// The download and prune Jobs of the PackageBundles run the manager binary
+	if len(os.Args) > 1 && os.Args[1] == packages.FetchCommand {
+		os.Exit(packages.Main(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == packages.PruneCommand {
+		os.Exit(packages.PruneMain(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
@@ -63,6 +78,11 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var watchNamespaces string
+	var maxConcurrentReconciles int
+	var imagePolicyFile string
+	var packageFetcherImage string
+	var requirePackageChecksums bool
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -81,6 +101,19 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", os.Getenv("WATCH_NAMESPACES"),
+		"Comma separated list of namespaces the operator watches. Defaults to the WATCH_NAMESPACES "+
+			"environment variable, or to all namespaces when neither is set.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Maximum number of NSO instances reconciled in parallel.")
+	flag.StringVar(&imagePolicyFile, "image-policy-file", "",
+		"Path of the YAML file listing the registries the NSO images must come from and the keys "+
+			"their signature is verified with. Every image is allowed when not set.")
+	flag.StringVar(&packageFetcherImage, "package-fetcher-image", os.Getenv("PACKAGE_FETCHER_IMAGE"),
+		"Image of the Jobs downloading the packages of the PackageBundles, usually the image of the "+
+			"operator. Defaults to the PACKAGE_FETCHER_IMAGE environment variable.")
+	flag.BoolVar(&requirePackageChecksums, "require-package-checksums", false,
+		"If set, the archives of the PackageBundles of the URL origin are only downloaded with a checksum.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -178,6 +211,31 @@ func main() {
 		})
 	}
 
+	cacheOptions := cache.Options{
+		// ConfigMaps and Secrets are only watched to trigger NSO reconciles, so
+		// the cache keeps their metadata and a digest of their data instead of
+		// the content of every ConfigMap and Secret in the cluster.
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {Transform: controller.TransformStripData},
+			&corev1.Secret{}:    {Transform: controller.TransformStripData},
+			// Pods are only watched to follow the readiness and image pull
+			// errors of the NSO pods and to read the results of the package
+			// download Jobs
+			&corev1.Pod{}: {Label: controller.ManagedObjectsSelector()},
+		},
+	}
+
+	// Restrict the cache to the watched namespaces, so the operator can run
+	// with namespaced Roles instead of a ClusterRole
+	namespaces := parseNamespaces(watchNamespaces)
+	if len(namespaces) > 0 {
+		setupLog.Info("Watching a fixed set of namespaces", "namespaces", namespaces)
+		cacheOptions.DefaultNamespaces = make(map[string]cache.Config, len(namespaces))
+		for _, namespace := range namespaces {
+			cacheOptions.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
@@ -196,19 +254,71 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		// LeaderElectionReleaseOnCancel: true,
+		Cache: cacheOptions,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	podExecutor, err := controller.NewPodExecutor(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create pod executor")
+		os.Exit(1)
+	}
+
+	imagePolicy, err := imagepolicy.Load(imagePolicyFile)
+	if err != nil {
+		setupLog.Error(err, "unable to load the image policy", "image-policy-file", imagePolicyFile)
+		os.Exit(1)
+	}
+	if imagePolicy != nil {
+		setupLog.Info("Enforcing the image policy", "allowedRegistries", imagePolicy.AllowedRegistries,
+			"requireSignature", imagePolicy.RequireSignature)
+	}
+
+	nativeSidecars, err := controller.NativeSidecarsSupported(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to get the Kubernetes version")
+		os.Exit(1)
+	}
+	setupLog.Info("Sidecar containers", "native", nativeSidecars)
+
 	if err := (&controller.NSOReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		APIReader:               mgr.GetAPIReader(),
+		WatchNamespaces:         namespaces,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		Executor:                podExecutor,
+		Recorder:                mgr.GetEventRecorderFor("nso-controller"),
+		NativeSidecars:          nativeSidecars,
+		ImagePolicy:             imagePolicy,
+		NSOClient:               controller.PodNSOClient(mgr.GetAPIReader()),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NSO")
 		os.Exit(1)
 	}
+	if packageFetcherImage == "" {
+		setupLog.Info("No package fetcher image, the packages of the PackageBundles can not be downloaded")
+	}
+	if err := (&controller.PackageBundleReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		FetcherImage:    packageFetcherImage,
+		RequireChecksum: requirePackageChecksums,
+		Recorder:        mgr.GetEventRecorderFor("packagebundle-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PackageBundle")
+		os.Exit(1)
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := webhookv1alpha1.SetupNSOWebhookWithManager(mgr, imagePolicy); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NSO")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -242,3 +352,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// parseNamespaces splits a comma separated list of namespaces, ignoring blanks.
+func parseNamespaces(value string) []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(value, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// First Kubernetes version running native sidecars by default
+var nativeSidecarsVersion = version.MustParseGeneric("1.29.0")
+
+// NativeSidecarsSupported returns whether the API server is recent enough to
+// run init containers with restartPolicy Always as sidecars
+func NativeSidecarsSupported(config *rest.Config) (bool, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return false, err
+	}
+	info, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, err
+	}
+	return serverVersion.AtLeast(nativeSidecarsVersion), nil
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	nsoclient "github.com/carlosgrillet/nso-operator/internal/nso"
+	"github.com/carlosgrillet/nso-operator/internal/nso/nsotest"
+)
+
+// Fixtures shared by the unit tests that run the reconciler against a fake
+// client, outside of the envtest suite
+
+const testNamespace = "default"
+
+// Returns a scheme with the built-in and NSO types
+func newTestScheme(t testing.TB) *runtime.Scheme {
+	t.Helper()
+	testScheme := runtime.NewScheme()
+	g := NewWithT(t)
+	g.Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+	g.Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+	return testScheme
+}
+
+// Returns an NSO with the given name and number of replicas, selecting its
+// pods with app=<name>
+func newTestNSO(name string, replicas int32) *orchestrationciscocomv1alpha1.NSO {
+	return &orchestrationciscocomv1alpha1.NSO{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: orchestrationciscocomv1alpha1.NSOSpec{
+			Image:         "cisco-nso-prod:6.3.1",
+			ServiceName:   name,
+			Replicas:      replicas,
+			LabelSelector: map[string]string{"app": name},
+			NsoConfigRef:  "nso-config",
+		},
+	}
+}
+
+// Returns a reconciler backed by a fake client holding the objects
+func newTestReconciler(t testing.TB, objects ...client.Object) *NSOReconciler {
+	t.Helper()
+	testScheme := newTestScheme(t)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(testScheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+		Build()
+	return &NSOReconciler{Client: fakeClient, Scheme: testScheme}
+}
+
+// Reconciles the NSO until the reconciler stops asking for an immediate
+// requeue, then reads the NSO back
+func reconcileNSO(g Gomega, r *NSOReconciler, nso *orchestrationciscocomv1alpha1.NSO) ctrl.Result {
+	ctx := context.Background()
+	key := client.ObjectKeyFromObject(nso)
+	var result ctrl.Result
+	g.Eventually(func() (bool, error) {
+		var err error
+		result, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		return result.Requeue, err
+	}).Should(BeFalse())
+	g.Expect(r.Get(ctx, key, nso)).To(Succeed())
+	return result
+}
+
+// fakeStatefulSetController does what the StatefulSet controller does for
+// the StatefulSet of an NSO
+type fakeStatefulSetController struct {
+	g        Gomega
+	client   client.Client
+	key      client.ObjectKey
+	revision int
+}
+
+// Returns a fake StatefulSet controller for the StatefulSet of the NSO
+func newFakeStatefulSetController(g Gomega, r *NSOReconciler, nso *orchestrationciscocomv1alpha1.NSO) *fakeStatefulSetController {
+	return &fakeStatefulSetController{g: g, client: r.Client, key: client.ObjectKeyFromObject(nso)}
+}
+
+// Returns the StatefulSet
+func (c *fakeStatefulSetController) get() *appsv1.StatefulSet {
+	statefulSet := &appsv1.StatefulSet{}
+	c.g.Expect(c.client.Get(context.Background(), c.key, statefulSet)).To(Succeed())
+	return statefulSet
+}
+
+// Returns the partition of the rolling update, 0 without one
+func (c *fakeStatefulSetController) partition() int32 {
+	rollingUpdate := c.get().Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate == nil || rollingUpdate.Partition == nil {
+		return 0
+	}
+	return *rollingUpdate.Partition
+}
+
+// Observes the latest template as a new revision
+func (c *fakeStatefulSetController) observe() *appsv1.StatefulSet {
+	c.revision++
+	statefulSet := c.get()
+	statefulSet.Status.ObservedGeneration = statefulSet.Generation
+	statefulSet.Status.UpdateRevision = fmt.Sprintf("revision-%d", c.revision)
+	c.g.Expect(c.client.Status().Update(context.Background(), statefulSet)).To(Succeed())
+	return statefulSet
+}
+
+// Observes the latest template as rolled out to every replica and replaces
+// the pods of the ordinals with ready pods running it
+func (c *fakeStatefulSetController) rollOut(ordinals ...int) {
+	ctx := context.Background()
+	statefulSet := c.observe()
+	statefulSet.Status.CurrentRevision = statefulSet.Status.UpdateRevision
+	statefulSet.Status.UpdatedReplicas = ptr.Deref(statefulSet.Spec.Replicas, 1)
+	statefulSet.Status.ReadyReplicas = statefulSet.Status.UpdatedReplicas
+	c.g.Expect(c.client.Status().Update(ctx, statefulSet)).To(Succeed())
+
+	for _, ordinal := range ordinals {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", c.key.Name, ordinal), Namespace: c.key.Namespace}}
+		_ = c.client.Delete(ctx, pod)
+		pod.Labels = map[string]string{appsv1.StatefulSetRevisionLabel: statefulSet.Status.UpdateRevision}
+		c.g.Expect(c.client.Create(ctx, pod)).To(Succeed())
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		c.g.Expect(c.client.Status().Update(ctx, pod)).To(Succeed())
+	}
+}
+
+// packageServers serve the RESTCONF API of the NSO pods, by pod name
+type packageServers map[string]*nsotest.Server
+
+// Returns RESTCONF servers for the replicas of the NSO, with the
+// cisco-ios-cli-6.85 and l3vpn packages up, and sets the reconciler to reach
+// them
+func newPackageServers(t testing.TB, r *NSOReconciler, nso *orchestrationciscocomv1alpha1.NSO) packageServers {
+	servers := packageServers{}
+	for ordinal := range nso.Spec.Replicas {
+		server := nsotest.NewServer()
+		t.Cleanup(server.Close)
+		servers[fmt.Sprintf("%s-%d", nso.Name, ordinal)] = server
+	}
+	servers.setPackagesUp(true)
+
+	r.NSOClient = func(_ context.Context, _ *orchestrationciscocomv1alpha1.NSO, pod string) (*nsoclient.Client, error) {
+		server, ok := servers[pod]
+		if !ok {
+			return nil, fmt.Errorf("no server for pod %s", pod)
+		}
+		return nsoclient.New(nsoclient.Options{
+			URL:      server.RESTCONFURL(),
+			Username: nsotest.Username,
+			Password: nsotest.Password,
+		})
+	}
+	return servers
+}
+
+// Sets whether the l3vpn package starts on every replica
+func (s packageServers) setPackagesUp(up bool) {
+	status := nsoclient.OperStatusUp
+	if !up {
+		status = "java-uninitialized"
+	}
+	for _, server := range s {
+		server.SetPackages(
+			nsotest.Package{Name: "cisco-ios-cli-6.85", Version: "6.85.3", OperStatus: nsoclient.OperStatusUp},
+			nsotest.Package{Name: "l3vpn", Version: "1.0", OperStatus: status},
+		)
+	}
+}
+
+// Returns the number of RESTCONF requests served to the pod
+func (s packageServers) requests(pod string) int {
+	return len(s[pod].Requests())
+}
+
+// fakeExecutor records the commands run in the NSO pods
+type fakeExecutor struct {
+	mutex    sync.Mutex
+	commands []string
+	stdout   func(pod string, command []string) string
+	stderr   string
+	err      error
+	// Holds the commands until closed, when set
+	release chan struct{}
+}
+
+func (e *fakeExecutor) Exec(_ context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	e.mutex.Lock()
+	e.commands = append(e.commands, fmt.Sprintf("%s/%s/%s: %s", namespace, pod, container, strings.Join(command, " ")))
+	e.mutex.Unlock()
+	if e.release != nil {
+		<-e.release
+	}
+	stdout := ""
+	if e.stdout != nil {
+		stdout = e.stdout(pod, command)
+	}
+	return stdout, e.stderr, e.err
+}
+
+// Returns the commands run so far
+func (e *fakeExecutor) ran() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return slices.Clone(e.commands)
+}
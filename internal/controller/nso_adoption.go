@@ -0,0 +1,344 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const (
+	// Maximum number of changes reported in the adoption diff
+	maxAdoptionDiffLines = 50
+	// Maximum length of a value printed in the adoption diff
+	maxAdoptionDiffValue = 80
+
+	// Annotation marking the objects taken over by adoption, whose changes are
+	// only applied with the Converge policy
+	adoptedAnnotation = "nso.orchestration.cisco.com/adopted"
+)
+
+// adoptionResult summarizes the existing objects found while adopting
+type adoptionResult struct {
+	// An object can not be adopted, or its changes are only reported
+	blocked bool
+	// Adopted objects are about to be converged to the NSO spec
+	converging bool
+}
+
+// Returns the adoption policy of the NSO, defaulting to Never
+func adoptionPolicy(nso *orchestrationciscocomv1alpha1.NSO) orchestrationciscocomv1alpha1.AdoptionPolicy {
+	if nso.Spec.AdoptionPolicy == "" {
+		return orchestrationciscocomv1alpha1.AdoptionPolicyNever
+	}
+	return nso.Spec.AdoptionPolicy
+}
+
+// Function to adopt the existing objects with the name of the desired ones
+// that were not created by the operator. Compatible objects are only given an
+// owner reference, so their pods keep running. Until the adoption policy is
+// Converge, the changes the operator would make are reported in the status
+// and the objects are left as they are.
+func (r *NSOReconciler) adoptObjects(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, desiredObjects ...client.Object) (adoptionResult, error) {
+	log := logf.FromContext(ctx)
+	policy := adoptionPolicy(nso)
+	result := adoptionResult{}
+
+	var conflicts, adopted, diff []string
+	for _, desired := range desiredObjects {
+		existing, ok := desired.DeepCopyObject().(client.Object)
+		if !ok {
+			return result, fmt.Errorf("unexpected object type %T", desired)
+		}
+		err := r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, existing)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return result, err
+		}
+
+		// Objects created by the operator, including those of versions not
+		// writing the hash of their desired state, are converged as usual.
+		// Adopted objects are until they are written with that hash.
+		controlled := metav1.IsControlledBy(existing, nso)
+		annotations := existing.GetAnnotations()
+		if controlled && (annotations[adoptedAnnotation] == "" || annotations[specHashAnnotation] != "") {
+			continue
+		}
+
+		name := objectKind(desired) + " " + desired.GetName()
+		if !controlled {
+			if policy == orchestrationciscocomv1alpha1.AdoptionPolicyNever {
+				conflicts = append(conflicts, name+" already exists")
+				continue
+			}
+			if problems := adoptionConflicts(existing, desired); len(problems) > 0 {
+				conflicts = append(conflicts, name+": "+strings.Join(problems, ", "))
+				continue
+			}
+
+			log.Info("Adopting existing resource", "kind", objectKind(desired), "name", desired.GetName())
+			patch := client.MergeFrom(existing.DeepCopyObject().(client.Object))
+			if err := controllerutil.SetControllerReference(nso, existing, r.Scheme); err != nil {
+				return result, err
+			}
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[adoptedAnnotation] = "true"
+			existing.SetAnnotations(annotations)
+			if err := r.Patch(ctx, existing, patch); err != nil {
+				return result, err
+			}
+		}
+		adopted = append(adopted, name)
+
+		if policy == orchestrationciscocomv1alpha1.AdoptionPolicyConverge {
+			result.converging = true
+			continue
+		}
+
+		// Let the API server apply the change without persisting it, so that
+		// defaulted fields do not show up as changes
+		candidate := existing.DeepCopyObject().(client.Object)
+		copyDesiredState(candidate, desired)
+		if err := r.Update(ctx, candidate, client.DryRunAll); err != nil {
+			return result, fmt.Errorf("failed to dry-run the update of %s: %w", name, err)
+		}
+		changes, err := specDiff(existing, candidate)
+		if err != nil {
+			return result, err
+		}
+		for _, change := range changes {
+			diff = append(diff, name+" "+change)
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionAdopted,
+		ObservedGeneration: nso.Generation,
+	}
+	switch {
+	case len(conflicts) > 0 && policy == orchestrationciscocomv1alpha1.AdoptionPolicyNever:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonAdoptionDisabled
+		condition.Message = strings.Join(conflicts, "; ") + ". Set spec.adoptionPolicy to DryRun to adopt"
+		result.blocked = true
+	case len(conflicts) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonIncompatible
+		condition.Message = "Cannot adopt " + strings.Join(conflicts, "; ")
+		result.blocked = true
+	case len(adopted) > 0 && !result.converging:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonChangesPending
+		condition.Message = fmt.Sprintf("Adopted %s with %d pending changes. Set spec.adoptionPolicy to Converge to apply them",
+			strings.Join(adopted, ", "), len(diff))
+		result.blocked = true
+	default:
+		// Nothing left to adopt, the condition is updated once converged
+		return result, nil
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, condition)
+
+	if len(diff) > maxAdoptionDiffLines {
+		diff = append(diff[:maxAdoptionDiffLines], fmt.Sprintf("... and %d more", len(diff)-maxAdoptionDiffLines))
+	}
+	nso.Status.AdoptionDiff = diff
+	return result, nil
+}
+
+// Returns why an existing object can not be adopted in place of the desired
+// one, that is the immutable fields it would have to change
+func adoptionConflicts(existing, desired client.Object) []string {
+	var problems []string
+	if owner := metav1.GetControllerOf(existing); owner != nil {
+		problems = append(problems, fmt.Sprintf("controlled by %s %s", owner.Kind, owner.Name))
+	}
+
+	switch existing := existing.(type) {
+	case *appsv1.StatefulSet:
+		desired := desired.(*appsv1.StatefulSet)
+		if !equality.Semantic.DeepEqual(existing.Spec.Selector, desired.Spec.Selector) {
+			problems = append(problems, fmt.Sprintf("selector %s does not match the NSO labelSelector %s",
+				metav1.FormatLabelSelector(existing.Spec.Selector), metav1.FormatLabelSelector(desired.Spec.Selector)))
+		}
+		if existing.Spec.ServiceName != desired.Spec.ServiceName {
+			problems = append(problems, fmt.Sprintf("serviceName %q does not match the NSO serviceName %q",
+				existing.Spec.ServiceName, desired.Spec.ServiceName))
+		}
+		if podManagementPolicy(existing) != podManagementPolicy(desired) {
+			problems = append(problems, fmt.Sprintf("podManagementPolicy %s does not match the NSO podManagementPolicy %s",
+				podManagementPolicy(existing), podManagementPolicy(desired)))
+		}
+		problems = append(problems, claimTemplateConflicts(existing.Spec.VolumeClaimTemplates, desired.Spec.VolumeClaimTemplates)...)
+	case *corev1.Service:
+		desired := desired.(*corev1.Service)
+		if existing.Spec.ClusterIP != desired.Spec.ClusterIP {
+			problems = append(problems, fmt.Sprintf("clusterIP %q is not headless", existing.Spec.ClusterIP))
+		}
+	}
+	return problems
+}
+
+// Returns the pod management policy of the StatefulSet, OrderedReady when not
+// set
+func podManagementPolicy(statefulSet *appsv1.StatefulSet) appsv1.PodManagementPolicyType {
+	if statefulSet.Spec.PodManagementPolicy == "" {
+		return appsv1.OrderedReadyPodManagement
+	}
+	return statefulSet.Spec.PodManagementPolicy
+}
+
+// Returns the differences between the existing and desired claim templates,
+// which can not be changed once the StatefulSet is created
+func claimTemplateConflicts(existing, desired []corev1.PersistentVolumeClaim) []string {
+	var problems []string
+	existingClaims := map[string]corev1.PersistentVolumeClaimSpec{}
+	for _, claim := range existing {
+		existingClaims[claim.Name] = claim.Spec
+	}
+
+	for _, claim := range desired {
+		spec, ok := existingClaims[claim.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("volume claim template %s is missing", claim.Name))
+			continue
+		}
+		delete(existingClaims, claim.Name)
+
+		if !equality.Semantic.DeepEqual(spec.AccessModes, claim.Spec.AccessModes) ||
+			!equality.Semantic.DeepEqual(spec.Resources.Requests, claim.Spec.Resources.Requests) ||
+			(claim.Spec.StorageClassName != nil && !equality.Semantic.DeepEqual(spec.StorageClassName, claim.Spec.StorageClassName)) {
+			problems = append(problems, fmt.Sprintf("volume claim template %s does not match the NSO volumeClaimTemplates", claim.Name))
+		}
+	}
+
+	names := make([]string, 0, len(existingClaims))
+	for name := range existingClaims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, fmt.Sprintf("volume claim template %s is not in the NSO volumeClaimTemplates", name))
+	}
+	return problems
+}
+
+// Returns the spec fields that differ between two versions of an object, as
+// "path: old -> new" lines
+func specDiff(existing, updated client.Object) ([]string, error) {
+	existingContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+	if err != nil {
+		return nil, err
+	}
+	updatedContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	diffValues("spec", existingContent["spec"], updatedContent["spec"], &changes)
+	return changes, nil
+}
+
+// Appends the leaf values that differ between old and new to changes. Values
+// only present on one side are reported as a whole.
+func diffValues(path string, oldValue, newValue interface{}, changes *[]string) {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffValues(path+"."+key, oldMap[key], newMap[key], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList {
+		for i := 0; i < max(len(oldList), len(newList)); i++ {
+			var oldItem, newItem interface{}
+			if i < len(oldList) {
+				oldItem = oldList[i]
+			}
+			if i < len(newList) {
+				newItem = newList[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), oldItem, newItem, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, diffValue(oldValue), diffValue(newValue)))
+	}
+}
+
+// Returns a short printable form of a diff value
+func diffValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if len(content) > maxAdoptionDiffValue {
+		return string(content[:maxAdoptionDiffValue]) + "..."
+	}
+	return string(content)
+}
+
+// Returns the kind of an object built by the operator
+func objectKind(obj client.Object) string {
+	switch obj.(type) {
+	case *appsv1.StatefulSet:
+		return "StatefulSet"
+	case *corev1.Service:
+		return "Service"
+	}
+	return fmt.Sprintf("%T", obj)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Returns a reconciler holding an NSO with the adoption policy next to the
+// StatefulSet and Service of config/samples/nso-sample-sts.yaml, selecting
+// their pods with the selector
+func newAdoptionReconciler(t *testing.T, policy orchestrationciscocomv1alpha1.AdoptionPolicy, selector map[string]string) *NSOReconciler {
+	image := "containers.cisco.com/cisco-nso/cisco-nso-prod:6.1.11"
+	nso := newTestNSO("nso", 3)
+	nso.Spec.Image = image
+	nso.Spec.ServiceName = "nso-svc"
+	nso.Spec.LabelSelector = map[string]string{"app": "nso-app"}
+	nso.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: 8080}}
+	nso.Spec.NsoConfigRef = "ncs-config"
+	nso.Spec.AdoptionPolicy = policy
+	nso.Spec.AdminCredentials = orchestrationciscocomv1alpha1.Credentials{
+		Username:          "admin",
+		PasswordSecretRef: "nso-credentials",
+	}
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: nso.Name, Namespace: nso.Namespace},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    ptr.To(int32(3)),
+			ServiceName: "nso-svc",
+			Selector:    &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: selector},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "nso-master", Image: image}},
+				},
+			},
+		},
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "nso-svc", Namespace: nso.Namespace},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  selector,
+		},
+	}
+
+	return newTestReconciler(t, nso, statefulSet, service)
+}
+
+func TestAdoption(t *testing.T) {
+	ctx := context.Background()
+	key := client.ObjectKey{Name: "nso", Namespace: testNamespace}
+	request := reconcile.Request{NamespacedName: key}
+	selector := map[string]string{"app": "nso-app"}
+
+	adopted := func(g Gomega, r *NSOReconciler) (*metav1.Condition, *orchestrationciscocomv1alpha1.NSO) {
+		nso := &orchestrationciscocomv1alpha1.NSO{}
+		g.Expect(r.Get(ctx, key, nso)).To(Succeed())
+		return meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionAdopted), nso
+	}
+
+	statefulSet := func(g Gomega, r *NSOReconciler) *appsv1.StatefulSet {
+		statefulSet := &appsv1.StatefulSet{}
+		g.Expect(r.Get(ctx, key, statefulSet)).To(Succeed())
+		return statefulSet
+	}
+
+	t.Run("leaves existing objects alone by default", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newAdoptionReconciler(t, "", selector)
+
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		condition, _ := adopted(g, r)
+		g.Expect(condition).NotTo(BeNil())
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonAdoptionDisabled))
+		g.Expect(condition.Message).To(ContainSubstring("StatefulSet nso already exists"))
+		g.Expect(statefulSet(g, r).OwnerReferences).To(BeEmpty())
+	})
+
+	t.Run("converges the objects created by previous operator versions", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newAdoptionReconciler(t, "", selector)
+		nso := &orchestrationciscocomv1alpha1.NSO{}
+		g.Expect(r.Get(ctx, key, nso)).To(Succeed())
+		for _, object := range []client.Object{&appsv1.StatefulSet{}, &corev1.Service{}} {
+			name := key
+			if _, ok := object.(*corev1.Service); ok {
+				name.Name = "nso-svc"
+			}
+			g.Expect(r.Get(ctx, name, object)).To(Succeed())
+			g.Expect(controllerutil.SetControllerReference(nso, object, r.Scheme)).To(Succeed())
+			g.Expect(r.Update(ctx, object)).To(Succeed())
+		}
+
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		condition, nso := adopted(g, r)
+		g.Expect(condition).To(BeNil())
+		g.Expect(nso.Status.AdoptionDiff).To(BeEmpty())
+		g.Expect(statefulSet(g, r).Spec.Template.Spec.Containers[0].Name).To(Equal("ncs"))
+		g.Expect(statefulSet(g, r).Annotations).To(HaveKey(specHashAnnotation))
+	})
+
+	t.Run("refuses to adopt a StatefulSet with another selector", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newAdoptionReconciler(t, orchestrationciscocomv1alpha1.AdoptionPolicyDryRun, map[string]string{"app": "legacy"})
+
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		condition, _ := adopted(g, r)
+		g.Expect(condition).NotTo(BeNil())
+		g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonIncompatible))
+		g.Expect(condition.Message).To(ContainSubstring("selector app=legacy does not match the NSO labelSelector app=nso-app"))
+	})
+
+	t.Run("takes ownership and reports the pending changes without applying them", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newAdoptionReconciler(t, orchestrationciscocomv1alpha1.AdoptionPolicyDryRun, selector)
+
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(metav1.GetControllerOf(statefulSet(g, r))).NotTo(BeNil())
+		g.Expect(statefulSet(g, r).Spec.Template.Spec.Containers[0].Name).To(Equal("nso-master"))
+
+		condition, nso := adopted(g, r)
+		g.Expect(condition).NotTo(BeNil())
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonChangesPending))
+		g.Expect(nso.Status.AdoptionDiff).To(ContainElement(
+			`StatefulSet nso spec.template.spec.containers[0].name: "nso-master" -> "ncs"`))
+	})
+
+	t.Run("converges the adopted objects once asked to", func(t *testing.T) {
+		g := NewWithT(t)
+		r := newAdoptionReconciler(t, orchestrationciscocomv1alpha1.AdoptionPolicyDryRun, selector)
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		_, nso := adopted(g, r)
+		nso.Spec.AdoptionPolicy = orchestrationciscocomv1alpha1.AdoptionPolicyConverge
+		g.Expect(r.Update(ctx, nso)).To(Succeed())
+		_, err = r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(statefulSet(g, r).Spec.Template.Spec.Containers[0].Name).To(Equal("ncs"))
+		g.Expect(statefulSet(g, r).Annotations).To(HaveKey(specHashAnnotation))
+		condition, nso := adopted(g, r)
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonConverged))
+		g.Expect(nso.Status.AdoptionDiff).To(BeEmpty())
+	})
+}
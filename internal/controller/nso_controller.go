@@ -18,27 +18,88 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/imagepolicy"
+)
+
+const (
+	// Annotation holding the hash of the desired state an owned object was last written with
+	specHashAnnotation = "nso.orchestration.cisco.com/spec-hash"
+	// Pod template annotation holding the hash of the ConfigMaps and Secrets consumed by the pods
+	dependenciesHashAnnotation = "nso.orchestration.cisco.com/dependencies-hash"
+
+	// Field index holding the names of the ConfigMaps referenced by an NSO
+	configMapRefIndexKey = ".spec.configMapRefs"
+	// Field index holding the names of the Secrets referenced by an NSO
+	secretRefIndexKey = ".spec.secretRefs"
 )
 
 // NSOReconciler reconciles a NSO object
 type NSOReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Reads the objects whose content is not cached, such as the content of
+	// Secrets. Defaults to the client.
+	APIReader client.Reader
+
+	// Namespaces the operator is restricted to. Empty means all namespaces.
+	WatchNamespaces []string
+
+	// Maximum number of NSO instances reconciled in parallel. Defaults to 1.
+	MaxConcurrentReconciles int
+
+	// Runs commands in the NSO pods, e.g. the backup taken before deletion
+	Executor CommandExecutor
+
+	// Records the Events emitted on NSO instances
+	Recorder record.EventRecorder
+
+	// Whether the cluster runs init containers with restartPolicy Always as
+	// native sidecars. Otherwise sidecars are regular containers.
+	NativeSidecars bool
+
+	// Registries the NSO images must come from and signature the NSO image
+	// must carry. Nil allows every image.
+	ImagePolicy *imagepolicy.Policy
+
+	// Returns the RESTCONF client the NSO pods are polled with for their NSO
+	// version and packages. Nil disables the polling.
+	NSOClient NSOClientFunc
+
+	// Pinned images whose signature was verified since the operator started
+	verifiedImages sync.Map
+
+	// Backups running in the background in the NSO pods, before upgrading
+	// or deleting them
+	backups sync.Map
 }
 
 // +kubebuilder:rbac:groups=orchestration.cisco.com.cisco.com,resources=nsos,verbs=get;list;watch;create;update;patch;delete
@@ -46,8 +107,13 @@ type NSOReconciler struct {
 // +kubebuilder:rbac:groups=orchestration.cisco.com.cisco.com,resources=nsos/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=orchestration.cisco.com.cisco.com,resources=packagebundles,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/exec,verbs=create
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -61,6 +127,12 @@ type NSOReconciler struct {
 func (r *NSOReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := logf.FromContext(ctx)
 
+	// NSO instances outside the watched namespaces belong to another operator
+	if !r.watchesNamespace(req.Namespace) {
+		log.V(1).Info("Ignoring NSO outside the watched namespaces")
+		return ctrl.Result{}, nil
+	}
+
 	// Fetch the NSO instance
 	nso := &orchestrationciscocomv1alpha1.NSO{}
 	err := r.Get(ctx, req.NamespacedName, nso)
@@ -73,46 +145,313 @@ func (r *NSOReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
-	// Objects to create - Service must be created first for StatefulSet
+	// Apply the deletion policy before letting the NSO go. This is done even
+	// when paused, as the deletion was explicitly requested.
+	if !nso.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(nso, nsoFinalizer) {
+			return r.finalizeNSO(ctx, nso)
+		}
+		return ctrl.Result{}, nil
+	}
 
+	original := nso.DeepCopy()
+
+	// Skip every mutation while the NSO is paused for maintenance, including
+	// adding the finalizer
+	if isPaused(nso) {
+		log.Info("Reconciliation is paused, skipping")
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionPaused,
+			Status:             metav1.ConditionTrue,
+			Reason:             orchestrationciscocomv1alpha1.ReasonReconciliationPaused,
+			Message:            "Reconciliation paused by the " + orchestrationciscocomv1alpha1.PausedAnnotation + " annotation",
+			ObservedGeneration: nso.Generation,
+		})
+		return ctrl.Result{}, r.patchStatus(ctx, original, nso)
+	}
+
+	if controllerutil.AddFinalizer(nso, nsoFinalizer) {
+		if err := r.Update(ctx, nso); err != nil {
+			log.Error(err, "Failed to add finalizer to NSO")
+			return ctrl.Result{}, err
+		}
+		original = nso.DeepCopy()
+	}
+
+	// Once resumed, the desired state is written again even if the NSO spec
+	// did not change, undoing the manual changes made during maintenance
+	resuming := meta.IsStatusConditionTrue(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPaused)
+
+	// Resolve the ConfigMaps and Secrets consumed by the NSO pods
+	dependenciesHash, err := r.resolveDependencies(ctx, nso)
+	if err != nil {
+		log.Error(err, "Failed to resolve NSO dependencies")
+		return ctrl.Result{}, err
+	}
+
+	// Enforce the image policy before contacting any registry
+	if err := r.checkAllowedImages(nso, imagesOfNSO(nso)); err != nil {
+		log.Info("NSO images rejected by the image policy, see the ImageAllowed condition")
+		return ctrl.Result{}, r.patchStatus(ctx, original, nso)
+	}
+
+	// Pin the NSO image to its digest when asked to
+	image, retryAfter, err := r.imageForNSO(ctx, nso)
+	if err != nil {
+		log.Error(err, "Failed to resolve the NSO image")
+		return ctrl.Result{}, err
+	}
+	if image == "" {
+		log.Info("Waiting for the NSO image digest, see the ImagePinned and ImageAllowed conditions")
+		return ctrl.Result{RequeueAfter: retryAfter}, r.patchStatus(ctx, original, nso)
+	}
+
+	// Objects to create - Service must be created first for StatefulSet
 	service := r.serviceForNSO(nso, ctx)
-	requeue, err := r.ensureObjectExists(ctx, service)
+	statefulSet := r.statefulSetForNSO(nso, ctx)
+	for i := range statefulSet.Spec.Template.Spec.Containers {
+		if statefulSet.Spec.Template.Spec.Containers[i].Name == nsoContainerName {
+			statefulSet.Spec.Template.Spec.Containers[i].Image = image
+		}
+	}
+	// Load the packages downloaded by the PackageBundles targeting the NSO
+	if err := r.mountPackageBundles(ctx, nso, statefulSet); err != nil {
+		log.Error(err, "Failed to list the PackageBundles of the NSO")
+		return ctrl.Result{}, err
+	}
+	if err := applyPodTemplateOverride(nso, statefulSet); err != nil {
+		log.Error(err, "Invalid podTemplate override, see the PodTemplateApplied condition")
+		return ctrl.Result{}, r.patchStatus(ctx, original, nso)
+	}
+	// The override may add containers of its own
+	if err := r.checkAllowedImages(nso, imagesOfTemplate(&statefulSet.Spec.Template)); err != nil {
+		log.Info("NSO images rejected by the image policy, see the ImageAllowed condition")
+		return ctrl.Result{}, r.patchStatus(ctx, original, nso)
+	}
+	r.setImagesAllowed(nso)
+	metav1.SetMetaDataAnnotation(&statefulSet.Spec.Template.ObjectMeta, dependenciesHashAnnotation, dependenciesHash)
+
+	// Take over the objects created by hand with the same names
+	adoption, err := r.adoptObjects(ctx, nso, service, statefulSet)
+	if err != nil {
+		log.Error(err, "Failed to adopt existing resources")
+		return ctrl.Result{}, err
+	}
+	if err := r.patchStatus(ctx, original, nso); err != nil {
+		log.Error(err, "Failed to update NSO status")
+		return ctrl.Result{}, err
+	}
+	if adoption.blocked {
+		log.Info("Existing resources are not converged, see the Adopted condition")
+		return ctrl.Result{}, nil
+	}
+
+	// Roll a new NSO version out one replica at a time
+	original = nso.DeepCopy()
+	upgradeRetryAfter, err := r.orchestrateUpgrade(ctx, nso, statefulSet)
+	if err != nil {
+		log.Error(err, "Failed to upgrade NSO")
+		return ctrl.Result{}, err
+	}
+	if err := r.patchStatus(ctx, original, nso); err != nil {
+		log.Error(err, "Failed to update NSO status")
+		return ctrl.Result{}, err
+	}
+	retryAfter = earliestRetry(retryAfter, upgradeRetryAfter)
+
+	// Restart the replicas one at a time when restartedAt changes
+	original = nso.DeepCopy()
+	restartRetryAfter, err := r.orchestrateRestart(ctx, nso, statefulSet)
+	if err != nil {
+		log.Error(err, "Failed to restart NSO")
+		return ctrl.Result{}, err
+	}
+	if err := r.patchStatus(ctx, original, nso); err != nil {
+		log.Error(err, "Failed to update NSO status")
+		return ctrl.Result{}, err
+	}
+	retryAfter = earliestRetry(retryAfter, restartRetryAfter)
+
+	requeue, err := r.ensureObjectUpToDate(ctx, service, resuming)
 	if err != nil || requeue {
-		return ctrl.Result{Requeue: requeue}, nil
+		return ctrl.Result{Requeue: requeue}, err
 	}
 
-	statefulSet := r.statefulSetForNSO(nso, ctx)
-	requeue, err = r.ensureObjectExists(ctx, statefulSet)
+	requeue, err = r.ensureObjectUpToDate(ctx, statefulSet, resuming)
 	if err != nil || requeue {
-		return ctrl.Result{Requeue: requeue}, nil
+		return ctrl.Result{Requeue: requeue}, err
+	}
+
+	// Move the partition down once the canary replicas are healthy
+	promoteRetryAfter, err := r.promoteRollout(ctx, nso)
+	if err != nil {
+		log.Error(err, "Failed to promote the NSO rollout")
+		return ctrl.Result{}, err
+	}
+	retryAfter = earliestRetry(retryAfter, promoteRetryAfter)
+
+	if err := r.syncClaimMetadata(ctx, nso); err != nil {
+		log.Error(err, "Failed to update persistent volume claims metadata")
+		return ctrl.Result{}, err
+	}
+
+	// Delete the objects left behind by a previous spec, e.g. the old Service
+	// after serviceName changed
+	original = nso.DeepCopy()
+	if err := r.pruneObjects(ctx, nso, service, statefulSet); err != nil {
+		log.Error(err, "Failed to prune stale resources")
+		return ctrl.Result{}, err
+	}
+
+	// Surface the image pull errors of the pods on the NSO
+	if err := r.checkImagePulls(ctx, nso); err != nil {
+		log.Error(err, "Failed to check the NSO pods")
+		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Read the NSO version and packages of the replicas through RESTCONF
+	pollRetryAfter, err := r.pollReplicas(ctx, nso)
+	if err != nil {
+		log.Error(err, "Failed to poll the NSO replicas")
+		return ctrl.Result{}, err
+	}
+	retryAfter = earliestRetry(retryAfter, pollRetryAfter)
+
+	if resuming {
+		log.Info("Reconciliation resumed")
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionPaused,
+			Status:             metav1.ConditionFalse,
+			Reason:             orchestrationciscocomv1alpha1.ReasonReconciliationResumed,
+			Message:            "Reconciliation is active",
+			ObservedGeneration: nso.Generation,
+		})
+	}
+	if adoption.converging {
+		log.Info("Adopted resources converged")
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionAdopted,
+			Status:             metav1.ConditionTrue,
+			Reason:             orchestrationciscocomv1alpha1.ReasonConverged,
+			Message:            "Adopted resources converged to the NSO spec",
+			ObservedGeneration: nso.Generation,
+		})
+		nso.Status.AdoptionDiff = nil
+	}
+	if err := r.patchStatus(ctx, original, nso); err != nil {
+		log.Error(err, "Failed to update NSO status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: retryAfter}, nil
+}
+
+// Returns the shortest of two retry delays, a zero delay meaning no retry
+func earliestRetry(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
 }
 
-// Function to safely verify if the resource is created or not before reconcile
-func (r *NSOReconciler) ensureObjectExists(ctx context.Context, obj client.Object) (bool, error) {
+// Function to create the resource, or to update it when the desired state
+// changed since it was last written by the operator. With force set, the
+// desired state is written even if it did not change.
+func (r *NSOReconciler) ensureObjectUpToDate(ctx context.Context, desired client.Object, force bool) (bool, error) {
 	log := logf.FromContext(ctx)
 
-	err := r.Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, obj)
+	specHash, err := objectHash(desired)
+	if err != nil {
+		log.Error(err, "Failed to compute resource hash", "name", desired.GetName(), "namespace", desired.GetNamespace())
+		return false, err
+	}
+	annotations := desired.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[specHashAnnotation] = specHash
+	desired.SetAnnotations(annotations)
+
+	existing, ok := desired.DeepCopyObject().(client.Object)
+	if !ok {
+		return false, fmt.Errorf("unexpected object type %T", desired)
+	}
+	err = r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, existing)
 
 	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new resource", "kind:", obj.GetObjectKind().GroupVersionKind(), "name", obj.GetName(), "namespace", obj.GetNamespace())
-		err = r.Create(ctx, obj)
+		log.Info("Creating a new resource", "kind", fmt.Sprintf("%T", desired), "name", desired.GetName(), "namespace", desired.GetNamespace())
+		err = r.Create(ctx, desired)
 		if err != nil {
-			log.Error(err, "Failed to create new resource", "kind:", obj.GetObjectKind().GroupVersionKind(), "name", obj.GetName(), "namespace", obj.GetNamespace())
+			log.Error(err, "Failed to create new resource", "kind", fmt.Sprintf("%T", desired), "name", desired.GetName(), "namespace", desired.GetNamespace())
 			return false, err
 		}
 		return true, nil
 	} else if err != nil {
-		log.Error(err, "Failed to get resource", "kind:", obj.GetObjectKind().GroupVersionKind(), "name", obj.GetName(), "namespace", obj.GetNamespace())
+		log.Error(err, "Failed to get resource", "kind", fmt.Sprintf("%T", desired), "name", desired.GetName(), "namespace", desired.GetNamespace())
 		return false, err
 	}
 
-	log.Info("Skip reconcile: resource already exists", "kind:", obj.GetObjectKind().GroupVersionKind(), "name", obj.GetName(), "namespace", obj.GetNamespace())
+	if !force && existing.GetAnnotations()[specHashAnnotation] == specHash {
+		log.V(1).Info("Skip reconcile: resource is up to date", "kind", fmt.Sprintf("%T", desired), "name", desired.GetName(), "namespace", desired.GetNamespace())
+		return false, nil
+	}
+
+	log.Info("Updating resource", "kind", fmt.Sprintf("%T", desired), "name", desired.GetName(), "namespace", desired.GetNamespace())
+	copyDesiredState(existing, desired)
+	err = r.Update(ctx, existing)
+	if err != nil {
+		log.Error(err, "Failed to update resource", "kind", fmt.Sprintf("%T", desired), "name", desired.GetName(), "namespace", desired.GetNamespace())
+		return false, err
+	}
 	return false, nil
 }
 
+// Returns a hash of the object as built by the operator
+func objectHash(obj client.Object) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Copies the operator managed fields of the desired object over the existing
+// one. Immutable fields, such as the StatefulSet selector or the Service
+// clusterIP, are left untouched.
+func copyDesiredState(existing, desired client.Object) {
+	labels := existing.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range desired.GetLabels() {
+		labels[key] = value
+	}
+	existing.SetLabels(labels)
+
+	annotations := existing.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for key, value := range desired.GetAnnotations() {
+		annotations[key] = value
+	}
+	existing.SetAnnotations(annotations)
+
+	switch existing := existing.(type) {
+	case *appsv1.StatefulSet:
+		desired := desired.(*appsv1.StatefulSet)
+		existing.Spec.Replicas = desired.Spec.Replicas
+		existing.Spec.Template = desired.Spec.Template
+		existing.Spec.UpdateStrategy = desired.Spec.UpdateStrategy
+		existing.Spec.PersistentVolumeClaimRetentionPolicy = desired.Spec.PersistentVolumeClaimRetentionPolicy
+	case *corev1.Service:
+		desired := desired.(*corev1.Service)
+		existing.Spec.Ports = desired.Spec.Ports
+		existing.Spec.Selector = desired.Spec.Selector
+	}
+}
+
 func (r *NSOReconciler) statefulSetForNSO(nso *orchestrationciscocomv1alpha1.NSO, ctx context.Context) *appsv1.StatefulSet {
 	log := logf.FromContext(ctx)
 	statefulSetName := nso.Name
@@ -121,6 +460,7 @@ func (r *NSOReconciler) statefulSetForNSO(nso *orchestrationciscocomv1alpha1.NSO
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      statefulSetName,
 			Namespace: nso.Namespace,
+			Labels:    objectLabels(nso),
 		},
 		Spec: appsv1.StatefulSetSpec{
 			ServiceName: nso.Spec.ServiceName,
@@ -128,19 +468,26 @@ func (r *NSOReconciler) statefulSetForNSO(nso *orchestrationciscocomv1alpha1.NSO
 			Selector: &metav1.LabelSelector{
 				MatchLabels: nso.Spec.LabelSelector,
 			},
+			PodManagementPolicy:                  nso.Spec.PodManagementPolicy,
+			VolumeClaimTemplates:                 volumeClaimTemplatesForNSO(nso),
+			PersistentVolumeClaimRetentionPolicy: claimRetentionPolicy(nso),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: nso.Spec.LabelSelector,
+					Labels:      mergeLabels(nso, nso.Spec.PodMetadata),
+					Annotations: extraAnnotations(nso.Spec.PodMetadata),
 				},
 				Spec: corev1.PodSpec{
+					ImagePullSecrets:              nso.Spec.ImagePullSecrets,
+					TerminationGracePeriodSeconds: nso.Spec.TerminationGracePeriodSeconds,
 					Containers: []corev1.Container{{
-						Name:  "ncs",
-						Image: nso.Spec.Image,
+						Name:            nsoContainerName,
+						Image:           nso.Spec.Image,
+						ImagePullPolicy: nso.Spec.ImagePullPolicy,
 						Ports: []corev1.ContainerPort{{
-							ContainerPort: 8080,
+							ContainerPort: httpPort,
 							Name:          "http",
 						}, {
-							ContainerPort: 8888,
+							ContainerPort: httpsPort,
 							Name:          "https",
 						}},
 						Env: append([]corev1.EnvVar{{
@@ -157,6 +504,10 @@ func (r *NSOReconciler) statefulSetForNSO(nso *orchestrationciscocomv1alpha1.NSO
 								},
 							},
 						}}, nso.Spec.Env...),
+						EnvFrom: nso.Spec.EnvFrom,
+						Lifecycle: &corev1.Lifecycle{
+							PreStop: preStopHandler(nso),
+						},
 						VolumeMounts: append([]corev1.VolumeMount{{
 							Name:      "ncs-config",
 							MountPath: "/etc/ncs/ncs.conf",
@@ -168,7 +519,7 @@ func (r *NSOReconciler) statefulSetForNSO(nso *orchestrationciscocomv1alpha1.NSO
 						VolumeSource: corev1.VolumeSource{
 							ConfigMap: &corev1.ConfigMapVolumeSource{
 								LocalObjectReference: corev1.LocalObjectReference{
-									Name: "ncs-config",
+									Name: nso.Spec.NsoConfigRef,
 								},
 								Items: []corev1.KeyToPath{{
 									Key:  "ncs.conf",
@@ -182,6 +533,42 @@ func (r *NSOReconciler) statefulSetForNSO(nso *orchestrationciscocomv1alpha1.NSO
 			},
 		},
 	}
+
+	// Mount the backup claim where ncs-backup writes to
+	if nso.Spec.Backup != nil {
+		podSpec := &statefulSet.Spec.Template.Spec
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: backupVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: nso.Spec.Backup.ClaimName,
+				},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      backupVolumeName,
+			MountPath: backupMountPath,
+		})
+	}
+
+	if nso.Spec.UpdateStrategy != nil {
+		statefulSet.Spec.UpdateStrategy = *nso.Spec.UpdateStrategy.DeepCopy()
+	}
+
+	// Sidecars are started before NSO and stopped after it where the cluster
+	// runs them natively, and run as regular containers otherwise
+	podSpec := &statefulSet.Spec.Template.Spec
+	podSpec.InitContainers = append(podSpec.InitContainers, nso.Spec.InitContainers...)
+	for i := range nso.Spec.Sidecars {
+		sidecar := nso.Spec.Sidecars[i].DeepCopy()
+		if r.NativeSidecars {
+			sidecar.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
+			podSpec.InitContainers = append(podSpec.InitContainers, *sidecar)
+		} else {
+			podSpec.Containers = append(podSpec.Containers, *sidecar)
+		}
+	}
+
 	err := controllerutil.SetControllerReference(nso, statefulSet, r.Scheme)
 	if err != nil {
 		log.Error(err, "Failed to set controller reference for StatefulSet")
@@ -194,9 +581,10 @@ func (r *NSOReconciler) serviceForNSO(nso *orchestrationciscocomv1alpha1.NSO, ct
 	log := logf.FromContext(ctx)
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      nso.Spec.ServiceName,
-			Namespace: nso.Namespace,
-			Labels:    nso.Spec.LabelSelector,
+			Name:        nso.Spec.ServiceName,
+			Namespace:   nso.Namespace,
+			Labels:      mergeLabels(nso, nso.Spec.ServiceMetadata),
+			Annotations: extraAnnotations(nso.Spec.ServiceMetadata),
 		},
 		Spec: corev1.ServiceSpec{
 			Type:      corev1.ServiceTypeClusterIP,
@@ -213,45 +601,89 @@ func (r *NSOReconciler) serviceForNSO(nso *orchestrationciscocomv1alpha1.NSO, ct
 	return service
 }
 
+// Function to record an Event on the NSO, if a recorder is configured
+func (r *NSOReconciler) recordEvent(nso *orchestrationciscocomv1alpha1.NSO, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(nso, eventType, reason, message)
+	}
+}
+
+// Index function for the configMapRefIndexKey field index
+func indexNSOByConfigMapRefs(obj client.Object) []string {
+	nso, ok := obj.(*orchestrationciscocomv1alpha1.NSO)
+	if !ok {
+		return nil
+	}
+	return dependencyNames(nso, kindConfigMap)
+}
+
+// Index function for the secretRefIndexKey field index
+func indexNSOBySecretRefs(obj client.Object) []string {
+	nso, ok := obj.(*orchestrationciscocomv1alpha1.NSO)
+	if !ok {
+		return nil
+	}
+	return dependencyNames(nso, kindSecret)
+}
+
+// Function to check if the NSO carries the paused annotation
+func isPaused(nso *orchestrationciscocomv1alpha1.NSO) bool {
+	return nso.Annotations[orchestrationciscocomv1alpha1.PausedAnnotation] == "true"
+}
+
+// Function to check if a namespace is part of the watched set
+func (r *NSOReconciler) watchesNamespace(namespace string) bool {
+	return len(r.WatchNamespaces) == 0 || slices.Contains(r.WatchNamespaces, namespace)
+}
+
+// Function to persist the status changes made during reconcile
+func (r *NSOReconciler) patchStatus(ctx context.Context, original, nso *orchestrationciscocomv1alpha1.NSO) error {
+	if equality.Semantic.DeepEqual(original.Status, nso.Status) {
+		return nil
+	}
+	return r.Status().Patch(ctx, nso, client.MergeFrom(original))
+}
+
 // Maps ConfigMap and Secrets changes to NSO reconcile requests
 func (r *NSOReconciler) watchForResourceChange(ctx context.Context, resource client.Object) []reconcile.Request {
 	log := logf.FromContext(ctx)
 	attachedNSOList := &orchestrationciscocomv1alpha1.NSOList{}
 	resourceName := resource.GetName()
-	resourceKind := resource.GetObjectKind().GroupVersionKind().Kind
 
-	// List all NSO resources in the same namespace
-	listOptions := &client.ListOptions{
-		Namespace: resource.GetNamespace(),
+	// Objects coming from the cache do not carry their TypeMeta, so the kind
+	// is derived from the Go type instead
+	var resourceKind, indexKey string
+	switch resource.(type) {
+	case *corev1.ConfigMap:
+		resourceKind, indexKey = kindConfigMap, configMapRefIndexKey
+	case *corev1.Secret:
+		resourceKind, indexKey = kindSecret, secretRefIndexKey
+	default:
+		return nil
 	}
 
-	// Verify if there are NSO instances in the namespace
-	err := r.List(ctx, attachedNSOList, listOptions)
+	// Only list the NSO resources in the same namespace that reference the resource
+	err := r.List(ctx, attachedNSOList,
+		client.InNamespace(resource.GetNamespace()),
+		client.MatchingFields{indexKey: resourceName},
+	)
 	if err != nil {
-		return []reconcile.Request{}
+		log.Error(err, "Failed to list NSO instances referencing resource",
+			"kind", resourceKind, "name", resourceName, "namespace", resource.GetNamespace())
+		return nil
 	}
 
-	requests := make([]reconcile.Request, 0)
+	requests := make([]reconcile.Request, 0, len(attachedNSOList.Items))
 	for _, nso := range attachedNSOList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      nso.GetName(),
+				Namespace: nso.GetNamespace(),
+			},
+		})
 
-		nsoConfigMapName := nso.Spec.NsoConfigRef
-		nsoSecretName := nso.Spec.AdminCredentials.PasswordSecretRef
-
-		shouldReconcile := (resourceKind == "Secret" && nsoSecretName == resourceName) ||
-			(resourceKind == "ConfigMap" && nsoConfigMapName == resourceName)
-
-		if shouldReconcile {
-			requests = append(requests, reconcile.Request{
-				NamespacedName: types.NamespacedName{
-					Name:      nso.GetName(),
-					Namespace: nso.GetNamespace(),
-				},
-			})
-
-			log.Info("Resource change detected. Reconciling NSO",
-				"nsoInstace", nso.GetName(),
-				"resourceChanged", "kind", resourceKind, "name", resourceName)
-		}
+		log.Info("Resource change detected. Reconciling NSO",
+			"nsoInstance", nso.GetName(), "kind", resourceKind, "name", resourceName)
 	}
 
 	return requests
@@ -259,18 +691,46 @@ func (r *NSOReconciler) watchForResourceChange(ctx context.Context, resource cli
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *NSOReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Index NSO instances by the objects they reference so that ConfigMap and
+	// Secret events can be mapped without scanning every NSO in the namespace
+	ctx := context.Background()
+	indexer := mgr.GetFieldIndexer()
+	if err := indexer.IndexField(ctx, &orchestrationciscocomv1alpha1.NSO{}, configMapRefIndexKey, indexNSOByConfigMapRefs); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &orchestrationciscocomv1alpha1.NSO{}, secretRefIndexKey, indexNSOBySecretRefs); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&orchestrationciscocomv1alpha1.NSO{}).
-		Owns(&appsv1.StatefulSet{}).
+		For(&orchestrationciscocomv1alpha1.NSO{}, builder.WithPredicates(
+			r.watchedNamespacePredicate(),
+			nsoChangedPredicate(),
+		)).
+		Owns(&appsv1.StatefulSet{}, builder.WithPredicates(statefulSetChangedPredicate())).
 		Owns(&corev1.Service{}).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.watchForPodChange),
+			builder.WithPredicates(podChangedPredicate()),
+		).
 		Watches(
 			&corev1.ConfigMap{},
 			handler.EnqueueRequestsFromMapFunc(r.watchForResourceChange),
+			builder.WithPredicates(dataChangedPredicate()),
 		).
 		Watches(
 			&corev1.Secret{},
 			handler.EnqueueRequestsFromMapFunc(r.watchForResourceChange),
+			builder.WithPredicates(dataChangedPredicate()),
+		).
+		Watches(
+			&orchestrationciscocomv1alpha1.PackageBundle{},
+			handler.EnqueueRequestsFromMapFunc(r.watchForPackageBundleChange),
 		).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
 		Named("nso").
 		Complete(r)
 }
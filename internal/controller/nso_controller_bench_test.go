@@ -0,0 +1,166 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const benchNamespace = "bench"
+
+// cacheReader serves NSO lists from a client-go indexer the same way the
+// manager cache does: field selectors are answered from the index and every
+// returned item is deep copied.
+type cacheReader struct {
+	client.Client
+	indexer toolscache.Indexer
+}
+
+func (c *cacheReader) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	var objs []interface{}
+	var err error
+	if listOpts.FieldSelector != nil {
+		requirement := listOpts.FieldSelector.Requirements()[0]
+		objs, err = c.indexer.ByIndex(requirement.Field, listOpts.Namespace+"/"+requirement.Value)
+	} else {
+		objs, err = c.indexer.ByIndex(toolscache.NamespaceIndex, listOpts.Namespace)
+	}
+	if err != nil {
+		return err
+	}
+
+	nsoList := list.(*orchestrationciscocomv1alpha1.NSOList)
+	for _, obj := range objs {
+		nsoList.Items = append(nsoList.Items, *obj.(*orchestrationciscocomv1alpha1.NSO).DeepCopy())
+	}
+	return nil
+}
+
+// Wraps a controller index function into a namespaced client-go index function
+func namespacedIndexFunc(fn client.IndexerFunc) toolscache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		nso := obj.(*orchestrationciscocomv1alpha1.NSO)
+		values := fn(nso)
+		keys := make([]string, 0, len(values))
+		for _, value := range values {
+			keys = append(keys, nso.Namespace+"/"+value)
+		}
+		return keys, nil
+	}
+}
+
+func newBenchReconciler(b *testing.B, instances int) *NSOReconciler {
+	indexer := toolscache.NewIndexer(toolscache.MetaNamespaceKeyFunc, toolscache.Indexers{
+		toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc,
+		configMapRefIndexKey:      namespacedIndexFunc(indexNSOByConfigMapRefs),
+		secretRefIndexKey:         namespacedIndexFunc(indexNSOBySecretRefs),
+	})
+
+	for i := range instances {
+		nso := &orchestrationciscocomv1alpha1.NSO{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("nso-%d", i),
+				Namespace: benchNamespace,
+			},
+			Spec: orchestrationciscocomv1alpha1.NSOSpec{
+				Image:        "cisco-nso-prod:6.3.1",
+				ServiceName:  fmt.Sprintf("nso-%d", i),
+				Replicas:     1,
+				NsoConfigRef: fmt.Sprintf("nso-config-%d", i),
+				AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+					Username:          "admin",
+					PasswordSecretRef: fmt.Sprintf("nso-admin-%d", i),
+				},
+			},
+		}
+		if err := indexer.Add(nso); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return &NSOReconciler{Client: &cacheReader{indexer: indexer}}
+}
+
+// Mapping used before the field indexes were introduced: list every NSO in the
+// namespace and compare the references one by one.
+func (r *NSOReconciler) linearWatchForResourceChange(ctx context.Context, resource client.Object) []reconcile.Request {
+	nsoList := &orchestrationciscocomv1alpha1.NSOList{}
+	if err := r.List(ctx, nsoList, client.InNamespace(resource.GetNamespace())); err != nil {
+		return nil
+	}
+
+	_, isSecret := resource.(*corev1.Secret)
+	_, isConfigMap := resource.(*corev1.ConfigMap)
+
+	requests := make([]reconcile.Request, 0)
+	for _, nso := range nsoList.Items {
+		if (isSecret && nso.Spec.AdminCredentials.PasswordSecretRef == resource.GetName()) ||
+			(isConfigMap && nso.Spec.NsoConfigRef == resource.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: nso.Name, Namespace: nso.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+func BenchmarkWatchForResourceChange(b *testing.B) {
+	ctx := context.Background()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "nso-admin-42", Namespace: benchNamespace},
+	}
+	unrelatedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-token-abcde", Namespace: benchNamespace},
+	}
+
+	for _, instances := range []int{10, 100, 1000} {
+		r := newBenchReconciler(b, instances)
+
+		cases := []struct {
+			name    string
+			mapFunc func(context.Context, client.Object) []reconcile.Request
+			object  client.Object
+		}{
+			{"linear/referenced", r.linearWatchForResourceChange, secret},
+			{"indexed/referenced", r.watchForResourceChange, secret},
+			{"linear/unrelated", r.linearWatchForResourceChange, unrelatedSecret},
+			{"indexed/unrelated", r.watchForResourceChange, unrelatedSecret},
+		}
+		for _, c := range cases {
+			b.Run(fmt.Sprintf("%s/instances=%d", c.name, instances), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					c.mapFunc(ctx, c.object)
+				}
+			})
+		}
+	}
+}
@@ -18,17 +18,52 @@ package controller
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/imagepolicy"
+	nsoclient "github.com/carlosgrillet/nso-operator/internal/nso"
+	"github.com/carlosgrillet/nso-operator/internal/nso/nsotest"
+	"github.com/carlosgrillet/nso-operator/internal/podtemplate"
 )
 
 var _ = Describe("NSO Controller", func() {
@@ -89,6 +124,15 @@ var _ = Describe("NSO Controller", func() {
 
 			By("Cleanup the specific resource instance NSO")
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Releasing the NSO finalizer")
+			controllerReconciler := &NSOReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, resource))).To(BeTrue())
 		})
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
@@ -104,5 +148,1375 @@ var _ = Describe("NSO Controller", func() {
 			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
 			// Example: If you expect a certain status condition after reconciliation, verify it here.
 		})
+
+		It("should report missing dependencies by name", func() {
+			controllerReconciler := &NSOReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, nso)).To(Succeed())
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionDependenciesResolved)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonDependenciesMissing))
+			Expect(condition.Message).To(ContainSubstring("ConfigMap test-nso-config"))
+			Expect(condition.Message).To(ContainSubstring("Secret test-admin-secret"))
+		})
+
+		It("should roll the pods when a dependency changes", func() {
+			controllerReconciler := &NSOReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			reconcileUntilStable := func() {
+				Eventually(func() (bool, error) {
+					result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+						NamespacedName: typeNamespacedName,
+					})
+					return result.Requeue, err
+				}).Should(BeFalse())
+			}
+			podTemplateHash := func() string {
+				statefulSet := &appsv1.StatefulSet{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, statefulSet)).To(Succeed())
+				return statefulSet.Spec.Template.Annotations[dependenciesHashAnnotation]
+			}
+
+			By("creating the referenced ConfigMap and Secret")
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-nso-config", Namespace: "default"},
+				Data:       map[string]string{"ncs.conf": "<ncs-config/>"},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-admin-secret", Namespace: "default"},
+				StringData: map[string]string{"password": "admin"},
+			}
+			Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, configMap)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			})
+
+			reconcileUntilStable()
+			Expect(k8sClient.Get(ctx, typeNamespacedName, nso)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(nso.Status.Conditions,
+				orchestrationciscocomv1alpha1.ConditionDependenciesResolved)).To(BeTrue())
+			initialHash := podTemplateHash()
+			Expect(initialHash).NotTo(BeEmpty())
+
+			By("changing the admin password")
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "test-admin-secret", Namespace: "default"}, secret)).To(Succeed())
+			secret.StringData = map[string]string{"password": "changed"}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			reconcileUntilStable()
+			Expect(podTemplateHash()).NotTo(Equal(initialHash))
+		})
+	})
+
+	Context("When restricted to a set of namespaces", func() {
+		It("should ignore NSO instances outside the watched namespaces", func() {
+			// No client is configured: reaching the API would panic
+			controllerReconciler := &NSOReconciler{
+				WatchNamespaces: []string{"tenant-a", "tenant-b"},
+			}
+
+			result, err := controllerReconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "nso", Namespace: "default"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+		})
+
+		It("should watch every namespace when none is configured", func() {
+			controllerReconciler := &NSOReconciler{}
+			Expect(controllerReconciler.watchesNamespace("default")).To(BeTrue())
+
+			controllerReconciler.WatchNamespaces = []string{"tenant-a"}
+			Expect(controllerReconciler.watchesNamespace("tenant-a")).To(BeTrue())
+			Expect(controllerReconciler.watchesNamespace("default")).To(BeFalse())
+		})
+	})
+
+	Context("When filtering events", func() {
+		It("should drop NSO updates that only change the status", func() {
+			oldNSO := &orchestrationciscocomv1alpha1.NSO{ObjectMeta: metav1.ObjectMeta{Name: "nso", Generation: 1}}
+			newNSO := oldNSO.DeepCopy()
+			newNSO.Status.Conditions = []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue}}
+			Expect(nsoChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldNSO, ObjectNew: newNSO})).To(BeFalse())
+
+			By("keeping spec and annotation changes")
+			newNSO.Generation = 2
+			Expect(nsoChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldNSO, ObjectNew: newNSO})).To(BeTrue())
+			newNSO.Generation = 1
+			newNSO.Annotations = map[string]string{"example.com/annotation": "value"}
+			Expect(nsoChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldNSO, ObjectNew: newNSO})).To(BeTrue())
+		})
+
+		It("should only keep StatefulSet updates relevant to the NSO", func() {
+			oldStatefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "nso", Generation: 1}}
+			newStatefulSet := oldStatefulSet.DeepCopy()
+			newStatefulSet.ResourceVersion = "2"
+			newStatefulSet.Status.CollisionCount = ptr.To[int32](1)
+			Expect(statefulSetChangedPredicate().Update(event.UpdateEvent{
+				ObjectOld: oldStatefulSet, ObjectNew: newStatefulSet,
+			})).To(BeFalse())
+
+			newStatefulSet.Status.ReadyReplicas = 1
+			Expect(statefulSetChangedPredicate().Update(event.UpdateEvent{
+				ObjectOld: oldStatefulSet, ObjectNew: newStatefulSet,
+			})).To(BeTrue())
+		})
+
+		It("should only keep pod updates changing the readiness of the pod or which containers can not pull their image", func() {
+			oldPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "nso-0", ResourceVersion: "1"},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "ncs",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+				}}},
+			}
+			newPod := oldPod.DeepCopy()
+			newPod.ResourceVersion = "2"
+			newPod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}}
+			Expect(podChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})).To(BeFalse())
+
+			newPod.Status.ContainerStatuses[0].State.Waiting.Reason = "ErrImagePull"
+			Expect(podChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod})).To(BeTrue())
+
+			By("dropping the back-off retries of a failing container")
+			backOff := newPod.DeepCopy()
+			backOff.Status.ContainerStatuses[0].State.Waiting.Reason = "ImagePullBackOff"
+			Expect(podChangedPredicate().Update(event.UpdateEvent{ObjectOld: newPod, ObjectNew: backOff})).To(BeFalse())
+
+			By("keeping the changes of the Ready condition")
+			ready := oldPod.DeepCopy()
+			ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+			Expect(podChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: ready})).To(BeTrue())
+			Expect(podChangedPredicate().Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: oldPod})).To(BeTrue())
+			stillReady := ready.DeepCopy()
+			stillReady.Status.Conditions = append(stillReady.Status.Conditions, corev1.PodCondition{Type: corev1.ContainersReady, Status: corev1.ConditionTrue})
+			Expect(podChangedPredicate().Update(event.UpdateEvent{ObjectOld: ready, ObjectNew: stillReady})).To(BeFalse())
+		})
+
+		It("should only keep ConfigMap and Secret updates changing their data", func() {
+			oldSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "admin", ResourceVersion: "1"},
+				Data:       map[string][]byte{"password": []byte("admin")},
+			}
+			newSecret := oldSecret.DeepCopy()
+			newSecret.ResourceVersion = "2"
+			newSecret.Labels = map[string]string{"rotated": "false"}
+			Expect(dataChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldSecret, ObjectNew: newSecret})).To(BeFalse())
+
+			newSecret.Data["password"] = []byte("changed")
+			Expect(dataChangedPredicate().Update(event.UpdateEvent{ObjectOld: oldSecret, ObjectNew: newSecret})).To(BeTrue())
+		})
+	})
+
+	Context("When computing the NSO dependencies", func() {
+		It("should collect every ConfigMap and Secret referenced by the spec", func() {
+			optional := true
+			nso := &orchestrationciscocomv1alpha1.NSO{
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					NsoConfigRef: "ncs-config",
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						PasswordSecretRef: "admin-password",
+					},
+					Env: []corev1.EnvVar{{
+						Name: "FROM_CONFIGMAP",
+						ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "env-config"},
+							Key:                  "key",
+						}},
+					}, {
+						Name: "FROM_SECRET",
+						ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "optional-secret"},
+							Key:                  "key",
+							Optional:             &optional,
+						}},
+					}},
+					EnvFrom: []corev1.EnvFromSource{{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "env-secret"},
+						},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "secret-volume",
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+							SecretName: "admin-password",
+						}},
+					}, {
+						Name: "projected",
+						VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{{
+								ConfigMap: &corev1.ConfigMapProjection{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "projected-config"},
+								},
+							}, {
+								Secret: &corev1.SecretProjection{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "projected-secret"},
+								},
+							}},
+						}},
+					}},
+				},
+			}
+
+			Expect(dependenciesForNSO(nso)).To(Equal([]dependency{
+				{Kind: kindConfigMap, Name: "env-config"},
+				{Kind: kindConfigMap, Name: "ncs-config"},
+				{Kind: kindConfigMap, Name: "projected-config"},
+				{Kind: kindSecret, Name: "admin-password"},
+				{Kind: kindSecret, Name: "env-secret"},
+				{Kind: kindSecret, Name: "optional-secret", Optional: true},
+				{Kind: kindSecret, Name: "projected-secret"},
+			}))
+		})
+
+		It("should collect the references of the init containers and sidecars", func() {
+			nso := &orchestrationciscocomv1alpha1.NSO{
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					NsoConfigRef: "ncs-config",
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						PasswordSecretRef: "admin-password",
+					},
+					InitContainers: []corev1.Container{{
+						Name: "seed-cdb",
+						EnvFrom: []corev1.EnvFromSource{{
+							ConfigMapRef: &corev1.ConfigMapEnvSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "seed-config"},
+							},
+						}},
+					}},
+					Sidecars: []corev1.Container{{
+						Name: "log-shipper",
+						Env: []corev1.EnvVar{{
+							Name: "TOKEN",
+							ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "shipper-token"},
+								Key:                  "token",
+							}},
+						}},
+					}},
+				},
+			}
+
+			Expect(dependenciesForNSO(nso)).To(Equal([]dependency{
+				{Kind: kindConfigMap, Name: "ncs-config"},
+				{Kind: kindConfigMap, Name: "seed-config"},
+				{Kind: kindSecret, Name: "admin-password"},
+				{Kind: kindSecret, Name: "shipper-token"},
+			}))
+		})
+
+		It("should collect the references of the pod template override and image pull secrets", func() {
+			nso := &orchestrationciscocomv1alpha1.NSO{
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					NsoConfigRef: "ncs-config",
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						PasswordSecretRef: "admin-password",
+					},
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-credentials"}},
+					PodTemplate: &runtime.RawExtension{Raw: []byte(`{"spec": {
+						"imagePullSecrets": [{"name": "mirror-credentials"}],
+						"containers": [{"name": "ncs", "envFrom": [{"configMapRef": {"name": "tuning"}}]}],
+						"volumes": [{"name": "certificates", "secret": {"secretName": "nso-tls", "optional": true}}]
+					}}`)},
+				},
+			}
+
+			Expect(dependenciesForNSO(nso)).To(Equal([]dependency{
+				{Kind: kindConfigMap, Name: "ncs-config"},
+				{Kind: kindConfigMap, Name: "tuning"},
+				{Kind: kindSecret, Name: "admin-password"},
+				{Kind: kindSecret, Name: "mirror-credentials"},
+				{Kind: kindSecret, Name: "nso-tls", Optional: true},
+				{Kind: kindSecret, Name: "registry-credentials"},
+			}))
+		})
+
+		It("should treat a dependency as required when any reference requires it", func() {
+			optional := true
+			set := dependencySet{}
+			set.add(kindSecret, "shared", &optional)
+			set.add(kindSecret, "shared", nil)
+			set.add(kindSecret, "shared", &optional)
+
+			Expect(set.sorted()).To(Equal([]dependency{{Kind: kindSecret, Name: "shared"}}))
+		})
+	})
+
+	Context("When the NSO is paused", func() {
+		const resourceName = "paused-nso"
+
+		ctx := context.Background()
+		typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"}
+
+		BeforeEach(func() {
+			resource := &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+					Annotations: map[string]string{
+						orchestrationciscocomv1alpha1.PausedAnnotation: "true",
+					},
+				},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:         "test-nso:latest",
+					ServiceName:   "paused-nso-service",
+					Replicas:      1,
+					LabelSelector: map[string]string{"app": "paused-nso"},
+					Ports:         []corev1.ServicePort{{Name: "http", Port: 8080}},
+					NsoConfigRef:  "test-nso-config",
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						Username:          "admin",
+						PasswordSecretRef: "test-admin-secret",
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+				controllerReconciler := &NSOReconciler{
+					Client: k8sClient,
+					Scheme: k8sClient.Scheme(),
+				}
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		It("should not touch any object until the annotation is removed", func() {
+			controllerReconciler := &NSOReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			By("reconciling the paused NSO")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			nso := &orchestrationciscocomv1alpha1.NSO{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, nso)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPaused)).To(BeTrue())
+			Expect(nso.Finalizers).To(BeEmpty())
+			err = k8sClient.Get(ctx, typeNamespacedName, &appsv1.StatefulSet{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			By("removing the paused annotation")
+			delete(nso.Annotations, orchestrationciscocomv1alpha1.PausedAnnotation)
+			Expect(k8sClient.Update(ctx, nso)).To(Succeed())
+
+			Eventually(func() (bool, error) {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				return result.Requeue, err
+			}).Should(BeFalse())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, &appsv1.StatefulSet{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, nso)).To(Succeed())
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPaused)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonReconciliationResumed))
+			Expect(nso.Finalizers).To(ContainElement(nsoFinalizer))
+		})
+	})
+
+	Context("When labelling the objects", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-labels", Namespace: "default"}
+
+		It("should merge the recommended labels with the user labels without changing the selector", func() {
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso := &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:         "containers.cisco.com/cisco-nso/cisco-nso-prod:6.3.1",
+					ServiceName:   "nso-labels",
+					Replicas:      1,
+					LabelSelector: map[string]string{"app": "nso-labels"},
+					Ports:         []corev1.ServicePort{{Name: "http", Port: 8080}},
+					NsoConfigRef:  "nso-config",
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						Username:          "admin",
+						PasswordSecretRef: "nso-admin",
+					},
+					VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+						ObjectMeta: metav1.ObjectMeta{Name: "nso-run"},
+					}},
+					PodMetadata: &orchestrationciscocomv1alpha1.EmbeddedMetadata{
+						Labels:      map[string]string{"team": "network", "app": "overridden"},
+						Annotations: map[string]string{"prometheus.io/scrape": "true"},
+					},
+					ServiceMetadata: &orchestrationciscocomv1alpha1.EmbeddedMetadata{
+						Annotations: map[string]string{"external-dns.alpha.kubernetes.io/hostname": "nso.example.com"},
+					},
+					VolumeClaimMetadata: &orchestrationciscocomv1alpha1.EmbeddedMetadata{
+						Labels: map[string]string{"backup": "daily"},
+					},
+				},
+			}
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "nso-run-nso-labels-0", Namespace: key.Namespace},
+			}
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso, claim).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+				Build()
+			controllerReconciler := &NSOReconciler{Client: fakeClient, Scheme: testScheme}
+
+			Eventually(func() (bool, error) {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				return result.Requeue, err
+			}).Should(BeFalse())
+
+			standard := map[string]string{
+				"app.kubernetes.io/name":       "nso",
+				"app.kubernetes.io/instance":   "nso-labels",
+				"app.kubernetes.io/version":    "6.3.1",
+				"app.kubernetes.io/component":  "server",
+				"app.kubernetes.io/managed-by": "nso-operator",
+			}
+
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(fakeClient.Get(ctx, key, statefulSet)).To(Succeed())
+			Expect(statefulSet.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": "nso-labels"}))
+			for label, value := range standard {
+				Expect(statefulSet.Labels).To(HaveKeyWithValue(label, value))
+				Expect(statefulSet.Spec.Template.Labels).To(HaveKeyWithValue(label, value))
+			}
+			Expect(statefulSet.Spec.Template.Labels).To(HaveKeyWithValue("app", "nso-labels"))
+			Expect(statefulSet.Spec.Template.Labels).To(HaveKeyWithValue("team", "network"))
+			Expect(statefulSet.Spec.Template.Annotations).To(HaveKeyWithValue("prometheus.io/scrape", "true"))
+			Expect(statefulSet.Labels).NotTo(HaveKey("team"))
+			Expect(statefulSet.Spec.VolumeClaimTemplates[0].Labels).To(HaveKeyWithValue("backup", "daily"))
+			Expect(statefulSet.Spec.VolumeClaimTemplates[0].Labels).NotTo(HaveKey("app.kubernetes.io/version"))
+
+			service := &corev1.Service{}
+			Expect(fakeClient.Get(ctx, key, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(map[string]string{"app": "nso-labels"}))
+			Expect(service.Labels).To(HaveKeyWithValue("app.kubernetes.io/instance", "nso-labels"))
+			Expect(service.Annotations).To(HaveKeyWithValue("external-dns.alpha.kubernetes.io/hostname", "nso.example.com"))
+
+			By("propagating the claim labels to the existing claims")
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(claim), claim)).To(Succeed())
+			Expect(claim.Labels).To(HaveKeyWithValue("backup", "daily"))
+			Expect(claim.Labels).To(HaveKeyWithValue("app.kubernetes.io/managed-by", "nso-operator"))
+		})
+
+		DescribeTable("should derive the version label from the image tag",
+			func(image, version string) {
+				Expect(imageVersion(image)).To(Equal(version))
+			},
+			Entry("tagged image", "cisco-nso-prod:6.3.1", "6.3.1"),
+			Entry("registry with a port", "registry.local:5000/cisco-nso-prod:6.3.1", "6.3.1"),
+			Entry("untagged image with a registry port", "registry.local:5000/cisco-nso-prod", ""),
+			Entry("tag and digest", "cisco-nso-prod:6.3.1@sha256:0123456789abcdef", "6.3.1"),
+			Entry("digest only", "cisco-nso-prod@sha256:0123456789abcdef", ""),
+			Entry("tag longer than a label value", "nso:"+strings.Repeat("a", 70), strings.Repeat("a", 63)),
+		)
+	})
+
+	Context("When overriding the pod template", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-override", Namespace: "default"}
+
+		var (
+			testScheme *runtime.Scheme
+			nso        *orchestrationciscocomv1alpha1.NSO
+		)
+
+		BeforeEach(func() {
+			testScheme = runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso = &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Generation: 1},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:         "cisco-nso-prod:6.3.1",
+					ServiceName:   "nso-override",
+					Replicas:      1,
+					LabelSelector: map[string]string{"app": "nso-override"},
+					Ports:         []corev1.ServicePort{{Name: "http", Port: 8080}},
+					NsoConfigRef:  "nso-config",
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						Username:          "admin",
+						PasswordSecretRef: "nso-admin",
+					},
+				},
+			}
+		})
+
+		reconcileNSO := func(fakeClient client.Client) {
+			controllerReconciler := &NSOReconciler{Client: fakeClient, Scheme: testScheme}
+			Eventually(func() (bool, error) {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				return result.Requeue, err
+			}).Should(BeFalse())
+		}
+
+		It("should merge the override over the generated pod template", func() {
+			nso.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"spec":{` +
+				`"hostAliases":[{"ip":"10.0.0.1","hostnames":["nso.lab"]}],` +
+				`"containers":[` +
+				`{"name":"ncs","resources":{"limits":{"memory":"4Gi"}}},` +
+				`{"name":"log-shipper","image":"fluent-bit:3.0"}]}}`)}
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+				Build()
+			reconcileNSO(fakeClient)
+
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(fakeClient.Get(ctx, key, statefulSet)).To(Succeed())
+			podSpec := statefulSet.Spec.Template.Spec
+			Expect(podSpec.HostAliases).To(HaveLen(1))
+			Expect(podSpec.Containers).To(HaveLen(2))
+			Expect(podSpec.Containers[0].Name).To(Equal("ncs"))
+			Expect(podSpec.Containers[0].Image).To(Equal("cisco-nso-prod:6.3.1"))
+			Expect(podSpec.Containers[0].Env).NotTo(BeEmpty())
+			Expect(podSpec.Containers[0].Resources.Limits.Memory().String()).To(Equal("4Gi"))
+			Expect(podSpec.Containers[1].Name).To(Equal("log-shipper"))
+			Expect(statefulSet.Spec.Template.Annotations).To(HaveKey(dependenciesHashAnnotation))
+
+			Expect(fakeClient.Get(ctx, key, nso)).To(Succeed())
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPodTemplateApplied)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should not create the StatefulSet when the override drops a selector label", func() {
+			nso.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"app":null}}}`)}
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+				Build()
+			reconcileNSO(fakeClient)
+
+			Expect(errors.IsNotFound(fakeClient.Get(ctx, key, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(fakeClient.Get(ctx, key, nso)).To(Succeed())
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPodTemplateApplied)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonInvalidPodTemplate))
+			Expect(condition.Message).To(ContainSubstring("can not change the label app=nso-override"))
+		})
+
+		It("should not create the StatefulSet when the override changes the managed-by label", func() {
+			nso.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"app.kubernetes.io/managed-by":"helm"}}}`)}
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+				Build()
+			reconcileNSO(fakeClient)
+
+			Expect(errors.IsNotFound(fakeClient.Get(ctx, key, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(fakeClient.Get(ctx, key, nso)).To(Succeed())
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPodTemplateApplied)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Message).To(Equal("podTemplate can not change the label app.kubernetes.io/managed-by=nso-operator"))
+		})
+
+		It("should protect the pinned image of the ncs container", func() {
+			template := &corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: objectLabels(nso)},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:  nsoContainerName,
+					Image: "cisco-nso-prod:6.3.1@sha256:" + strings.Repeat("0", 64),
+				}}},
+			}
+			labels := map[string]string{"app": "nso-override", instanceLabel: "nso-override", managedByLabel: managedByValue}
+			Expect(protectedPodTemplate(nso, template)).To(Equal(podtemplate.Protected{Labels: labels, Container: "ncs"}))
+
+			nso.Spec.PinImageDigest = true
+			Expect(protectedPodTemplate(nso, template).Image).To(Equal(template.Spec.Containers[0].Image))
+		})
+	})
+
+	Context("When shutting NSO down", func() {
+		It("should drain the commit queue before stopping NSO within the grace period", func() {
+			nso := &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: "nso-shutdown", Namespace: "default"},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:                         "cisco-nso-prod:6.3.1",
+					ServiceName:                   "nso-shutdown",
+					Replicas:                      1,
+					LabelSelector:                 map[string]string{"app": "nso-shutdown"},
+					NsoConfigRef:                  "nso-config",
+					TerminationGracePeriodSeconds: ptr.To(int64(300)),
+					CommitQueueDrainTimeout:       metav1.Duration{Duration: 4 * time.Minute},
+				},
+			}
+			controllerReconciler := &NSOReconciler{Scheme: clientgoscheme.Scheme}
+			podSpec := controllerReconciler.statefulSetForNSO(nso, context.Background()).Spec.Template.Spec
+
+			Expect(podSpec.TerminationGracePeriodSeconds).To(HaveValue(Equal(int64(300))))
+			preStop := podSpec.Containers[0].Lifecycle.PreStop
+			Expect(preStop.Exec.Command).To(Equal([]string{"sh", "-c", preStopScript, "pre-stop", "240"}))
+			Expect(preStopScript).To(ContainSubstring("high-availability read-only mode true"))
+			Expect(preStopScript).To(HaveSuffix("ncs --stop"))
+		})
+	})
+
+	Context("When adding init containers and sidecars", func() {
+		nso := &orchestrationciscocomv1alpha1.NSO{
+			ObjectMeta: metav1.ObjectMeta{Name: "nso-sidecars", Namespace: "default"},
+			Spec: orchestrationciscocomv1alpha1.NSOSpec{
+				Image:          "cisco-nso-prod:6.3.1",
+				ServiceName:    "nso-sidecars",
+				Replicas:       1,
+				LabelSelector:  map[string]string{"app": "nso-sidecars"},
+				NsoConfigRef:   "nso-config",
+				InitContainers: []corev1.Container{{Name: "seed-cdb", Image: "busybox"}},
+				Sidecars:       []corev1.Container{{Name: "log-shipper", Image: "fluent-bit:3.0"}},
+			},
+		}
+
+		It("should run the sidecars as native sidecars after the init containers", func() {
+			controllerReconciler := &NSOReconciler{Scheme: clientgoscheme.Scheme, NativeSidecars: true}
+			podSpec := controllerReconciler.statefulSetForNSO(nso, context.Background()).Spec.Template.Spec
+
+			Expect(podSpec.Containers).To(HaveLen(1))
+			Expect(podSpec.InitContainers).To(HaveLen(2))
+			Expect(podSpec.InitContainers[0].Name).To(Equal("seed-cdb"))
+			Expect(podSpec.InitContainers[0].RestartPolicy).To(BeNil())
+			Expect(podSpec.InitContainers[1].Name).To(Equal("log-shipper"))
+			Expect(podSpec.InitContainers[1].RestartPolicy).To(HaveValue(Equal(corev1.ContainerRestartPolicyAlways)))
+			Expect(nso.Spec.Sidecars[0].RestartPolicy).To(BeNil())
+		})
+
+		It("should run the sidecars as regular containers on older clusters", func() {
+			controllerReconciler := &NSOReconciler{Scheme: clientgoscheme.Scheme}
+			podSpec := controllerReconciler.statefulSetForNSO(nso, context.Background()).Spec.Template.Spec
+
+			Expect(podSpec.InitContainers).To(HaveLen(1))
+			Expect(podSpec.Containers).To(HaveLen(2))
+			Expect(podSpec.Containers[0].Name).To(Equal(nsoContainerName))
+			Expect(podSpec.Containers[1].Name).To(Equal("log-shipper"))
+			Expect(podSpec.Containers[1].RestartPolicy).To(BeNil())
+		})
+	})
+
+	Context("When loading package bundles", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-bundles", Namespace: "default"}
+
+		// Returns a PackageBundle of the target whose download completed
+		downloadedBundle := func(name, target, storagePath string, packages ...string) *orchestrationciscocomv1alpha1.PackageBundle {
+			return &orchestrationciscocomv1alpha1.PackageBundle{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: key.Namespace},
+				Spec: orchestrationciscocomv1alpha1.PackageBundleSpec{
+					TargetName: target,
+					Origin:     orchestrationciscocomv1alpha1.OriginSCM,
+					Source:     orchestrationciscocomv1alpha1.PackageSource{URL: "https://git.example.com/nso/" + name + ".git"},
+				},
+				Status: orchestrationciscocomv1alpha1.PackageBundleStatus{
+					Phase:       orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded,
+					StoragePath: storagePath,
+					Packages:    packages,
+				},
+			}
+		}
+
+		It("should mount the downloaded packages into the NSO packages directory", func() {
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso := &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:         "cisco-nso-prod:6.3.1",
+					ServiceName:   "nso-bundles",
+					Replicas:      1,
+					LabelSelector: map[string]string{"app": "nso-bundles"},
+					NsoConfigRef:  "nso-config",
+				},
+			}
+			pending := downloadedBundle("mpls", key.Name, "")
+			pending.Status = orchestrationciscocomv1alpha1.PackageBundleStatus{Phase: orchestrationciscocomv1alpha1.PackageBundlePhaseDownloading}
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso,
+					downloadedBundle("services", key.Name, "4f1c9e2a7b", "l3vpn", "qos"),
+					downloadedBundle("neds", key.Name, "0d8e6b3f21", "cisco-ios-cli-6.85", "l3vpn"),
+					downloadedBundle("other", "nso-lab", "9a7e5c3b1d", "lab-tools"),
+					pending).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}, &orchestrationciscocomv1alpha1.PackageBundle{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			controllerReconciler := &NSOReconciler{Client: fakeClient, Scheme: testScheme, Recorder: recorder}
+
+			Eventually(func() (bool, error) {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				return result.Requeue, err
+			}).Should(BeFalse())
+
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(fakeClient.Get(ctx, key, statefulSet)).To(Succeed())
+			podSpec := statefulSet.Spec.Template.Spec
+			Expect(podSpec.Volumes).To(ContainElements(
+				corev1.Volume{Name: "packages-0", VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "neds-packages", ReadOnly: true},
+				}},
+				corev1.Volume{Name: "packages-1", VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "services-packages", ReadOnly: true},
+				}},
+			))
+			Expect(podSpec.Volumes).To(HaveLen(3))
+			Expect(podSpec.Containers[0].VolumeMounts[1:]).To(Equal([]corev1.VolumeMount{
+				{Name: "packages-0", MountPath: "/nso/run/packages/cisco-ios-cli-6.85", SubPath: "0d8e6b3f21/cisco-ios-cli-6.85", ReadOnly: true},
+				{Name: "packages-0", MountPath: "/nso/run/packages/l3vpn", SubPath: "0d8e6b3f21/l3vpn", ReadOnly: true},
+				{Name: "packages-1", MountPath: "/nso/run/packages/qos", SubPath: "4f1c9e2a7b/qos", ReadOnly: true},
+			}))
+			Expect(recorder.Events).To(Receive(Equal("Warning DuplicatePackage Package l3vpn of PackageBundle services " +
+				"is ignored, it is already loaded from PackageBundle neds")))
+		})
+	})
+
+	Context("When pulling the NSO images", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-private", Namespace: "default"}
+
+		var (
+			nso                  *orchestrationciscocomv1alpha1.NSO
+			fakeClient           client.Client
+			controllerReconciler *NSOReconciler
+		)
+
+		newPod := func(name, reason string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: key.Namespace,
+					Labels:    map[string]string{"app": "nso-private", instanceLabel: key.Name, managedByLabel: managedByValue},
+				},
+				Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+					Name: nsoContainerName,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+						Reason:  reason,
+						Message: "Back-off pulling image \"registry.example.com/nso:6.3.1\"",
+					}},
+				}}},
+			}
+		}
+
+		BeforeEach(func() {
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso = &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:            "registry.example.com/nso:6.3.1",
+					ServiceName:      "nso-private",
+					Replicas:         2,
+					LabelSelector:    map[string]string{"app": "nso-private"},
+					NsoConfigRef:     "nso-config",
+					ImagePullPolicy:  corev1.PullAlways,
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-credentials"}},
+					EnvFrom: []corev1.EnvFromSource{{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "nso-env"},
+						},
+					}},
+				},
+			}
+			fakeClient = fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso, newPod("nso-private-0", "ImagePullBackOff"), newPod("nso-private-1", "ContainerCreating")).
+				Build()
+			controllerReconciler = &NSOReconciler{Client: fakeClient, Scheme: testScheme}
+		})
+
+		It("should pass the pull settings and envFrom to the NSO container", func() {
+			podSpec := controllerReconciler.statefulSetForNSO(nso, ctx).Spec.Template.Spec
+			Expect(podSpec.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "registry-credentials"}}))
+			Expect(podSpec.Containers[0].ImagePullPolicy).To(Equal(corev1.PullAlways))
+			Expect(podSpec.Containers[0].EnvFrom).To(Equal(nso.Spec.EnvFrom))
+		})
+
+		It("should report the pods failing to pull their image", func() {
+			Expect(controllerReconciler.checkImagePulls(ctx, nso)).To(Succeed())
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagesPulled)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonImagePullBackOff))
+			Expect(condition.Message).To(ContainSubstring(`pod nso-private-0 container ncs: Back-off pulling image "registry.example.com/nso:6.3.1"`))
+			Expect(condition.Message).NotTo(ContainSubstring("nso-private-1"))
+
+			By("ignoring the pods of another NSO matching the same selector")
+			otherPod := newPod("nso-other-0", "ErrImagePull")
+			otherPod.Labels[instanceLabel] = "nso-other"
+			Expect(fakeClient.Create(ctx, otherPod)).To(Succeed())
+			Expect(controllerReconciler.checkImagePulls(ctx, nso)).To(Succeed())
+			condition = meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagesPulled)
+			Expect(condition.Message).NotTo(ContainSubstring("nso-other-0"))
+
+			By("clearing the condition once the image is pulled")
+			Expect(fakeClient.Delete(ctx, newPod("nso-private-0", ""))).To(Succeed())
+			Expect(controllerReconciler.checkImagePulls(ctx, nso)).To(Succeed())
+			condition = meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagesPulled)
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should map the NSO pods to their NSO", func() {
+			Expect(controllerReconciler.watchForPodChange(ctx, newPod("nso-private-0", ""))).To(Equal([]reconcile.Request{
+				{NamespacedName: key},
+			}))
+			Expect(controllerReconciler.watchForPodChange(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: key.Namespace, Labels: map[string]string{instanceLabel: key.Name}},
+			})).To(BeEmpty())
+		})
+	})
+
+	Context("When pinning the image digest", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-pinned", Namespace: "default"}
+
+		var (
+			image                string
+			nso                  *orchestrationciscocomv1alpha1.NSO
+			fakeClient           client.Client
+			controllerReconciler *NSOReconciler
+		)
+
+		// Pushes a new image under the tag, as a retag would
+		pushImage := func() string {
+			randomImage, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(image)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref, randomImage)).To(Succeed())
+			digest, err := randomImage.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			return digest.String()
+		}
+
+		reconcileNSO := func() ctrl.Result {
+			var result ctrl.Result
+			Eventually(func() (bool, error) {
+				var err error
+				result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				return result.Requeue, err
+			}).Should(BeFalse())
+			Expect(fakeClient.Get(ctx, key, nso)).To(Succeed())
+			return result
+		}
+
+		runningImage := func() string {
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(fakeClient.Get(ctx, key, statefulSet)).To(Succeed())
+			return statefulSet.Spec.Template.Spec.Containers[0].Image
+		}
+
+		BeforeEach(func() {
+			server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+			DeferCleanup(server.Close)
+			image = strings.TrimPrefix(server.URL, "http://") + "/cisco-nso-prod:6.3.1"
+
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso = &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Generation: 1},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:          image,
+					PinImageDigest: true,
+					ServiceName:    "nso-pinned",
+					Replicas:       1,
+					LabelSelector:  map[string]string{"app": "nso-pinned"},
+					NsoConfigRef:   "nso-config",
+				},
+			}
+			fakeClient = fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+				Build()
+			controllerReconciler = &NSOReconciler{Client: fakeClient, Scheme: testScheme}
+		})
+
+		It("should keep the pinned digest until asked to resolve it again", func() {
+			digest := pushImage()
+			reconcileNSO()
+			Expect(runningImage()).To(Equal(image + "@" + digest))
+			Expect(nso.Status.ImageDigest).To(Equal(digest))
+			Expect(nso.Status.PinnedImage).To(Equal(image))
+			Expect(meta.IsStatusConditionTrue(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagePinned)).To(BeTrue())
+
+			By("ignoring a retag of the image")
+			retagged := pushImage()
+			reconcileNSO()
+			Expect(runningImage()).To(Equal(image + "@" + digest))
+
+			By("resolving the tag again on demand")
+			nso.Annotations = map[string]string{orchestrationciscocomv1alpha1.ResolveImageAnnotation: "2025-06-01T00:00:00Z"}
+			Expect(fakeClient.Update(ctx, nso)).To(Succeed())
+			reconcileNSO()
+			Expect(runningImage()).To(Equal(image + "@" + retagged))
+			Expect(nso.Status.ImageDigest).To(Equal(retagged))
+			Expect(nso.Annotations).NotTo(HaveKey(orchestrationciscocomv1alpha1.ResolveImageAnnotation))
+
+			By("running the tag once pinning is turned off")
+			nso.Spec.PinImageDigest = false
+			Expect(fakeClient.Update(ctx, nso)).To(Succeed())
+			reconcileNSO()
+			Expect(runningImage()).To(Equal(image))
+			Expect(nso.Status.ImageDigest).To(BeEmpty())
+			Expect(meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagePinned)).To(BeNil())
+		})
+
+		It("should not create the StatefulSet until the image is resolved", func() {
+			result := reconcileNSO()
+			Expect(result.RequeueAfter).To(Equal(imageResolveRetryInterval))
+			Expect(errors.IsNotFound(fakeClient.Get(ctx, key, &appsv1.StatefulSet{}))).To(BeTrue())
+
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagePinned)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonResolutionFailed))
+
+			By("creating it once the image is pushed")
+			digest := pushImage()
+			reconcileNSO()
+			Expect(runningImage()).To(Equal(image + "@" + digest))
+		})
+	})
+
+	Context("When enforcing the image policy", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-policy", Namespace: "default"}
+
+		var (
+			host                 string
+			nso                  *orchestrationciscocomv1alpha1.NSO
+			fakeClient           client.Client
+			controllerReconciler *NSOReconciler
+		)
+
+		reconcileNSO := func() ctrl.Result {
+			var result ctrl.Result
+			Eventually(func() (bool, error) {
+				var err error
+				result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				return result.Requeue, err
+			}).Should(BeFalse())
+			Expect(fakeClient.Get(ctx, key, nso)).To(Succeed())
+			return result
+		}
+
+		imageAllowed := func() *metav1.Condition {
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImageAllowed)
+			Expect(condition).NotTo(BeNil())
+			return condition
+		}
+
+		BeforeEach(func() {
+			server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+			DeferCleanup(server.Close)
+			host = strings.TrimPrefix(server.URL, "http://")
+
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso = &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, Generation: 1},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:         "cisco-nso-prod:6.3.1",
+					ServiceName:   "nso-policy",
+					Replicas:      1,
+					LabelSelector: map[string]string{"app": "nso-policy"},
+					NsoConfigRef:  "nso-config",
+				},
+			}
+			fakeClient = fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(nso).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}).
+				Build()
+			controllerReconciler = &NSOReconciler{Client: fakeClient, Scheme: testScheme}
+		})
+
+		It("should not run images from other registries", func() {
+			policy, err := imagepolicy.Parse([]byte("allowedRegistries:\n- " + host + "/cisco\n"))
+			Expect(err).NotTo(HaveOccurred())
+			controllerReconciler.ImagePolicy = policy
+
+			reconcileNSO()
+			Expect(errors.IsNotFound(fakeClient.Get(ctx, key, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(imageAllowed().Status).To(Equal(metav1.ConditionFalse))
+			Expect(imageAllowed().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonPolicyViolation))
+			Expect(imageAllowed().Message).To(ContainSubstring("image cisco-nso-prod:6.3.1 violates the allowedRegistries image policy"))
+
+			By("checking the containers added by the podTemplate override")
+			nso.Spec.Image = host + "/cisco/cisco-nso-prod:6.3.1"
+			nso.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(
+				`{"spec":{"containers":[{"name":"exporter","image":"quay.io/prometheus/node-exporter"}]}}`)}
+			Expect(fakeClient.Update(ctx, nso)).To(Succeed())
+			reconcileNSO()
+			Expect(errors.IsNotFound(fakeClient.Get(ctx, key, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(imageAllowed().Message).To(ContainSubstring("image quay.io/prometheus/node-exporter violates the allowedRegistries image policy"))
+
+			By("running the images once they all come from the allowed registries")
+			nso.Spec.PodTemplate = nil
+			Expect(fakeClient.Update(ctx, nso)).To(Succeed())
+			reconcileNSO()
+			Expect(fakeClient.Get(ctx, key, &appsv1.StatefulSet{})).To(Succeed())
+			Expect(imageAllowed().Status).To(Equal(metav1.ConditionTrue))
+			Expect(imageAllowed().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonPolicySatisfied))
+		})
+
+		It("should only run the verified digest of a signed NSO image", func() {
+			signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+			policy, err := imagepolicy.Parse([]byte(fmt.Sprintf("requireSignature: true\npublicKeys:\n- %q\n",
+				pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))))
+			Expect(err).NotTo(HaveOccurred())
+			controllerReconciler.ImagePolicy = policy
+
+			ref, err := name.ParseReference(host + "/cisco-nso-prod:6.3.1")
+			Expect(err).NotTo(HaveOccurred())
+			randomImage, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref, randomImage)).To(Succeed())
+			hash, err := randomImage.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			digest := hash.String()
+
+			nso.Spec.Image = ref.String()
+			Expect(fakeClient.Update(ctx, nso)).To(Succeed())
+			result := reconcileNSO()
+			Expect(result.RequeueAfter).To(Equal(imageResolveRetryInterval))
+			Expect(errors.IsNotFound(fakeClient.Get(ctx, key, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(imageAllowed().Status).To(Equal(metav1.ConditionFalse))
+			Expect(imageAllowed().Message).To(ContainSubstring("violates the requireSignature image policy: no signature found"))
+
+			By("running the image pinned to its digest once signed")
+			payload := []byte(`{"critical":{"identity":{"docker-reference":"` + ref.Context().Name() + `"},` +
+				`"image":{"docker-manifest-digest":"` + digest + `"},"type":"cosign container image signature"},"optional":null}`)
+			payloadHash := sha256.Sum256(payload)
+			signature, err := ecdsa.SignASN1(rand.Reader, signingKey, payloadHash[:])
+			Expect(err).NotTo(HaveOccurred())
+			signatures, err := mutate.Append(empty.Image, mutate.Addendum{
+				Layer:       static.NewLayer(payload, "application/vnd.dev.cosign.simplesigning.v1+json"),
+				Annotations: map[string]string{imagepolicy.SignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref.Context().Tag(imagepolicy.SignatureTag(digest)), signatures)).To(Succeed())
+
+			reconcileNSO()
+			statefulSet := &appsv1.StatefulSet{}
+			Expect(fakeClient.Get(ctx, key, statefulSet)).To(Succeed())
+			Expect(statefulSet.Spec.Template.Spec.Containers[0].Image).To(Equal(ref.String() + "@" + digest))
+			Expect(imageAllowed().Status).To(Equal(metav1.ConditionTrue))
+			Expect(meta.IsStatusConditionTrue(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagePinned)).To(BeTrue())
+
+			By("verifying the pinned digest again after a restart of the operator")
+			controllerReconciler = &NSOReconciler{Client: fakeClient, Scheme: controllerReconciler.Scheme, ImagePolicy: policy}
+			reconcileNSO()
+			Expect(nso.Status.ImageDigest).To(Equal(digest))
+			Expect(controllerReconciler.isImageVerified(ref.String() + "@" + digest)).To(BeTrue())
+		})
+	})
+
+	Context("When mapping ConfigMap and Secret events", func() {
+		ctx := context.Background()
+
+		newNSO := func(name, configMap, secret string) *orchestrationciscocomv1alpha1.NSO {
+			return &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					NsoConfigRef: configMap,
+					AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+						Username:          "admin",
+						PasswordSecretRef: secret,
+					},
+				},
+			}
+		}
+
+		var controllerReconciler *NSOReconciler
+
+		BeforeEach(func() {
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(
+					newNSO("nso-a", "shared-config", "admin-a"),
+					newNSO("nso-b", "shared-config", "admin-b"),
+					newNSO("nso-c", "other-config", "admin-a"),
+				).
+				WithIndex(&orchestrationciscocomv1alpha1.NSO{}, configMapRefIndexKey, indexNSOByConfigMapRefs).
+				WithIndex(&orchestrationciscocomv1alpha1.NSO{}, secretRefIndexKey, indexNSOBySecretRefs).
+				Build()
+
+			controllerReconciler = &NSOReconciler{
+				Client: fakeClient,
+				Scheme: testScheme,
+			}
+		})
+
+		It("should only enqueue the NSO instances referencing a ConfigMap", func() {
+			configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "shared-config", Namespace: "default"}}
+
+			requests := controllerReconciler.watchForResourceChange(ctx, configMap)
+			Expect(requests).To(ConsistOf(
+				reconcile.Request{NamespacedName: types.NamespacedName{Name: "nso-a", Namespace: "default"}},
+				reconcile.Request{NamespacedName: types.NamespacedName{Name: "nso-b", Namespace: "default"}},
+			))
+		})
+
+		It("should only enqueue the NSO instances referencing a Secret", func() {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "admin-a", Namespace: "default"}}
+
+			requests := controllerReconciler.watchForResourceChange(ctx, secret)
+			Expect(requests).To(ConsistOf(
+				reconcile.Request{NamespacedName: types.NamespacedName{Name: "nso-a", Namespace: "default"}},
+				reconcile.Request{NamespacedName: types.NamespacedName{Name: "nso-c", Namespace: "default"}},
+			))
+		})
+
+		It("should not enqueue anything for unreferenced objects or other namespaces", func() {
+			unrelated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "default-token-abcde", Namespace: "default"}}
+			Expect(controllerReconciler.watchForResourceChange(ctx, unrelated)).To(BeEmpty())
+
+			otherNamespace := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "shared-config", Namespace: "other"}}
+			Expect(controllerReconciler.watchForResourceChange(ctx, otherNamespace)).To(BeEmpty())
+		})
+	})
+
+	Context("When polling the NSO replicas", func() {
+		ctx := context.Background()
+		key := types.NamespacedName{Name: "nso-poll", Namespace: "default"}
+
+		var (
+			nso                  *orchestrationciscocomv1alpha1.NSO
+			fakeClient           client.Client
+			recorder             *record.FakeRecorder
+			servers              map[string]*nsotest.Server
+			controllerReconciler *NSOReconciler
+		)
+
+		reconcileNSO := func() ctrl.Result {
+			var result ctrl.Result
+			Eventually(func() (bool, error) {
+				var err error
+				result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+				return result.Requeue, err
+			}).Should(BeFalse())
+			Expect(fakeClient.Get(ctx, key, nso)).To(Succeed())
+			return result
+		}
+
+		packagesHealthy := func() *metav1.Condition {
+			condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPackagesHealthy)
+			Expect(condition).NotTo(BeNil())
+			return condition
+		}
+
+		// Moves the last poll back so that the next reconcile polls again
+		expirePoll := func() {
+			nso.Status.LastPollTime = &metav1.Time{Time: nso.Status.LastPollTime.Add(-time.Hour)}
+			Expect(fakeClient.Status().Update(ctx, nso)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+			nso = &orchestrationciscocomv1alpha1.NSO{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Spec: orchestrationciscocomv1alpha1.NSOSpec{
+					Image:         "cisco-nso-prod:6.3.1",
+					ServiceName:   "nso-poll",
+					Replicas:      2,
+					LabelSelector: map[string]string{"app": "nso-poll"},
+					NsoConfigRef:  "nso-config",
+					Monitoring: &orchestrationciscocomv1alpha1.MonitoringSpec{
+						PollInterval: metav1.Duration{Duration: 5 * time.Minute},
+					},
+				},
+			}
+			objects := []client.Object{nso}
+			servers = map[string]*nsotest.Server{}
+			for ordinal := range 2 {
+				name := fmt.Sprintf("%s-%d", key.Name, ordinal)
+				servers[name] = nsotest.NewServer()
+				DeferCleanup(servers[name].Close)
+				objects = append(objects, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: key.Namespace},
+					Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+				})
+			}
+			fakeClient = fake.NewClientBuilder().
+				WithScheme(testScheme).
+				WithObjects(objects...).
+				WithStatusSubresource(&orchestrationciscocomv1alpha1.NSO{}, &corev1.Pod{}).
+				Build()
+
+			recorder = record.NewFakeRecorder(10)
+			controllerReconciler = &NSOReconciler{
+				Client:   fakeClient,
+				Scheme:   testScheme,
+				Recorder: recorder,
+				NSOClient: func(_ context.Context, _ *orchestrationciscocomv1alpha1.NSO, pod string) (*nsoclient.Client, error) {
+					return nsoclient.New(nsoclient.Options{
+						URL:      servers[pod].RESTCONFURL(),
+						Username: nsotest.Username,
+						Password: nsotest.Password,
+					})
+				},
+			}
+		})
+
+		It("should record the NSO version and packages of every replica", func() {
+			for _, server := range servers {
+				server.SetPackages(
+					nsotest.Package{Name: "cisco-ios-cli-6.85", Version: "6.85.3", OperStatus: "up"},
+					nsotest.Package{Name: "l3vpn", Version: "1.0", OperStatus: "up"},
+				)
+			}
+			servers["nso-poll-1"].SetVersion("6.4.2")
+
+			result := reconcileNSO()
+			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+			Expect(nso.Status.LastPollTime).NotTo(BeNil())
+			Expect(nso.Status.ReplicaStatuses).To(HaveLen(2))
+			Expect(nso.Status.ReplicaStatuses[0].Pod).To(Equal("nso-poll-0"))
+			Expect(nso.Status.ReplicaStatuses[0].Version).To(Equal("6.3.1"))
+			Expect(nso.Status.ReplicaStatuses[1].Version).To(Equal("6.4.2"))
+			Expect(nso.Status.ReplicaStatuses[1].Packages).To(Equal([]orchestrationciscocomv1alpha1.PackageStatus{
+				{Name: "cisco-ios-cli-6.85", Version: "6.85.3", OperStatus: "up"},
+				{Name: "l3vpn", Version: "1.0", OperStatus: "up"},
+			}))
+			Expect(packagesHealthy().Status).To(Equal(metav1.ConditionTrue))
+			Expect(packagesHealthy().Message).To(Equal("All packages are up on the 2 replicas"))
+
+			By("not polling again before the poll interval")
+			requests := len(servers["nso-poll-0"].Requests())
+			result = reconcileNSO()
+			Expect(result.RequeueAfter).To(BeNumerically("<=", 5*time.Minute))
+			Expect(servers["nso-poll-0"].Requests()).To(HaveLen(requests))
+
+			By("reporting the packages that stop being up")
+			servers["nso-poll-1"].SetPackages(
+				nsotest.Package{Name: "cisco-ios-cli-6.85", Version: "6.85.3", OperStatus: "up"},
+				nsotest.Package{Name: "l3vpn", Version: "1.1", OperStatus: "java-uninitialized", ErrorInfo: "ClassNotFoundException"},
+			)
+			expirePoll()
+			reconcileNSO()
+			Expect(packagesHealthy().Status).To(Equal(metav1.ConditionFalse))
+			Expect(packagesHealthy().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonPackagesNotUp))
+			Expect(packagesHealthy().Message).To(Equal("Packages not up: l3vpn on pod nso-poll-1 (java-uninitialized)"))
+			Expect(nso.Status.ReplicaStatuses[1].Packages[1].ErrorInfo).To(Equal("ClassNotFoundException"))
+			Expect(recorder.Events).To(Receive(Equal("Warning PackagesNotUp Packages not up: l3vpn on pod nso-poll-1 (java-uninitialized)")))
+
+			By("recording the Event only once")
+			expirePoll()
+			reconcileNSO()
+			Expect(packagesHealthy().Status).To(Equal(metav1.ConditionFalse))
+			Expect(recorder.Events).NotTo(Receive())
+		})
+
+		It("should report the replicas that can not be polled", func() {
+			pod := &corev1.Pod{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "nso-poll-0", Namespace: key.Namespace}, pod)).To(Succeed())
+			pod.Status.Conditions = nil
+			Expect(fakeClient.Status().Update(ctx, pod)).To(Succeed())
+			servers["nso-poll-1"].SetUnavailable(true)
+
+			reconcileNSO()
+			Expect(nso.Status.ReplicaStatuses[0].Error).To(Equal("pod not ready"))
+			Expect(nso.Status.ReplicaStatuses[1].Error).To(ContainSubstring("status 503"))
+			Expect(packagesHealthy().Status).To(Equal(metav1.ConditionUnknown))
+			Expect(packagesHealthy().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonPollFailed))
+			Expect(packagesHealthy().Message).To(HavePrefix("Failed to poll the replicas: pod nso-poll-0: pod not ready; pod nso-poll-1: "))
+			Expect(servers["nso-poll-0"].Requests()).To(BeEmpty())
+
+			By("clearing the report when the polling is disabled")
+			nso.Spec.Monitoring.Disabled = true
+			Expect(fakeClient.Update(ctx, nso)).To(Succeed())
+			reconcileNSO()
+			Expect(nso.Status.ReplicaStatuses).To(BeEmpty())
+			Expect(nso.Status.LastPollTime).To(BeNil())
+			Expect(meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPackagesHealthy)).To(BeNil())
+		})
+
+		It("should poll the replicas concurrently", func() {
+			// Each replica only answers once every replica is being polled
+			var started sync.WaitGroup
+			started.Add(2)
+			allStarted := make(chan struct{})
+			go func() {
+				started.Wait()
+				close(allStarted)
+			}()
+			newClient := controllerReconciler.NSOClient
+			controllerReconciler.NSOClient = func(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, pod string) (*nsoclient.Client, error) {
+				started.Done()
+				select {
+				case <-allStarted:
+					return newClient(ctx, nso, pod)
+				case <-time.After(5 * time.Second):
+					return nil, fmt.Errorf("the replicas are polled one at a time")
+				}
+			}
+
+			reconcileNSO()
+			Expect(nso.Status.ReplicaStatuses).To(HaveLen(2))
+			Expect(nso.Status.ReplicaStatuses[0].Error).To(BeEmpty())
+			Expect(nso.Status.ReplicaStatuses[1].Error).To(BeEmpty())
+			Expect(packagesHealthy().Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should read the credentials and CA of the pods from their Secrets", func() {
+			nso.Spec.AdminCredentials = orchestrationciscocomv1alpha1.Credentials{Username: "admin", PasswordSecretRef: "nso-admin"}
+			nso.Spec.Monitoring = &orchestrationciscocomv1alpha1.MonitoringSpec{Scheme: "https", CASecretRef: "nso-ca"}
+			newClient := PodNSOClient(fakeClient)
+
+			_, err := newClient(ctx, nso, "nso-poll-0")
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			Expect(fakeClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "nso-admin", Namespace: key.Namespace},
+				Data:       map[string][]byte{"password": []byte("admin")},
+			})).To(Succeed())
+			Expect(fakeClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "nso-ca", Namespace: key.Namespace},
+				Data:       map[string][]byte{"tls.crt": []byte("not a CA")},
+			})).To(Succeed())
+			_, err = newClient(ctx, nso, "nso-poll-0")
+			Expect(err).To(MatchError("secret default/nso-ca has no ca.crt key"))
+
+			nso.Spec.Monitoring.CASecretRef = ""
+			Expect(newClient(ctx, nso, "nso-poll-0")).NotTo(BeNil())
+		})
 	})
 })
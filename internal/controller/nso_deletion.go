@@ -0,0 +1,307 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const (
+	// Finalizer holding the NSO until its deletion policy has been applied
+	nsoFinalizer = "nso.orchestration.cisco.com/finalizer"
+
+	// Name of the NSO container the operator runs commands in
+	nsoContainerName = "ncs"
+	// Name of the volume holding the backup claim
+	backupVolumeName = "backups"
+	// Directory ncs-backup writes to in the NSO container
+	backupMountPath = "/nso/run/backups"
+
+	// Time allowed for ncs-backup to complete
+	backupTimeout = 10 * time.Minute
+	// Delay before checking a backup running in the background again
+	backupCheckInterval = 10 * time.Second
+	// Delay before retrying a failed backup or checking the StatefulSet again
+	deletionRetryInterval = 30 * time.Second
+)
+
+// Matches the backup file in the output of ncs-backup, e.g. "INFO Backup
+// /nso/run/backups/ncs-6.3.1@2025-06-01T00:00:00.backup.gz created successfully"
+var backupFilePattern = regexp.MustCompile(`Backup (/[A-Za-z0-9@._:+/-]+) created`)
+
+// Returns the deletion policy of the NSO, defaulting to Retain so that the
+// NSO data is only deleted when asked for
+func deletionPolicy(nso *orchestrationciscocomv1alpha1.NSO) orchestrationciscocomv1alpha1.DeletionPolicy {
+	if nso.Spec.DeletionPolicy == "" {
+		return orchestrationciscocomv1alpha1.DeletionPolicyRetain
+	}
+	return nso.Spec.DeletionPolicy
+}
+
+// Returns the StatefulSet claim retention policy matching the deletion policy
+func claimRetentionPolicy(nso *orchestrationciscocomv1alpha1.NSO) *appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy {
+	whenDeleted := appsv1.DeletePersistentVolumeClaimRetentionPolicyType
+	if deletionPolicy(nso) == orchestrationciscocomv1alpha1.DeletionPolicyRetain {
+		whenDeleted = appsv1.RetainPersistentVolumeClaimRetentionPolicyType
+	}
+	return &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+		WhenDeleted: whenDeleted,
+		WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+	}
+}
+
+// Function to apply the deletion policy of an NSO being deleted and release
+// its finalizer once done. The owned objects are then garbage collected.
+func (r *NSOReconciler) finalizeNSO(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	original := nso.DeepCopy()
+	policy := deletionPolicy(nso)
+
+	// Backstop for the deletion webhook, e.g. when webhooks are disabled
+	if nso.Spec.DeletionProtection {
+		log.Info("NSO has deletion protection enabled, keeping it until it is turned off")
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionDeleting,
+			Status:             metav1.ConditionFalse,
+			Reason:             orchestrationciscocomv1alpha1.ReasonDeletionProtected,
+			Message:            "Deletion protection is enabled, set spec.deletionProtection to false to delete the NSO",
+			ObservedGeneration: nso.Generation,
+		})
+		return ctrl.Result{}, r.patchStatus(ctx, original, nso)
+	}
+
+	// The claims must be released or kept as the policy says before the
+	// StatefulSet is garbage collected
+	synced, err := r.ensureClaimRetentionPolicy(ctx, nso)
+	if err != nil {
+		log.Error(err, "Failed to update the StatefulSet claim retention policy")
+		return ctrl.Result{}, err
+	}
+	if !synced {
+		log.Info("Waiting for the StatefulSet to apply the claim retention policy")
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
+	if policy == orchestrationciscocomv1alpha1.DeletionPolicyBackupThenDelete && !backupCompleted(nso) {
+		// Retrying would not help, wait for the NSO or its pods to change
+		reason, err := r.backupNotPossible(ctx, nso)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason != "" {
+			log.Info("NSO can not be backed up, keeping it until the deletion policy changes", "reason", reason)
+			meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+				Type:               orchestrationciscocomv1alpha1.ConditionDeleting,
+				Status:             metav1.ConditionFalse,
+				Reason:             orchestrationciscocomv1alpha1.ReasonBackupNotPossible,
+				Message:            fmt.Sprintf("Can not back up the NSO: %s. Set deletionPolicy to Delete or Retain to delete it without a backup", reason),
+				ObservedGeneration: nso.Generation,
+			})
+			return ctrl.Result{}, r.patchStatus(ctx, original, nso)
+		}
+
+		done, err := r.backupNSO(ctx, nso)
+		if patchErr := r.patchStatus(ctx, original, nso); patchErr != nil {
+			log.Error(patchErr, "Failed to update NSO status")
+			return ctrl.Result{}, patchErr
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: backupCheckInterval}, nil
+		}
+		if err != nil {
+			log.Error(err, "NSO backup failed, keeping the NSO until it succeeds")
+			return ctrl.Result{RequeueAfter: deletionRetryInterval}, nil
+		}
+		original = nso.DeepCopy()
+	}
+
+	message := fmt.Sprintf("Releasing the NSO with deletion policy %s", policy)
+	if backupCompleted(nso) {
+		message = meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionDeleting).Message + ". " + message
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionDeleting,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonReleasing,
+		Message:            message,
+		ObservedGeneration: nso.Generation,
+	})
+	if err := r.patchStatus(ctx, original, nso); err != nil {
+		log.Error(err, "Failed to update NSO status")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Removing NSO finalizer", "deletionPolicy", policy)
+	controllerutil.RemoveFinalizer(nso, nsoFinalizer)
+	if err := r.Update(ctx, nso); err != nil {
+		log.Error(err, "Failed to remove NSO finalizer")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// Function to make the StatefulSet claim retention policy match the deletion
+// policy. Returns whether the StatefulSet controller has acted on it, so that
+// claims are not deleted along with a StatefulSet it has not processed yet.
+func (r *NSOReconciler) ensureClaimRetentionPolicy(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (bool, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: nso.Name, Namespace: nso.Namespace}, statefulSet)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	policy := claimRetentionPolicy(nso)
+	if !equality.Semantic.DeepEqual(statefulSet.Spec.PersistentVolumeClaimRetentionPolicy, policy) {
+		statefulSet.Spec.PersistentVolumeClaimRetentionPolicy = policy
+		if err := r.Update(ctx, statefulSet); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return statefulSet.Status.ObservedGeneration >= statefulSet.Generation, nil
+}
+
+// Returns whether the pre-delete backup of the NSO already succeeded
+func backupCompleted(nso *orchestrationciscocomv1alpha1.NSO) bool {
+	condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionDeleting)
+	return condition != nil && condition.Reason == orchestrationciscocomv1alpha1.ReasonBackupCompleted
+}
+
+// Returns why the NSO can not be backed up before its deletion, or an empty
+// string when the first NSO replica can take the backup
+func (r *NSOReconciler) backupNotPossible(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (string, error) {
+	switch {
+	case r.Executor == nil:
+		return "no command executor configured", nil
+	case nso.Spec.Backup == nil:
+		return "no backup location configured", nil
+	case nso.Spec.Replicas == 0:
+		return "no running replica to take the backup from", nil
+	}
+
+	// The cache only holds the pods labelled as managed by the operator, which
+	// the pods of an adopted StatefulSet may not be yet
+	pod := &corev1.Pod{}
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: nso.Name + "-0", Namespace: nso.Namespace}, pod)
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("pod %s-0 to take the backup from does not exist", nso.Name), nil
+	}
+	return "", err
+}
+
+// Function to back the first NSO replica up in the background and record the
+// progress in the Deleting condition. Returns whether the backup completed,
+// and its error if it failed.
+func (r *NSOReconciler) backupNSO(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (bool, error) {
+	pod := nso.Name + "-0"
+	// Keyed by the deletion timestamp, which does not change while the NSO is
+	// being deleted
+	key := fmt.Sprintf("delete/%s/%s@%d", nso.Namespace, pod, nso.DeletionTimestamp.Unix())
+	done, _, err := r.backupInBackground(ctx, key, nso.Namespace, pod, time.Now().Add(backupTimeout))
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionDeleting,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: nso.Generation,
+	}
+	switch {
+	case !done:
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonBackupInProgress
+		condition.Message = fmt.Sprintf("Backing up pod %s before deleting the NSO", pod)
+	case err != nil:
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonBackupFailed
+		condition.Message = fmt.Sprintf("Backup failed, retrying in %s: %v. Set deletionPolicy to Delete or Retain to skip it", deletionRetryInterval, err)
+	default:
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonBackupCompleted
+		condition.Message = fmt.Sprintf("Backup of pod %s written to claim %s", pod, nso.Spec.Backup.ClaimName)
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, condition)
+	return done, err
+}
+
+// ncs-backup running in the background
+type backgroundBackup struct {
+	done chan struct{}
+	file string
+	err  error
+}
+
+// Function to start ncs-backup in the pod under the key, unless it already
+// runs, and to return its outcome once it completes. The backup runs outside
+// of the reconcile, so that a slow backup does not hold the other NSO
+// instances back, and stops at the deadline at the latest.
+func (r *NSOReconciler) backupInBackground(ctx context.Context, key, namespace, pod string, deadline time.Time) (bool, string, error) {
+	value, running := r.backups.LoadOrStore(key, &backgroundBackup{done: make(chan struct{})})
+	backup := value.(*backgroundBackup)
+	if !running {
+		logf.FromContext(ctx).Info("Backing up NSO", "pod", pod)
+		backupCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		go func() {
+			defer cancel()
+			backup.file, backup.err = r.runBackup(backupCtx, namespace, pod)
+			close(backup.done)
+		}()
+	}
+
+	select {
+	case <-backup.done:
+		r.backups.Delete(key)
+		return true, backup.file, backup.err
+	default:
+		return false, "", nil
+	}
+}
+
+// Function to run ncs-backup in the NSO container of the pod. Returns the path
+// of the backup file, or an empty string when ncs-backup did not print it.
+func (r *NSOReconciler) runBackup(ctx context.Context, namespace, pod string) (string, error) {
+	if r.Executor == nil {
+		return "", fmt.Errorf("no command executor configured")
+	}
+	backupCtx, cancel := context.WithTimeout(ctx, backupTimeout)
+	defer cancel()
+	stdout, stderr, err := r.Executor.Exec(backupCtx, namespace, pod, nsoContainerName, []string{"ncs-backup"})
+	if err != nil {
+		if stderr != "" {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr))
+		}
+		return "", err
+	}
+	if match := backupFilePattern.FindStringSubmatch(stdout + stderr); match != nil {
+		return match[1], nil
+	}
+	return "", nil
+}
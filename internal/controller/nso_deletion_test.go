@@ -0,0 +1,236 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Returns a reconciler holding an NSO being deleted with the policy, along
+// with its StatefulSet and first pod
+func newDeletionReconciler(t *testing.T, policy orchestrationciscocomv1alpha1.DeletionPolicy) (*NSOReconciler, *fakeExecutor) {
+	now := metav1.Now()
+	nso := newTestNSO("nso-deleted", 1)
+	nso.Finalizers = []string{nsoFinalizer}
+	nso.DeletionTimestamp = &now
+	nso.Spec.DeletionPolicy = policy
+	nso.Spec.Backup = &orchestrationciscocomv1alpha1.BackupLocation{ClaimName: "nso-backups"}
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: nso.Name, Namespace: nso.Namespace, Generation: 1},
+		Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1},
+		Spec: appsv1.StatefulSetSpec{
+			PersistentVolumeClaimRetentionPolicy: &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+				WhenScaled:  appsv1.RetainPersistentVolumeClaimRetentionPolicyType,
+			},
+		},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: nso.Name + "-0", Namespace: nso.Namespace}}
+
+	r := newTestReconciler(t, nso, statefulSet, pod)
+	executor := &fakeExecutor{}
+	r.Executor = executor
+	return r, executor
+}
+
+func TestFinalizeNSO(t *testing.T) {
+	ctx := context.Background()
+	key := client.ObjectKey{Name: "nso-deleted", Namespace: testNamespace}
+	request := reconcile.Request{NamespacedName: key}
+
+	released := func(g Gomega, r *NSOReconciler) {
+		g.Expect(errors.IsNotFound(r.Get(ctx, key, &orchestrationciscocomv1alpha1.NSO{}))).To(BeTrue())
+	}
+
+	// Reconciles until the backup running in the background completes
+	backUp := func(g Gomega, r *NSOReconciler) ctrl.Result {
+		var result ctrl.Result
+		g.Eventually(func() (time.Duration, error) {
+			var err error
+			result, err = r.Reconcile(ctx, request)
+			return result.RequeueAfter, err
+		}).ShouldNot(Equal(backupCheckInterval))
+		return result
+	}
+
+	deleting := func(g Gomega, r *NSOReconciler) (*metav1.Condition, *orchestrationciscocomv1alpha1.NSO) {
+		nso := &orchestrationciscocomv1alpha1.NSO{}
+		g.Expect(r.Get(ctx, key, nso)).To(Succeed())
+		condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionDeleting)
+		g.Expect(condition).NotTo(BeNil())
+		return condition, nso
+	}
+
+	t.Run("releases the NSO without a backup with the Delete policy", func(t *testing.T) {
+		g := NewWithT(t)
+		r, executor := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyDelete)
+
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(executor.commands).To(BeEmpty())
+		released(g, r)
+	})
+
+	for _, policy := range []orchestrationciscocomv1alpha1.DeletionPolicy{orchestrationciscocomv1alpha1.DeletionPolicyRetain, ""} {
+		t.Run(fmt.Sprintf("keeps the claims with the %q policy", policy), func(t *testing.T) {
+			g := NewWithT(t)
+			r, _ := newDeletionReconciler(t, policy)
+
+			// The StatefulSet claim retention policy is switched first
+			result, err := r.Reconcile(ctx, request)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result.RequeueAfter).NotTo(BeZero())
+
+			statefulSet := &appsv1.StatefulSet{}
+			g.Expect(r.Get(ctx, key, statefulSet)).To(Succeed())
+			g.Expect(statefulSet.Spec.PersistentVolumeClaimRetentionPolicy.WhenDeleted).
+				To(Equal(appsv1.RetainPersistentVolumeClaimRetentionPolicyType))
+			g.Expect(r.Get(ctx, key, &orchestrationciscocomv1alpha1.NSO{})).To(Succeed())
+
+			// The NSO is released once the StatefulSet controller observed it
+			statefulSet.Status.ObservedGeneration = statefulSet.Generation
+			g.Expect(r.Status().Update(ctx, statefulSet)).To(Succeed())
+			_, err = r.Reconcile(ctx, request)
+			g.Expect(err).NotTo(HaveOccurred())
+			released(g, r)
+		})
+	}
+
+	t.Run("backs up the NSO before releasing it", func(t *testing.T) {
+		g := NewWithT(t)
+		r, executor := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyBackupThenDelete)
+
+		backUp(g, r)
+		g.Expect(executor.commands).To(ConsistOf("default/nso-deleted-0/ncs: ncs-backup"))
+		released(g, r)
+	})
+
+	t.Run("does not hold the reconcile while the backup runs", func(t *testing.T) {
+		g := NewWithT(t)
+		r, executor := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyBackupThenDelete)
+		executor.release = make(chan struct{})
+
+		result, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.RequeueAfter).To(Equal(backupCheckInterval))
+		condition, _ := deleting(g, r)
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonBackupInProgress))
+		g.Expect(condition.Message).To(Equal("Backing up pod nso-deleted-0 before deleting the NSO"))
+
+		// The backup is started only once
+		_, err = r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Eventually(executor.ran).Should(Equal([]string{"default/nso-deleted-0/ncs: ncs-backup"}))
+
+		// The NSO is released once the backup completes
+		close(executor.release)
+		backUp(g, r)
+		g.Expect(executor.ran()).To(HaveLen(1))
+		released(g, r)
+	})
+
+	t.Run("looks the pod to back up from up through the API reader", func(t *testing.T) {
+		g := NewWithT(t)
+		r, executor := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyBackupThenDelete)
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: key.Name + "-0", Namespace: key.Namespace}}
+		r.APIReader = fake.NewClientBuilder().WithScheme(r.Scheme).WithObjects(pod.DeepCopy()).Build()
+		// The cache does not hold the pods without the managed-by label
+		g.Expect(r.Delete(ctx, pod)).To(Succeed())
+
+		backUp(g, r)
+		g.Expect(executor.commands).To(ConsistOf("default/nso-deleted-0/ncs: ncs-backup"))
+		released(g, r)
+	})
+
+	t.Run("keeps the NSO while deletion protection is enabled", func(t *testing.T) {
+		g := NewWithT(t)
+		r, _ := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyDelete)
+		nso := &orchestrationciscocomv1alpha1.NSO{}
+		g.Expect(r.Get(ctx, key, nso)).To(Succeed())
+		nso.Spec.DeletionProtection = true
+		g.Expect(r.Update(ctx, nso)).To(Succeed())
+
+		_, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		condition, nso := deleting(g, r)
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonDeletionProtected))
+
+		// Turning deletion protection off releases the NSO
+		nso.Spec.DeletionProtection = false
+		g.Expect(r.Update(ctx, nso)).To(Succeed())
+		_, err = r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		released(g, r)
+	})
+
+	t.Run("keeps the NSO and reports the failure when the backup fails", func(t *testing.T) {
+		g := NewWithT(t)
+		r, executor := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyBackupThenDelete)
+		executor.err = fmt.Errorf("exit code 1")
+		executor.stderr = "Failed to connect to NSO"
+
+		g.Expect(backUp(g, r).RequeueAfter).To(Equal(deletionRetryInterval))
+		condition, _ := deleting(g, r)
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonBackupFailed))
+		g.Expect(condition.Message).To(ContainSubstring("Failed to connect to NSO"))
+
+		// The NSO is released once the backup succeeds
+		executor.err = nil
+		backUp(g, r)
+		released(g, r)
+	})
+
+	t.Run("does not retry a backup that can not be taken", func(t *testing.T) {
+		g := NewWithT(t)
+		r, executor := newDeletionReconciler(t, orchestrationciscocomv1alpha1.DeletionPolicyBackupThenDelete)
+		g.Expect(r.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: key.Name + "-0", Namespace: key.Namespace}})).To(Succeed())
+
+		result, err := r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.RequeueAfter).To(BeZero())
+		g.Expect(executor.commands).To(BeEmpty())
+		condition, nso := deleting(g, r)
+		g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(condition.Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonBackupNotPossible))
+		g.Expect(condition.Message).To(Equal("Can not back up the NSO: pod nso-deleted-0 to take the backup from does not exist. " +
+			"Set deletionPolicy to Delete or Retain to delete it without a backup"))
+
+		// The NSO is released once the deletion policy changes
+		nso.Spec.DeletionPolicy = orchestrationciscocomv1alpha1.DeletionPolicyDelete
+		g.Expect(r.Update(ctx, nso)).To(Succeed())
+		_, err = r.Reconcile(ctx, request)
+		g.Expect(err).NotTo(HaveOccurred())
+		released(g, r)
+	})
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const (
+	kindConfigMap = "ConfigMap"
+	kindSecret    = "Secret"
+
+	// Annotation added to the cached copy of ConfigMaps and Secrets holding a
+	// digest of the data that was stripped from them
+	dataHashAnnotation = "nso.orchestration.cisco.com/data-hash"
+)
+
+// dependency is a ConfigMap or Secret consumed by the NSO pods
+type dependency struct {
+	Kind     string
+	Name     string
+	Optional bool
+}
+
+func (d dependency) String() string {
+	return d.Kind + " " + d.Name
+}
+
+// Collects the references of the NSO spec into a deduplicated dependency set,
+// keyed by kind and name and holding whether every reference is optional
+type dependencySet map[dependency]bool
+
+func (s dependencySet) add(kind, name string, optional *bool) {
+	if name == "" {
+		return
+	}
+	key := dependency{Kind: kind, Name: name}
+	isOptional := optional != nil && *optional
+	if previous, ok := s[key]; ok {
+		isOptional = isOptional && previous
+	}
+	s[key] = isOptional
+}
+
+func (s dependencySet) addEnv(env []corev1.EnvVar) {
+	for _, envVar := range env {
+		if envVar.ValueFrom == nil {
+			continue
+		}
+		if ref := envVar.ValueFrom.ConfigMapKeyRef; ref != nil {
+			s.add(kindConfigMap, ref.Name, ref.Optional)
+		}
+		if ref := envVar.ValueFrom.SecretKeyRef; ref != nil {
+			s.add(kindSecret, ref.Name, ref.Optional)
+		}
+	}
+}
+
+func (s dependencySet) addEnvFrom(envFrom []corev1.EnvFromSource) {
+	for _, source := range envFrom {
+		if ref := source.ConfigMapRef; ref != nil {
+			s.add(kindConfigMap, ref.Name, ref.Optional)
+		}
+		if ref := source.SecretRef; ref != nil {
+			s.add(kindSecret, ref.Name, ref.Optional)
+		}
+	}
+}
+
+func (s dependencySet) addContainers(containers []corev1.Container) {
+	for _, container := range containers {
+		s.addEnv(container.Env)
+		s.addEnvFrom(container.EnvFrom)
+	}
+}
+
+func (s dependencySet) addVolumes(volumes []corev1.Volume) {
+	for _, volume := range volumes {
+		if source := volume.ConfigMap; source != nil {
+			s.add(kindConfigMap, source.Name, source.Optional)
+		}
+		if source := volume.Secret; source != nil {
+			s.add(kindSecret, source.SecretName, source.Optional)
+		}
+		if source := volume.Projected; source != nil {
+			for _, projection := range source.Sources {
+				if projection.ConfigMap != nil {
+					s.add(kindConfigMap, projection.ConfigMap.Name, projection.ConfigMap.Optional)
+				}
+				if projection.Secret != nil {
+					s.add(kindSecret, projection.Secret.Name, projection.Secret.Optional)
+				}
+			}
+		}
+	}
+}
+
+func (s dependencySet) addImagePullSecrets(secrets []corev1.LocalObjectReference) {
+	for _, secret := range secrets {
+		s.add(kindSecret, secret.Name, nil)
+	}
+}
+
+// Adds the references of the podTemplate override. An override that can not be
+// decoded is not applied to the pods, so it brings no dependencies.
+func (s dependencySet) addPodTemplate(override []byte) {
+	if len(override) == 0 {
+		return
+	}
+	var template corev1.PodTemplateSpec
+	if err := json.Unmarshal(override, &template); err != nil {
+		return
+	}
+	s.addVolumes(template.Spec.Volumes)
+	s.addContainers(template.Spec.InitContainers)
+	s.addContainers(template.Spec.Containers)
+	s.addImagePullSecrets(template.Spec.ImagePullSecrets)
+}
+
+// Returns the dependencies in a stable order
+func (s dependencySet) sorted() []dependency {
+	dependencies := make([]dependency, 0, len(s))
+	for dep, optional := range s {
+		dep.Optional = optional
+		dependencies = append(dependencies, dep)
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		if dependencies[i].Kind != dependencies[j].Kind {
+			return dependencies[i].Kind < dependencies[j].Kind
+		}
+		return dependencies[i].Name < dependencies[j].Name
+	})
+	return dependencies
+}
+
+// Computes every ConfigMap and Secret the NSO pods depend on from the NSO spec
+func dependenciesForNSO(nso *orchestrationciscocomv1alpha1.NSO) []dependency {
+	set := dependencySet{}
+	set.add(kindConfigMap, nso.Spec.NsoConfigRef, nil)
+	set.add(kindSecret, nso.Spec.AdminCredentials.PasswordSecretRef, nil)
+	set.addEnv(nso.Spec.Env)
+	set.addEnvFrom(nso.Spec.EnvFrom)
+	set.addVolumes(nso.Spec.Volumes)
+	set.addContainers(nso.Spec.InitContainers)
+	set.addContainers(nso.Spec.Sidecars)
+	set.addImagePullSecrets(nso.Spec.ImagePullSecrets)
+	if nso.Spec.PodTemplate != nil {
+		set.addPodTemplate(nso.Spec.PodTemplate.Raw)
+	}
+	return set.sorted()
+}
+
+// Returns the names of the dependencies of the given kind
+func dependencyNames(nso *orchestrationciscocomv1alpha1.NSO, kind string) []string {
+	var names []string
+	for _, dep := range dependenciesForNSO(nso) {
+		if dep.Kind == kind {
+			names = append(names, dep.Name)
+		}
+	}
+	return names
+}
+
+// Fetches the NSO dependencies, records the DependenciesResolved condition and
+// returns a hash of their content. The hash is stamped on the pod template so
+// that a change in any dependency rolls the NSO pods.
+func (r *NSOReconciler) resolveDependencies(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (string, error) {
+	hash := sha256.New()
+	var missing []string
+
+	for _, dep := range dependenciesForNSO(nso) {
+		key := types.NamespacedName{Name: dep.Name, Namespace: nso.Namespace}
+
+		var obj client.Object
+		if dep.Kind == kindConfigMap {
+			obj = &corev1.ConfigMap{}
+		} else {
+			obj = &corev1.Secret{}
+		}
+
+		err := r.Get(ctx, key, obj)
+		if errors.IsNotFound(err) {
+			if !dep.Optional {
+				missing = append(missing, dep.String())
+			}
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to get %s: %w", dep, err)
+		}
+
+		fmt.Fprintf(hash, "%s=%s\n", dep, cachedDataHash(obj))
+	}
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionDependenciesResolved,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonDependenciesFound,
+		Message:            "All referenced ConfigMaps and Secrets exist",
+		ObservedGeneration: nso.Generation,
+	}
+	if len(missing) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonDependenciesMissing
+		condition.Message = "Missing dependencies: " + strings.Join(missing, ", ")
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, condition)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Returns the digest of the data of a ConfigMap or Secret served from the
+// manager cache, whose data has been stripped and replaced by its digest.
+// Other objects are hashed from their data, so that an annotation set on the
+// object itself can not hide a change of its data.
+func cachedDataHash(obj client.Object) string {
+	if digest, ok := obj.GetAnnotations()[dataHashAnnotation]; ok && dataStripped(obj) {
+		return digest
+	}
+	return dataHash(obj)
+}
+
+// Returns whether the ConfigMap or Secret holds no data
+func dataStripped(obj client.Object) bool {
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		return len(obj.Data) == 0 && len(obj.BinaryData) == 0
+	case *corev1.Secret:
+		return len(obj.Data) == 0 && len(obj.StringData) == 0
+	}
+	return false
+}
+
+// Returns the digest of the data held by a ConfigMap or Secret
+func dataHash(obj client.Object) string {
+	hash := sha256.New()
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		writeDataHash(hash, obj.Data, obj.BinaryData)
+	case *corev1.Secret:
+		writeDataHash(hash, obj.StringData, obj.Data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Writes the data of a ConfigMap or Secret to the hash in key order
+func writeDataHash(hash io.Writer, data map[string]string, binaryData map[string][]byte) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%q\n", key, data[key])
+	}
+
+	keys = keys[:0]
+	for key := range binaryData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%x\n", key, binaryData[key])
+	}
+}
+
+// TransformStripData is a cache transform for ConfigMaps and Secrets. The
+// operator only watches them to trigger NSO reconciles, so the cache keeps
+// their metadata and a digest of their data instead of the content itself.
+// Code that needs the actual content must read it through the API reader.
+func TransformStripData(obj interface{}) (interface{}, error) {
+	object, ok := obj.(client.Object)
+	if !ok {
+		return obj, nil
+	}
+
+	digest := dataHash(object)
+	switch object := object.(type) {
+	case *corev1.ConfigMap:
+		object.Data = nil
+		object.BinaryData = nil
+	case *corev1.Secret:
+		object.Data = nil
+		object.StringData = nil
+	default:
+		return obj, nil
+	}
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[dataHashAnnotation] = digest
+	object.SetAnnotations(annotations)
+	object.SetManagedFields(nil)
+
+	return object, nil
+}
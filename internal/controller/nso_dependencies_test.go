@@ -0,0 +1,79 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTransformStripData(t *testing.T) {
+	newSecret := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin-password", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("admin")},
+		}
+	}
+
+	t.Run("keeps only metadata and a data digest in the cache", func(t *testing.T) {
+		g := NewWithT(t)
+		secret := newSecret()
+		expectedHash := dataHash(secret)
+
+		transformed, err := TransformStripData(secret.DeepCopy())
+		g.Expect(err).NotTo(HaveOccurred())
+		cached := transformed.(*corev1.Secret)
+		g.Expect(cached.Data).To(BeEmpty())
+		g.Expect(cached.Name).To(Equal("admin-password"))
+		g.Expect(cachedDataHash(cached)).To(Equal(expectedHash))
+	})
+
+	t.Run("produces a different digest when the data changes", func(t *testing.T) {
+		g := NewWithT(t)
+		secret := newSecret()
+		expectedHash := dataHash(secret)
+
+		secret.Data["password"] = []byte("changed")
+		g.Expect(dataHash(secret)).NotTo(Equal(expectedHash))
+	})
+
+	t.Run("hashes the data of objects carrying the digest annotation themselves", func(t *testing.T) {
+		g := NewWithT(t)
+		secret := newSecret()
+		forgedHash := dataHash(secret)
+		secret.Data["password"] = []byte("changed")
+		secret.Annotations = map[string]string{dataHashAnnotation: forgedHash}
+
+		g.Expect(cachedDataHash(secret)).NotTo(Equal(forgedHash))
+		transformed, err := TransformStripData(secret.DeepCopy())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(cachedDataHash(transformed.(*corev1.Secret))).To(Equal(dataHash(secret)))
+		g.Expect(cachedDataHash(transformed.(*corev1.Secret))).NotTo(Equal(forgedHash))
+	})
+
+	t.Run("leaves other object types untouched", func(t *testing.T) {
+		g := NewWithT(t)
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "nso"}}
+
+		transformed, err := TransformStripData(service)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(transformed.(*corev1.Service).Annotations).To(BeEmpty())
+	})
+}
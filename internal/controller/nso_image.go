@@ -0,0 +1,158 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/imagepolicy"
+	"github.com/carlosgrillet/nso-operator/internal/registry"
+)
+
+const (
+	// Time allowed for the registry to resolve the NSO image
+	imageResolveTimeout = 30 * time.Second
+	// Delay before resolving the NSO image again after a failure
+	imageResolveRetryInterval = time.Minute
+)
+
+// Function to return the image the NSO pods run. With pinImageDigest set, or
+// when the image policy requires a signature, the image is resolved to a
+// digest when it changed since the last resolution or when the
+// ResolveImageAnnotation asks for it, and the outcome is recorded in the
+// status. An empty image means it could not be resolved or is not allowed
+// yet, and a non zero delay that the resolution must be retried.
+func (r *NSOReconciler) imageForNSO(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (string, time.Duration, error) {
+	log := logf.FromContext(ctx)
+
+	verify := r.ImagePolicy.RequiresSignature()
+	if !nso.Spec.PinImageDigest && !verify {
+		nso.Status.ImageDigest = ""
+		nso.Status.PinnedImage = ""
+		meta.RemoveStatusCondition(&nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImagePinned)
+		return nso.Spec.Image, 0, nil
+	}
+
+	// Keep the current digest until the image changes or a new one is
+	// requested. A digest pinned before the operator started is verified
+	// again, as the policy may have changed since.
+	pinned := nso.Status.PinnedImage == nso.Spec.Image && nso.Status.ImageDigest != ""
+	current := registry.PinnedReference(nso.Spec.Image, nso.Status.ImageDigest)
+	trusted := pinned && (!verify || r.isImageVerified(current))
+	_, requested := nso.Annotations[orchestrationciscocomv1alpha1.ResolveImageAnnotation]
+	if trusted && !requested {
+		return current, 0, nil
+	}
+	target := nso.Spec.Image
+	if pinned && !requested {
+		target = current
+	}
+
+	keychain, err := r.imageKeychain(ctx, nso)
+	if err != nil {
+		return "", 0, err
+	}
+	resolveCtx, cancel := context.WithTimeout(ctx, imageResolveTimeout)
+	defer cancel()
+	var digest string
+	if verify {
+		digest, err = r.ImagePolicy.VerifySignature(resolveCtx, target, keychain)
+	} else {
+		digest, err = registry.ResolveDigest(resolveCtx, target, keychain)
+	}
+	if imagepolicy.IsViolation(err) {
+		log.Info("NSO image rejected by the image policy", "reason", err.Error())
+		setImagePolicyViolation(nso, err)
+		return "", imageResolveRetryInterval, nil
+	}
+	if err != nil {
+		log.Error(err, "Failed to resolve the NSO image digest")
+		message := fmt.Sprintf("Failed to resolve image %s, retrying in %s: %v", nso.Spec.Image, imageResolveRetryInterval, err)
+		if trusted {
+			message += ". Keeping digest " + nso.Status.ImageDigest
+		}
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionImagePinned,
+			Status:             metav1.ConditionFalse,
+			Reason:             orchestrationciscocomv1alpha1.ReasonResolutionFailed,
+			Message:            message,
+			ObservedGeneration: nso.Generation,
+		})
+		if trusted {
+			return current, imageResolveRetryInterval, nil
+		}
+		return "", imageResolveRetryInterval, nil
+	}
+
+	if digest != nso.Status.ImageDigest {
+		log.Info("Pinning NSO image", "image", nso.Spec.Image, "digest", digest)
+	}
+	image := registry.PinnedReference(nso.Spec.Image, digest)
+	if verify {
+		r.verifiedImages.Store(image, true)
+	}
+	nso.Status.ImageDigest = digest
+	nso.Status.PinnedImage = nso.Spec.Image
+	meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionImagePinned,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonDigestResolved,
+		Message:            fmt.Sprintf("Image %s pinned to digest %s", nso.Spec.Image, digest),
+		ObservedGeneration: nso.Generation,
+	})
+
+	// The request is handled, remove it so that it can be made again. The
+	// patch response holds the stored status, the new one is kept.
+	if requested {
+		status := nso.Status.DeepCopy()
+		patch := client.MergeFrom(nso.DeepCopy())
+		delete(nso.Annotations, orchestrationciscocomv1alpha1.ResolveImageAnnotation)
+		if err := r.Patch(ctx, nso, patch); err != nil {
+			return "", 0, err
+		}
+		nso.Status = *status
+	}
+	return image, 0, nil
+}
+
+// Returns whether the signature of the pinned image was verified since the
+// operator started
+func (r *NSOReconciler) isImageVerified(image string) bool {
+	_, ok := r.verifiedImages.Load(image)
+	return ok
+}
+
+// Returns the credentials of the imagePullSecrets of the NSO
+func (r *NSOReconciler) imageKeychain(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (*registry.Keychain, error) {
+	return registry.KeychainFromSecrets(ctx, r.apiReader(), nso.Namespace, nso.Spec.ImagePullSecrets)
+}
+
+// Returns the reader for the objects whose content is not cached
+func (r *NSOReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Returns the images of the NSO, its init containers and sidecars
+func imagesOfNSO(nso *orchestrationciscocomv1alpha1.NSO) []string {
+	images := []string{nso.Spec.Image}
+	for _, container := range append(append([]corev1.Container{}, nso.Spec.InitContainers...), nso.Spec.Sidecars...) {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// Returns the images of every container of the pod template
+func imagesOfTemplate(template *corev1.PodTemplateSpec) []string {
+	var images []string
+	for _, container := range append(append([]corev1.Container{}, template.Spec.InitContainers...), template.Spec.Containers...) {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// Function to check the images against the allowed registries of the image
+// policy. A violation is recorded in the ImageAllowed condition and returned.
+func (r *NSOReconciler) checkAllowedImages(nso *orchestrationciscocomv1alpha1.NSO, images []string) error {
+	err := r.ImagePolicy.CheckImages(images...)
+	if err != nil {
+		setImagePolicyViolation(nso, err)
+	}
+	return err
+}
+
+// Function to record in the ImageAllowed condition that the images of the NSO
+// pods comply with the image policy. The condition is removed without policy.
+func (r *NSOReconciler) setImagesAllowed(nso *orchestrationciscocomv1alpha1.NSO) {
+	if r.ImagePolicy == nil {
+		meta.RemoveStatusCondition(&nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionImageAllowed)
+		return
+	}
+	message := "The images of the NSO pods come from the allowed registries"
+	if r.ImagePolicy.RequiresSignature() {
+		message += " and the signature of the NSO image is verified"
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionImageAllowed,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonPolicySatisfied,
+		Message:            message,
+		ObservedGeneration: nso.Generation,
+	})
+}
+
+// Function to record the image policy violation in the ImageAllowed condition
+func setImagePolicyViolation(nso *orchestrationciscocomv1alpha1.NSO, err error) {
+	meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionImageAllowed,
+		Status:             metav1.ConditionFalse,
+		Reason:             orchestrationciscocomv1alpha1.ReasonPolicyViolation,
+		Message:            err.Error(),
+		ObservedGeneration: nso.Generation,
+	})
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Recommended labels set on every object created by the operator, see
+// https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
+const (
+	nameLabel      = "app.kubernetes.io/name"
+	instanceLabel  = "app.kubernetes.io/instance"
+	versionLabel   = "app.kubernetes.io/version"
+	componentLabel = "app.kubernetes.io/component"
+	managedByLabel = "app.kubernetes.io/managed-by"
+
+	nameValue      = "nso"
+	componentValue = "server"
+	managedByValue = "nso-operator"
+)
+
+// Returns the recommended labels of the objects created for the NSO
+func standardLabels(nso *orchestrationciscocomv1alpha1.NSO) map[string]string {
+	labels := map[string]string{
+		nameLabel:      nameValue,
+		instanceLabel:  nso.Name,
+		componentLabel: componentValue,
+		managedByLabel: managedByValue,
+	}
+	if version := imageVersion(nso.Spec.Image); version != "" {
+		labels[versionLabel] = version
+	}
+	return labels
+}
+
+// Returns the labels of an object created for the NSO: the recommended labels,
+// the extra labels of the user and the selector labels, which always win so
+// that the selector keeps matching. The managed-by label is kept as it is used
+// to find the objects to prune.
+func mergeLabels(nso *orchestrationciscocomv1alpha1.NSO, extra *orchestrationciscocomv1alpha1.EmbeddedMetadata) map[string]string {
+	labels := standardLabels(nso)
+	if extra != nil {
+		maps.Copy(labels, extra.Labels)
+	}
+	maps.Copy(labels, nso.Spec.LabelSelector)
+	labels[managedByLabel] = managedByValue
+	return labels
+}
+
+// Returns the labels of the StatefulSet and of the objects with no extra
+// labels of their own
+func objectLabels(nso *orchestrationciscocomv1alpha1.NSO) map[string]string {
+	return mergeLabels(nso, nil)
+}
+
+// Returns the extra annotations of an object, or nil
+func extraAnnotations(extra *orchestrationciscocomv1alpha1.EmbeddedMetadata) map[string]string {
+	if extra == nil || len(extra.Annotations) == 0 {
+		return nil
+	}
+	return maps.Clone(extra.Annotations)
+}
+
+// Returns the tag of a container image reference as a label value, or an
+// empty string when the image has no tag
+func imageVersion(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+
+	version := image[i+1:]
+	if len(version) > validation.LabelValueMaxLength {
+		version = version[:validation.LabelValueMaxLength]
+	}
+	version = strings.Trim(version, "._-")
+	if len(validation.IsValidLabelValue(version)) > 0 {
+		return ""
+	}
+	return version
+}
+
+// Function to add the labels and annotations of the volume claim templates to
+// the existing claims of the replicas. Claim templates can not change once the
+// StatefulSet exists, so later changes only reach the claims this way.
+func (r *NSOReconciler) syncClaimMetadata(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) error {
+	log := logf.FromContext(ctx)
+	labels := claimLabels(nso)
+	annotations := extraAnnotations(nso.Spec.VolumeClaimMetadata)
+
+	for _, template := range nso.Spec.VolumeClaimTemplates {
+		for ordinal := range nso.Spec.Replicas {
+			claim := &corev1.PersistentVolumeClaim{}
+			key := types.NamespacedName{Name: fmt.Sprintf("%s-%s-%d", template.Name, nso.Name, ordinal), Namespace: nso.Namespace}
+			err := r.Get(ctx, key, claim)
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			patch := client.MergeFrom(claim.DeepCopy())
+			changed := mergeInto(&claim.Labels, labels)
+			changed = mergeInto(&claim.Annotations, annotations) || changed
+			if !changed {
+				continue
+			}
+
+			log.Info("Updating persistent volume claim metadata", "name", claim.Name)
+			if err := r.Patch(ctx, claim, patch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the volume claim templates of the NSO with the claim labels and
+// annotations
+func volumeClaimTemplatesForNSO(nso *orchestrationciscocomv1alpha1.NSO) []corev1.PersistentVolumeClaim {
+	if len(nso.Spec.VolumeClaimTemplates) == 0 {
+		return nil
+	}
+	labels := claimLabels(nso)
+	annotations := extraAnnotations(nso.Spec.VolumeClaimMetadata)
+
+	templates := make([]corev1.PersistentVolumeClaim, 0, len(nso.Spec.VolumeClaimTemplates))
+	for _, template := range nso.Spec.VolumeClaimTemplates {
+		template := *template.DeepCopy()
+		mergeInto(&template.Labels, labels)
+		mergeInto(&template.Annotations, annotations)
+		templates = append(templates, template)
+	}
+	return templates
+}
+
+// Returns the labels of the persistent volume claims. They do not include
+// the version label, which would be stale after an upgrade as claim templates
+// can not change.
+func claimLabels(nso *orchestrationciscocomv1alpha1.NSO) map[string]string {
+	labels := mergeLabels(nso, nso.Spec.VolumeClaimMetadata)
+	delete(labels, versionLabel)
+	return labels
+}
+
+// Copies the entries into the map and returns whether it changed
+func mergeInto(target *map[string]string, entries map[string]string) bool {
+	changed := false
+	for key, value := range entries {
+		if current, ok := (*target)[key]; ok && current == value {
+			continue
+		}
+		if *target == nil {
+			*target = map[string]string{}
+		}
+		(*target)[key] = value
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	nsoclient "github.com/carlosgrillet/nso-operator/internal/nso"
+)
+
+const (
+	// Ports the NSO container serves its web UI and RESTCONF API on
+	httpPort  = 8080
+	httpsPort = 8888
+
+	// Time between two polls of the replicas when the NSO does not set one
+	defaultPollInterval = time.Minute
+	// Time allowed for each RESTCONF request of a poll
+	pollRequestTimeout = 10 * time.Second
+	// Time allowed for a poll of all the replicas, which are polled
+	// concurrently
+	pollTimeout = 30 * time.Second
+	// Key of the monitoring CA Secret holding the certificates
+	caCertKey = "ca.crt"
+)
+
+// NSOClientFunc returns the RESTCONF client of a pod of the NSO
+type NSOClientFunc func(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, pod string) (*nsoclient.Client, error)
+
+// PodNSOClient returns the NSOClientFunc reaching the pods through the DNS
+// records of the headless Service, as the NSO admin user. The reader should
+// not be the cached client, which does not hold the content of Secrets.
+func PodNSOClient(reader client.Reader) NSOClientFunc {
+	return func(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, pod string) (*nsoclient.Client, error) {
+		monitoring := monitoringSpec(nso)
+		password, err := nsoclient.PasswordFromSecret(ctx, reader, nso.Namespace, nso.Spec.AdminCredentials.PasswordSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		port := int32(httpPort)
+		if monitoring.Scheme == "https" {
+			port = httpsPort
+		}
+		options := nsoclient.Options{
+			URL:                nsoclient.PodURL(monitoring.Scheme, pod, nso.Spec.ServiceName, nso.Namespace, port),
+			Username:           nso.Spec.AdminCredentials.Username,
+			Password:           password,
+			InsecureSkipVerify: monitoring.InsecureSkipVerify,
+			Timeout:            pollRequestTimeout,
+		}
+		if monitoring.CASecretRef != "" {
+			secret := &corev1.Secret{}
+			if err := reader.Get(ctx, types.NamespacedName{Name: monitoring.CASecretRef, Namespace: nso.Namespace}, secret); err != nil {
+				return nil, err
+			}
+			if options.CACert = secret.Data[caCertKey]; len(options.CACert) == 0 {
+				return nil, fmt.Errorf("secret %s/%s has no %s key", nso.Namespace, monitoring.CASecretRef, caCertKey)
+			}
+		}
+		return nsoclient.New(options)
+	}
+}
+
+// Returns the monitoring settings of the NSO with the defaults of the unset
+// fields
+func monitoringSpec(nso *orchestrationciscocomv1alpha1.NSO) orchestrationciscocomv1alpha1.MonitoringSpec {
+	var monitoring orchestrationciscocomv1alpha1.MonitoringSpec
+	if nso.Spec.Monitoring != nil {
+		monitoring = *nso.Spec.Monitoring
+	}
+	if monitoring.PollInterval.Duration == 0 {
+		monitoring.PollInterval.Duration = defaultPollInterval
+	}
+	if monitoring.Scheme == "" {
+		monitoring.Scheme = "http"
+	}
+	return monitoring
+}
+
+// Function to record the NSO version and packages of every replica in the
+// status, and whether all the packages are up in the PackagesHealthy
+// condition, once the poll interval elapsed since the last poll. Nothing is
+// reported while the polling is disabled or there are no replicas. Returns
+// the delay before the next poll.
+func (r *NSOReconciler) pollReplicas(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (time.Duration, error) {
+	monitoring := monitoringSpec(nso)
+	if r.NSOClient == nil || monitoring.Disabled || nso.Spec.Replicas == 0 {
+		nso.Status.ReplicaStatuses = nil
+		nso.Status.LastPollTime = nil
+		meta.RemoveStatusCondition(&nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPackagesHealthy)
+		return 0, nil
+	}
+
+	interval := monitoring.PollInterval.Duration
+	if last := nso.Status.LastPollTime; last != nil {
+		if wait := time.Until(last.Add(interval)); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	// A replica that does not answer does not hold the poll of the others
+	// past the deadline, it is reported as failed
+	pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+	statuses := make([]orchestrationciscocomv1alpha1.ReplicaStatus, nso.Spec.Replicas)
+	errs := make([]error, nso.Spec.Replicas)
+	var wg sync.WaitGroup
+	for ordinal := range nso.Spec.Replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[ordinal], errs[ordinal] = r.pollReplica(pollCtx, nso, fmt.Sprintf("%s-%d", nso.Name, ordinal))
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+	now := metav1.Now()
+	nso.Status.ReplicaStatuses = statuses
+	nso.Status.LastPollTime = &now
+	r.setPackagesHealthy(nso)
+	return interval, nil
+}
+
+// Returns the NSO version and packages of the pod, or why they could not be
+// read. Only the failures to read the pod itself are returned as errors.
+func (r *NSOReconciler) pollReplica(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, name string) (orchestrationciscocomv1alpha1.ReplicaStatus, error) {
+	status := orchestrationciscocomv1alpha1.ReplicaStatus{Pod: name}
+
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: nso.Namespace}, pod)
+	if errors.IsNotFound(err) {
+		status.Error = "pod not found"
+		return status, nil
+	} else if err != nil {
+		return status, err
+	}
+	if !podReady(pod) {
+		status.Error = "pod not ready"
+		return status, nil
+	}
+
+	restconf, err := r.NSOClient(ctx, nso, name)
+	if err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+	if status.Version, err = restconf.Version(ctx); err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+	packages, err := restconf.Packages(ctx)
+	if err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+	for _, pkg := range packages {
+		status.Packages = append(status.Packages, orchestrationciscocomv1alpha1.PackageStatus{
+			Name:       pkg.Name,
+			Version:    pkg.Version,
+			OperStatus: pkg.OperStatus,
+			ErrorInfo:  pkg.ErrorInfo,
+		})
+	}
+	return status, nil
+}
+
+// Function to set the PackagesHealthy condition from the last poll of the
+// replicas. A Warning Event is recorded when packages stop being up.
+func (r *NSOReconciler) setPackagesHealthy(nso *orchestrationciscocomv1alpha1.NSO) {
+	var notUp, failed []string
+	for _, replica := range nso.Status.ReplicaStatuses {
+		if replica.Error != "" {
+			failed = append(failed, fmt.Sprintf("pod %s: %s", replica.Pod, replica.Error))
+			continue
+		}
+		for _, pkg := range replica.Packages {
+			if pkg.OperStatus != nsoclient.OperStatusUp {
+				notUp = append(notUp, fmt.Sprintf("%s on pod %s (%s)", pkg.Name, replica.Pod, pkg.OperStatus))
+			}
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionPackagesHealthy,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonPackagesUp,
+		Message:            fmt.Sprintf("All packages are up on the %d replicas", len(nso.Status.ReplicaStatuses)),
+		ObservedGeneration: nso.Generation,
+	}
+	switch {
+	case len(notUp) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonPackagesNotUp
+		condition.Message = "Packages not up: " + strings.Join(notUp, "; ")
+	case len(failed) > 0:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonPollFailed
+		condition.Message = "Failed to poll the replicas: " + strings.Join(failed, "; ")
+	}
+
+	previous := meta.FindStatusCondition(nso.Status.Conditions, condition.Type)
+	if condition.Status == metav1.ConditionFalse && (previous == nil || previous.Status != metav1.ConditionFalse) {
+		r.recordEvent(nso, corev1.EventTypeWarning, condition.Reason, condition.Message)
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, condition)
+}
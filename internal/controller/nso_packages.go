@@ -0,0 +1,110 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const (
+	// Directory NSO loads its packages from, ${NCS_RUN_DIR}/packages in the
+	// NSO container images
+	nsoPackagesDir = "/nso/run/packages"
+
+	// Reason of the Event recorded when two bundles hold the same package
+	reasonDuplicatePackage = "DuplicatePackage"
+)
+
+// Function to mount the packages of the PackageBundles targeting the NSO
+// into its packages directory, one read-only subPath mount per package. The
+// latest completed download of a bundle stays mounted while a new one is in
+// progress or failed. When two bundles hold the same package, the bundle
+// first by name wins and a Warning Event is recorded.
+func (r *NSOReconciler) mountPackageBundles(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, statefulSet *appsv1.StatefulSet) error {
+	// A namespace holds a handful of bundles, they are filtered here rather
+	// than with a field selector the API server does not support
+	bundles := &orchestrationciscocomv1alpha1.PackageBundleList{}
+	if err := r.List(ctx, bundles, client.InNamespace(nso.Namespace)); err != nil {
+		return err
+	}
+	slices.SortFunc(bundles.Items, func(a, b orchestrationciscocomv1alpha1.PackageBundle) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	podSpec := &statefulSet.Spec.Template.Spec
+	mountedBy := map[string]string{}
+	volumes := 0
+	for i := range bundles.Items {
+		bundle := &bundles.Items[i]
+		if bundle.Spec.TargetName != nso.Name || bundle.Status.StoragePath == "" || len(bundle.Status.Packages) == 0 {
+			continue
+		}
+		volumeName := fmt.Sprintf("packages-%d", volumes)
+		mounted := false
+		for _, pkg := range bundle.Status.Packages {
+			if owner, ok := mountedBy[pkg]; ok {
+				r.recordEvent(nso, corev1.EventTypeWarning, reasonDuplicatePackage,
+					fmt.Sprintf("Package %s of PackageBundle %s is ignored, it is already loaded from PackageBundle %s", pkg, bundle.Name, owner))
+				continue
+			}
+			mountedBy[pkg] = bundle.Name
+			mounted = true
+			podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+				Name:      volumeName,
+				MountPath: path.Join(nsoPackagesDir, pkg),
+				SubPath:   path.Join(bundle.Status.StoragePath, pkg),
+				ReadOnly:  true,
+			})
+		}
+		if mounted {
+			volumes++
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+				Name: volumeName,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: packagesClaimName(bundle.Name),
+						ReadOnly:  true,
+					},
+				},
+			})
+		}
+	}
+	return nil
+}
+
+// Maps PackageBundle changes to a reconcile request of the NSO they target
+func (r *NSOReconciler) watchForPackageBundleChange(_ context.Context, obj client.Object) []reconcile.Request {
+	bundle, ok := obj.(*orchestrationciscocomv1alpha1.PackageBundle)
+	if !ok || bundle.Spec.TargetName == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: bundle.Spec.TargetName, Namespace: bundle.Namespace},
+	}}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"maps"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/podtemplate"
+)
+
+// Function to patch the podTemplate override of the NSO over the StatefulSet
+// pod template and record the outcome in the PodTemplateApplied condition.
+// An invalid override leaves the template as generated and is returned.
+func applyPodTemplateOverride(nso *orchestrationciscocomv1alpha1.NSO, statefulSet *appsv1.StatefulSet) error {
+	if nso.Spec.PodTemplate == nil || len(nso.Spec.PodTemplate.Raw) == 0 {
+		meta.RemoveStatusCondition(&nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionPodTemplateApplied)
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionPodTemplateApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonOverrideApplied,
+		Message:            "The podTemplate override is applied to the NSO pods",
+		ObservedGeneration: nso.Generation,
+	}
+	template, err := podtemplate.Apply(&statefulSet.Spec.Template, nso.Spec.PodTemplate.Raw)
+	if err == nil {
+		err = podtemplate.Validate(template, protectedPodTemplate(nso, &statefulSet.Spec.Template))
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonInvalidPodTemplate
+		condition.Message = err.Error()
+	} else {
+		statefulSet.Spec.Template = *template
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, condition)
+	return err
+}
+
+// Returns what the podTemplate override can not change in the generated pod
+// template: the selector labels, the labels the operator finds the pods by,
+// the NSO container and, when pinned, its image digest
+func protectedPodTemplate(nso *orchestrationciscocomv1alpha1.NSO, template *corev1.PodTemplateSpec) podtemplate.Protected {
+	labels := maps.Clone(nso.Spec.LabelSelector)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for _, key := range []string{instanceLabel, managedByLabel} {
+		labels[key] = template.Labels[key]
+	}
+
+	protected := podtemplate.Protected{Labels: labels, Container: nsoContainerName}
+	if nso.Spec.PinImageDigest {
+		protected.Image = nsoImage(template)
+	}
+	return protected
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Waiting reasons of the containers whose image can not be pulled
+var imagePullFailureReasons = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"}
+
+// ManagedObjectsSelector returns the selector of the objects created by the
+// operator, e.g. to only cache the NSO pods
+func ManagedObjectsSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{managedByLabel: managedByValue})
+}
+
+// Returns the statuses of the containers of the pod, init containers
+// included, waiting for an image that can not be pulled
+func imagePullFailures(pod *corev1.Pod) []corev1.ContainerStatus {
+	var failures []corev1.ContainerStatus
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && slices.Contains(imagePullFailureReasons, status.State.Waiting.Reason) {
+				failures = append(failures, status)
+			}
+		}
+	}
+	return failures
+}
+
+// Returns whether the pod is ready
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Function to record in the ImagesPulled condition whether the NSO pods fail
+// to pull their images. The condition is left as it is while there are no
+// pods, e.g. before the StatefulSet created them. The pods are matched on
+// their instance label too, as the selector of the user may match the pods of
+// another NSO.
+func (r *NSOReconciler) checkImagePulls(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) error {
+	podLabels := client.MatchingLabels{instanceLabel: nso.Name, managedByLabel: managedByValue}
+	maps.Copy(podLabels, nso.Spec.LabelSelector)
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(nso.Namespace), podLabels); err != nil {
+		return err
+	}
+	if len(pods.Items) == 0 {
+		return nil
+	}
+	slices.SortFunc(pods.Items, func(a, b corev1.Pod) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var failures []string
+	for i := range pods.Items {
+		for _, status := range imagePullFailures(&pods.Items[i]) {
+			message := status.State.Waiting.Message
+			if message == "" {
+				message = status.State.Waiting.Reason
+			}
+			failures = append(failures, fmt.Sprintf("pod %s container %s: %s", pods.Items[i].Name, status.Name, message))
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionImagesPulled,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonPulled,
+		Message:            "No NSO pod is failing to pull its images",
+		ObservedGeneration: nso.Generation,
+	}
+	if len(failures) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonImagePullBackOff
+		condition.Message = "Failed to pull images, check the image and imagePullSecrets: " + strings.Join(failures, "; ")
+	}
+	meta.SetStatusCondition(&nso.Status.Conditions, condition)
+	return nil
+}
+
+// Maps NSO pod changes to a reconcile request of the NSO they belong to
+func (r *NSOReconciler) watchForPodChange(_ context.Context, pod client.Object) []reconcile.Request {
+	podLabels := pod.GetLabels()
+	if podLabels[managedByLabel] != managedByValue || podLabels[instanceLabel] == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: podLabels[instanceLabel], Namespace: pod.GetNamespace()},
+	}}
+}
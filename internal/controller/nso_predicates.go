@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// Drops NSO updates that only touch the status or other fields the
+// reconciler does not act on. Spec changes bump the generation, annotation
+// changes are kept for operator annotations set on the NSO.
+func nsoChangedPredicate() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.AnnotationChangedPredicate{},
+	)
+}
+
+// Only lets through StatefulSet updates that change its spec or the parts of
+// its status the reconciler reports on, dropping the frequent no-op status
+// writes of the StatefulSet controller.
+func statefulSetChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldStatefulSet, ok := e.ObjectOld.(*appsv1.StatefulSet)
+			if !ok {
+				return true
+			}
+			newStatefulSet, ok := e.ObjectNew.(*appsv1.StatefulSet)
+			if !ok {
+				return true
+			}
+
+			if oldStatefulSet.Generation != newStatefulSet.Generation ||
+				!newStatefulSet.DeletionTimestamp.IsZero() {
+				return true
+			}
+
+			oldStatus, newStatus := oldStatefulSet.Status, newStatefulSet.Status
+			return oldStatus.ObservedGeneration != newStatus.ObservedGeneration ||
+				oldStatus.Replicas != newStatus.Replicas ||
+				oldStatus.ReadyReplicas != newStatus.ReadyReplicas ||
+				oldStatus.AvailableReplicas != newStatus.AvailableReplicas ||
+				oldStatus.CurrentReplicas != newStatus.CurrentReplicas ||
+				oldStatus.UpdatedReplicas != newStatus.UpdatedReplicas ||
+				oldStatus.CurrentRevision != newStatus.CurrentRevision ||
+				oldStatus.UpdateRevision != newStatus.UpdateRevision
+		},
+	}
+}
+
+// Only lets through ConfigMap and Secret updates that change their data,
+// dropping resourceVersion bumps caused by metadata updates.
+func dataChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return cachedDataHash(e.ObjectOld) != cachedDataHash(e.ObjectNew)
+		},
+	}
+}
+
+// Only lets through pod updates that change whether the pod is ready or which
+// containers can not pull their image, dropping the other pod status updates.
+// Readiness moves the upgrades, restarts and polls waiting on a replica.
+func podChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPod, ok := e.ObjectOld.(*corev1.Pod)
+			if !ok {
+				return true
+			}
+			newPod, ok := e.ObjectNew.(*corev1.Pod)
+			if !ok {
+				return true
+			}
+			return podReady(oldPod) != podReady(newPod) ||
+				!slices.Equal(failingContainers(oldPod), failingContainers(newPod))
+		},
+	}
+}
+
+// Returns the names of the containers of the pod that can not pull their image
+func failingContainers(pod *corev1.Pod) []string {
+	var names []string
+	for _, status := range imagePullFailures(pod) {
+		names = append(names, status.Name)
+	}
+	return names
+}
+
+// Only lets through objects in the namespaces the reconciler watches
+func (r *NSOReconciler) watchedNamespacePredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return r.watchesNamespace(obj.GetNamespace())
+	})
+}
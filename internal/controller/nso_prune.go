@@ -0,0 +1,107 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Event reasons for pruned objects
+const (
+	eventReasonPruned     = "Pruned"
+	eventReasonWouldPrune = "WouldPrune"
+)
+
+// Returns empty lists of every kind of object the operator creates for an NSO
+func ownedObjectLists() []client.ObjectList {
+	return []client.ObjectList{
+		&corev1.ServiceList{},
+		&appsv1.StatefulSetList{},
+	}
+}
+
+// Function to delete the objects created for the NSO that are no longer part
+// of its desired set. Only objects controlled by the NSO and carrying the
+// managed-by label are considered, so adopted objects that were never
+// converged are left alone. With the prune dry-run annotation set, the
+// objects are only reported in the status, and with an Event when they become
+// stale.
+func (r *NSOReconciler) pruneObjects(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, desiredObjects ...client.Object) error {
+	log := logf.FromContext(ctx)
+	dryRun := nso.Annotations[orchestrationciscocomv1alpha1.PruneDryRunAnnotation] == "true"
+	var stale []string
+
+	desired := map[string]bool{}
+	for _, obj := range desiredObjects {
+		desired[objectKind(obj)+"/"+obj.GetName()] = true
+	}
+
+	for _, list := range ownedObjectLists() {
+		err := r.List(ctx, list,
+			client.InNamespace(nso.Namespace),
+			client.MatchingLabels{managedByLabel: managedByValue},
+		)
+		if err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok || !metav1.IsControlledBy(obj, nso) || desired[objectKind(obj)+"/"+obj.GetName()] {
+				continue
+			}
+
+			name := objectKind(obj) + " " + obj.GetName()
+			if dryRun {
+				stale = append(stale, name)
+				if !slices.Contains(nso.Status.StaleObjects, name) {
+					log.Info("Stale resource would be pruned", "kind", objectKind(obj), "name", obj.GetName())
+					r.recordEvent(nso, corev1.EventTypeNormal, eventReasonWouldPrune,
+						fmt.Sprintf("%s is no longer part of the NSO and would be deleted", name))
+				}
+				continue
+			}
+
+			log.Info("Pruning stale resource", "kind", objectKind(obj), "name", obj.GetName())
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s: %w", name, err)
+			}
+			r.recordEvent(nso, corev1.EventTypeNormal, eventReasonPruned,
+				fmt.Sprintf("Deleted %s, which is no longer part of the NSO", name))
+		}
+	}
+
+	slices.Sort(stale)
+	nso.Status.StaleObjects = stale
+	return nil
+}
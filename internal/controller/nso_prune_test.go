@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Returns a reconciler holding an NSO with the annotations, the Service left
+// behind by its previous serviceName and a Service it owns that the operator
+// did not create
+func newPruneReconciler(t *testing.T, annotations map[string]string) (*NSOReconciler, *record.FakeRecorder) {
+	ctx := context.Background()
+	nso := newTestNSO("nso-renamed", 1)
+	nso.UID = "nso-renamed-uid"
+	nso.Annotations = annotations
+	nso.Spec.ServiceName = "nso-renamed-svc"
+	nso.Spec.Ports = []corev1.ServicePort{{Name: "http", Port: 8080}}
+	nso.Spec.AdminCredentials = orchestrationciscocomv1alpha1.Credentials{
+		Username:          "admin",
+		PasswordSecretRef: "nso-admin",
+	}
+
+	builder := &NSOReconciler{Scheme: newTestScheme(t)}
+	oldService := builder.serviceForNSO(nso, ctx)
+	oldService.Name = "nso-old-svc"
+	unmanagedService := builder.serviceForNSO(nso, ctx)
+	unmanagedService.Name = "nso-unmanaged-svc"
+	delete(unmanagedService.Labels, managedByLabel)
+
+	r := newTestReconciler(t, nso, oldService, unmanagedService)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	return r, recorder
+}
+
+func TestPruneObjects(t *testing.T) {
+	ctx := context.Background()
+	key := client.ObjectKey{Name: "nso-renamed", Namespace: testNamespace}
+
+	service := func(name string) client.ObjectKey {
+		return client.ObjectKey{Name: name, Namespace: testNamespace}
+	}
+
+	t.Run("deletes the Service left behind by a serviceName change", func(t *testing.T) {
+		g := NewWithT(t)
+		r, recorder := newPruneReconciler(t, nil)
+		nso := &orchestrationciscocomv1alpha1.NSO{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		reconcileNSO(g, r, nso)
+
+		g.Expect(r.Get(ctx, service("nso-renamed-svc"), &corev1.Service{})).To(Succeed())
+		g.Expect(errors.IsNotFound(r.Get(ctx, service("nso-old-svc"), &corev1.Service{}))).To(BeTrue())
+		g.Expect(r.Get(ctx, service("nso-unmanaged-svc"), &corev1.Service{})).To(Succeed())
+		g.Expect(recorder.Events).To(Receive(Equal("Normal Pruned Deleted Service nso-old-svc, which is no longer part of the NSO")))
+		g.Expect(recorder.Events).NotTo(Receive())
+	})
+
+	t.Run("only reports the stale objects in dry-run mode", func(t *testing.T) {
+		g := NewWithT(t)
+		r, recorder := newPruneReconciler(t, map[string]string{
+			orchestrationciscocomv1alpha1.PruneDryRunAnnotation: "true",
+		})
+		nso := &orchestrationciscocomv1alpha1.NSO{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		reconcileNSO(g, r, nso)
+
+		g.Expect(r.Get(ctx, service("nso-old-svc"), &corev1.Service{})).To(Succeed())
+		g.Expect(recorder.Events).To(Receive(Equal("Normal WouldPrune Service nso-old-svc is no longer part of the NSO and would be deleted")))
+		g.Expect(nso.Status.StaleObjects).To(Equal([]string{"Service nso-old-svc"}))
+
+		// The same objects are not reported again
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(recorder.Events).NotTo(Receive(HavePrefix("Normal WouldPrune")))
+
+		// The list is cleared once the dry-run annotation is removed
+		g.Expect(r.Get(ctx, key, nso)).To(Succeed())
+		nso.Annotations = nil
+		g.Expect(r.Update(ctx, nso)).To(Succeed())
+		reconcileNSO(g, r, nso)
+		g.Expect(nso.Status.StaleObjects).To(BeEmpty())
+		g.Expect(recorder.Events).To(Receive(Equal("Normal Pruned Deleted Service nso-old-svc, which is no longer part of the NSO")))
+	})
+}
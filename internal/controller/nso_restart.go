@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const (
+	// Pod template annotation holding the restartedAt time of the NSO spec
+	restartedAtAnnotation = "nso.orchestration.cisco.com/restartedAt"
+
+	// Delay before checking the progress of a rolling restart again
+	restartCheckInterval = 10 * time.Second
+)
+
+// Returns whether an upgrade of the NSO version is being rolled out or back
+func upgradeInProgress(nso *orchestrationciscocomv1alpha1.NSO) bool {
+	return nso.Status.Upgrade != nil && nso.Status.Upgrade.Phase != orchestrationciscocomv1alpha1.UpgradePhaseRolledBack
+}
+
+// Function to restart the NSO pods one at a time when restartedAt changes.
+// The new time is set in the pod template and the StatefulSet partition
+// moved down one replica at a time, from the highest ordinal down, once the
+// restarted pod is ready and runs NSO with all its packages up. The restart
+// waits for an upgrade in progress to finish. The desired StatefulSet is
+// changed to match the replica being restarted, and the progress is recorded
+// in the status and the Restarting condition. Returns the delay before
+// checking the progress.
+func (r *NSOReconciler) orchestrateRestart(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, statefulSet *appsv1.StatefulSet) (time.Duration, error) {
+	log := logf.FromContext(ctx)
+
+	requested := ""
+	if nso.Spec.RestartedAt != nil {
+		requested = nso.Spec.RestartedAt.UTC().Format(time.RFC3339)
+	}
+
+	existing := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: statefulSet.Name, Namespace: statefulSet.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		nso.Status.Restart = nil
+		setRestartedAt(&statefulSet.Spec.Template, requested)
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Pods are only restarted when restartedAt changes, not when it is
+	// removed
+	applied := existing.Spec.Template.Annotations[restartedAtAnnotation]
+	if requested == "" {
+		nso.Status.Restart = nil
+		meta.RemoveStatusCondition(&nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionRestarting)
+		setRestartedAt(&statefulSet.Spec.Template, applied)
+		return 0, nil
+	}
+	if upgradeInProgress(nso) {
+		setRestartedAt(&statefulSet.Spec.Template, applied)
+		if applied != requested {
+			return restartCheckInterval, nil
+		}
+		return 0, nil
+	}
+
+	restart := nso.Status.Restart
+	if restart == nil || !restart.RestartedAt.Equal(nso.Spec.RestartedAt) {
+		if applied == requested || nso.Spec.Replicas == 0 {
+			nso.Status.Restart = nil
+			setRestartedAt(&statefulSet.Spec.Template, requested)
+			return 0, nil
+		}
+		log.Info("Restarting NSO", "restartedAt", requested)
+		r.recordEvent(nso, corev1.EventTypeNormal, "RestartStarted",
+			fmt.Sprintf("Restarting the NSO pods one at a time for restartedAt %s", requested))
+		nso.Status.Restart = &orchestrationciscocomv1alpha1.RestartStatus{
+			RestartedAt:      *nso.Spec.RestartedAt,
+			Replica:          nso.Spec.Replicas - 1,
+			ReplicaStartTime: metav1.Now(),
+		}
+		setRestartingCondition(nso, fmt.Sprintf("Restarting pod %s-%d", nso.Name, nso.Spec.Replicas-1))
+	} else if applied == requested {
+		r.advanceRestart(ctx, nso, existing)
+	}
+
+	setRestartedAt(&statefulSet.Spec.Template, requested)
+	if restart := nso.Status.Restart; restart != nil {
+		statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: ptr.To(restart.Replica)},
+		}
+		return restartCheckInterval, nil
+	}
+	return 0, nil
+}
+
+// Function to move the restart to the next replica once the replica being
+// restarted is ready and runs NSO with all its packages up
+func (r *NSOReconciler) advanceRestart(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, existing *appsv1.StatefulSet) {
+	log := logf.FromContext(ctx)
+	restart := nso.Status.Restart
+	pod := fmt.Sprintf("%s-%d", nso.Name, restart.Replica)
+
+	updated, err := r.replicaUpdated(ctx, nso, existing, pod)
+	if err != nil {
+		setRestartingCondition(nso, fmt.Sprintf("Failed to check pod %s: %v", pod, err))
+		return
+	}
+	if !updated {
+		setRestartingCondition(nso, fmt.Sprintf("Waiting for pod %s to restart and be ready", pod))
+		return
+	}
+	notUp, err := r.packagesNotUp(ctx, nso, pod)
+	if err != nil {
+		setRestartingCondition(nso, fmt.Sprintf("Waiting for NSO on pod %s: failed to check its packages: %v", pod, err))
+		return
+	}
+	if len(notUp) > 0 {
+		setRestartingCondition(nso, fmt.Sprintf("Waiting for NSO on pod %s: packages not up: %s", pod, strings.Join(notUp, ", ")))
+		return
+	}
+
+	log.Info("NSO replica restarted", "pod", pod)
+	if restart.Replica == 0 {
+		message := fmt.Sprintf("Restarted the NSO pods for restartedAt %s", restart.RestartedAt.UTC().Format(time.RFC3339))
+		r.recordEvent(nso, corev1.EventTypeNormal, "RestartCompleted", message)
+		nso.Status.Restart = nil
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionRestarting,
+			Status:             metav1.ConditionFalse,
+			Reason:             orchestrationciscocomv1alpha1.ReasonRestartCompleted,
+			Message:            message,
+			ObservedGeneration: nso.Generation,
+		})
+		return
+	}
+	restart.Replica--
+	restart.ReplicaStartTime = metav1.Now()
+	setRestartingCondition(nso, fmt.Sprintf("Restarting pod %s-%d", nso.Name, restart.Replica))
+}
+
+// Function to record the progress of the restart in the Restarting condition
+func setRestartingCondition(nso *orchestrationciscocomv1alpha1.NSO, message string) {
+	meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionRestarting,
+		Status:             metav1.ConditionTrue,
+		Reason:             orchestrationciscocomv1alpha1.ReasonRestartingReplica,
+		Message:            message,
+		ObservedGeneration: nso.Generation,
+	})
+}
+
+// Function to set the restartedAt annotation of the pod template, nothing is
+// set for an empty time
+func setRestartedAt(template *corev1.PodTemplateSpec, restartedAt string) {
+	if restartedAt != "" {
+		metav1.SetMetaDataAnnotation(&template.ObjectMeta, restartedAtAnnotation, restartedAt)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// restartFixture holds an NSO with two ready replicas, whose packages are
+// checked through RESTCONF while the polling of the replicas is disabled
+type restartFixture struct {
+	g           Gomega
+	r           *NSOReconciler
+	nso         *orchestrationciscocomv1alpha1.NSO
+	packages    packageServers
+	statefulSet *fakeStatefulSetController
+}
+
+func newRestartFixture(t *testing.T) *restartFixture {
+	f := &restartFixture{g: NewWithT(t)}
+	f.nso = newTestNSO("nso-restart", 2)
+	f.nso.Spec.Monitoring = &orchestrationciscocomv1alpha1.MonitoringSpec{Disabled: true}
+	f.r = newTestReconciler(t, f.nso)
+	f.packages = newPackageServers(t, f.r, f.nso)
+	f.statefulSet = newFakeStatefulSetController(f.g, f.r, f.nso)
+
+	f.reconcile()
+	f.statefulSet.rollOut(0, 1)
+	return f
+}
+
+func (f *restartFixture) reconcile() time.Duration {
+	return reconcileNSO(f.g, f.r, f.nso).RequeueAfter
+}
+
+// Sets or clears restartedAt
+func (f *restartFixture) restartAt(restartedAt *metav1.Time) {
+	f.nso.Spec.RestartedAt = restartedAt
+	f.g.Expect(f.r.Update(context.Background(), f.nso)).To(Succeed())
+}
+
+func (f *restartFixture) restarting() *metav1.Condition {
+	condition := meta.FindStatusCondition(f.nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionRestarting)
+	f.g.Expect(condition).NotTo(BeNil())
+	return condition
+}
+
+func TestRestart(t *testing.T) {
+	restartedAt := metav1.NewTime(time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC))
+
+	t.Run("restarts one replica at a time once NSO is up on the previous one", func(t *testing.T) {
+		f := newRestartFixture(t)
+		g := f.g
+		f.restartAt(&restartedAt)
+
+		// The highest replica restarts first
+		g.Expect(f.reconcile()).To(Equal(restartCheckInterval))
+		g.Expect(f.nso.Status.Restart.Replica).To(Equal(int32(1)))
+		g.Expect(f.restarting().Message).To(Equal("Restarting pod nso-restart-1"))
+		statefulSet := f.statefulSet.get()
+		g.Expect(statefulSet.Spec.Template.Annotations).To(HaveKeyWithValue(restartedAtAnnotation, "2025-06-02T10:00:00Z"))
+		g.Expect(f.statefulSet.partition()).To(Equal(int32(1)))
+
+		// NSO has to be up on the restarted replica
+		f.packages.setPackagesUp(false)
+		f.statefulSet.rollOut(1)
+		f.reconcile()
+		g.Expect(f.nso.Status.Restart.Replica).To(Equal(int32(1)))
+		g.Expect(f.restarting().Message).To(Equal("Waiting for NSO on pod nso-restart-1: packages not up: l3vpn"))
+
+		// The restart then moves to the next replica
+		f.packages.setPackagesUp(true)
+		f.reconcile()
+		g.Expect(f.nso.Status.Restart.Replica).To(Equal(int32(0)))
+		g.Expect(f.statefulSet.partition()).To(Equal(int32(0)))
+
+		// The restart completes once every replica is up
+		f.reconcile()
+		g.Expect(f.restarting().Message).To(Equal("Waiting for pod nso-restart-0 to restart and be ready"))
+		f.statefulSet.rollOut(0)
+		f.reconcile()
+		g.Expect(f.nso.Status.Restart).To(BeNil())
+		g.Expect(f.restarting().Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(f.restarting().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonRestartCompleted))
+		g.Expect(f.statefulSet.get().Spec.UpdateStrategy.RollingUpdate).To(BeNil())
+		g.Expect(f.packages.requests("nso-restart-1")).To(Equal(2))
+		g.Expect(f.packages.requests("nso-restart-0")).To(Equal(1))
+	})
+
+	t.Run("does not restart the pods when restartedAt is removed", func(t *testing.T) {
+		f := newRestartFixture(t)
+		g := f.g
+		f.restartAt(&restartedAt)
+		f.reconcile()
+		f.statefulSet.rollOut(1)
+		f.reconcile()
+		f.statefulSet.rollOut(0)
+		f.reconcile()
+		g.Expect(f.nso.Status.Restart).To(BeNil())
+
+		f.restartAt(nil)
+		f.reconcile()
+		g.Expect(f.nso.Status.Restart).To(BeNil())
+		g.Expect(f.statefulSet.get().Spec.Template.Annotations).To(HaveKeyWithValue(restartedAtAnnotation, "2025-06-02T10:00:00Z"))
+	})
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Delay before checking the canary replicas of a promotion again
+const promoteCheckInterval = 10 * time.Second
+
+// Returns the RollingUpdate partition of the NSO update strategy, nil when
+// it has none
+func specPartition(nso *orchestrationciscocomv1alpha1.NSO) *int32 {
+	strategy := nso.Spec.UpdateStrategy
+	if strategy == nil || strategy.Type == appsv1.OnDeleteStatefulSetStrategyType || strategy.RollingUpdate == nil {
+		return nil
+	}
+	return strategy.RollingUpdate.Partition
+}
+
+// Function to move the partition of the NSO update strategy down to the
+// ordinal of the PromoteAnnotation once the canaries, the replicas from the
+// current partition up, run the latest template and are ready. The NSO spec
+// is patched with the new partition and the annotation removed. A request
+// that can not be honoured is reported in a Warning Event and removed.
+// Returns the delay before checking the canaries again.
+func (r *NSOReconciler) promoteRollout(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) (time.Duration, error) {
+	log := logf.FromContext(ctx)
+
+	value, requested := nso.Annotations[orchestrationciscocomv1alpha1.PromoteAnnotation]
+	if !requested {
+		return 0, nil
+	}
+
+	current := specPartition(nso)
+	target, err := strconv.ParseInt(value, 10, 32)
+	var problem string
+	switch {
+	case current == nil:
+		problem = "the updateStrategy has no RollingUpdate partition"
+	case err != nil || target < 0:
+		problem = fmt.Sprintf("%q is not a replica ordinal", value)
+	case int32(target) >= *current:
+		problem = fmt.Sprintf("ordinal %d is not below the partition %d", target, *current)
+	case upgradeInProgress(nso):
+		problem = "the partition is managed by the upgrade in progress"
+	case nso.Status.Restart != nil:
+		problem = "the partition is managed by the restart in progress"
+	}
+	if problem != "" {
+		log.Info("Ignoring the promotion request", "reason", problem)
+		r.recordEvent(nso, corev1.EventTypeWarning, "PromotionRejected",
+			fmt.Sprintf("Ignoring the %s annotation: %s", orchestrationciscocomv1alpha1.PromoteAnnotation, problem))
+		return 0, r.promote(ctx, nso, nil)
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
+	err = r.Get(ctx, types.NamespacedName{Name: nso.Name, Namespace: nso.Namespace}, statefulSet)
+	if errors.IsNotFound(err) {
+		return promoteCheckInterval, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var canaries []string
+	for ordinal := *current; ordinal < nso.Spec.Replicas; ordinal++ {
+		pod := fmt.Sprintf("%s-%d", nso.Name, ordinal)
+		updated, err := r.replicaUpdated(ctx, nso, statefulSet, pod)
+		if err != nil {
+			return 0, err
+		}
+		if !updated {
+			log.Info("Waiting for the canary to run the latest template and be ready before promoting", "pod", pod)
+			return promoteCheckInterval, nil
+		}
+		canaries = append(canaries, pod)
+	}
+
+	log.Info("Promoting the rollout", "from", *current, "to", target)
+	message := fmt.Sprintf("Moved the partition from %d to %d", *current, target)
+	if len(canaries) > 0 {
+		message += ", canaries " + strings.Join(canaries, ", ") + " are ready"
+	}
+	r.recordEvent(nso, corev1.EventTypeNormal, "Promoted", message)
+	return 0, r.promote(ctx, nso, ptr.To(int32(target)))
+}
+
+// Function to remove the PromoteAnnotation from the NSO and, when given, to
+// set the partition of its update strategy. The patch response holds the
+// stored status, the current one is kept.
+func (r *NSOReconciler) promote(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, partition *int32) error {
+	status := nso.Status.DeepCopy()
+	patch := client.MergeFrom(nso.DeepCopy())
+	delete(nso.Annotations, orchestrationciscocomv1alpha1.PromoteAnnotation)
+	if partition != nil {
+		nso.Spec.UpdateStrategy.RollingUpdate.Partition = partition
+	}
+	if err := r.Patch(ctx, nso, patch); err != nil {
+		return err
+	}
+	nso.Status = *status
+	return nil
+}
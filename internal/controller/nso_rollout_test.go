@@ -0,0 +1,103 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Returns a reconciler holding an NSO with three replicas, rolling out to the
+// last one as canary, once reconciled
+func newRolloutReconciler(t *testing.T, g Gomega) (*NSOReconciler, *orchestrationciscocomv1alpha1.NSO, *record.FakeRecorder) {
+	nso := newTestNSO("nso-canary", 3)
+	nso.Spec.UpdateStrategy = &appsv1.StatefulSetUpdateStrategy{
+		Type: appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+			Partition:      ptr.To(int32(2)),
+			MaxUnavailable: ptr.To(intstr.FromInt32(1)),
+		},
+	}
+	nso.Spec.PodManagementPolicy = appsv1.ParallelPodManagement
+
+	r := newTestReconciler(t, nso)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	reconcileNSO(g, r, nso)
+	return r, nso, recorder
+}
+
+func TestStagedRollout(t *testing.T) {
+	ctx := context.Background()
+
+	promote := func(g Gomega, r *NSOReconciler, nso *orchestrationciscocomv1alpha1.NSO, ordinal string) {
+		nso.Annotations = map[string]string{orchestrationciscocomv1alpha1.PromoteAnnotation: ordinal}
+		g.Expect(r.Update(ctx, nso)).To(Succeed())
+	}
+
+	t.Run("applies the update strategy and pod management policy to the StatefulSet", func(t *testing.T) {
+		g := NewWithT(t)
+		r, nso, _ := newRolloutReconciler(t, g)
+
+		statefulSet := newFakeStatefulSetController(g, r, nso).get()
+		g.Expect(statefulSet.Spec.UpdateStrategy).To(Equal(*nso.Spec.UpdateStrategy))
+		g.Expect(statefulSet.Spec.PodManagementPolicy).To(Equal(appsv1.ParallelPodManagement))
+	})
+
+	t.Run("moves the partition down once the canary is ready", func(t *testing.T) {
+		g := NewWithT(t)
+		r, nso, recorder := newRolloutReconciler(t, g)
+		statefulSet := newFakeStatefulSetController(g, r, nso)
+		promote(g, r, nso, "0")
+
+		// The canary has to run the new template first
+		result := reconcileNSO(g, r, nso)
+		g.Expect(result.RequeueAfter).To(Equal(promoteCheckInterval))
+		g.Expect(nso.Annotations).To(HaveKey(orchestrationciscocomv1alpha1.PromoteAnnotation))
+		g.Expect(*nso.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(2)))
+
+		// The rollout is then promoted to the other replicas
+		statefulSet.rollOut(2)
+		reconcileNSO(g, r, nso)
+		g.Expect(nso.Annotations).NotTo(HaveKey(orchestrationciscocomv1alpha1.PromoteAnnotation))
+		g.Expect(*nso.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(0)))
+		g.Expect(recorder.Events).To(Receive(Equal("Normal Promoted Moved the partition from 2 to 0, canaries nso-canary-2 are ready")))
+
+		reconcileNSO(g, r, nso)
+		g.Expect(statefulSet.partition()).To(Equal(int32(0)))
+	})
+
+	t.Run("rejects a promotion that does not move the partition down", func(t *testing.T) {
+		g := NewWithT(t)
+		r, nso, recorder := newRolloutReconciler(t, g)
+		promote(g, r, nso, "2")
+
+		reconcileNSO(g, r, nso)
+		g.Expect(nso.Annotations).NotTo(HaveKey(orchestrationciscocomv1alpha1.PromoteAnnotation))
+		g.Expect(*nso.Spec.UpdateStrategy.RollingUpdate.Partition).To(Equal(int32(2)))
+		g.Expect(recorder.Events).To(Receive(Equal("Warning PromotionRejected Ignoring the " +
+			orchestrationciscocomv1alpha1.PromoteAnnotation + " annotation: ordinal 2 is not below the partition 2")))
+	})
+}
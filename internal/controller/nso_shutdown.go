@@ -0,0 +1,50 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// Script run before the NSO container is stopped. It puts NSO in read-only
+// mode so that no new northbound write transaction is accepted, waits for the
+// commit queue to be empty for up to the number of seconds given as $1, then
+// stops NSO. The admin user is the one the operator sets in the NSO container
+// environment.
+const preStopScript = `cli() { ncs_cli -C -u "$ADMIN_USERNAME"; }
+echo 'high-availability read-only mode true' | cli
+deadline=$(( $(date +%s) + $1 ))
+while [ "$(date +%s)" -lt "$deadline" ]; do
+  items=$(echo 'show devices commit-queue queue-item | count' | cli | grep -o '[0-9]\+' | head -n 1)
+  [ "${items:-0}" -eq 0 ] && break
+  sleep 2
+done
+ncs --stop`
+
+// Returns the preStop hook draining the commit queue before stopping NSO
+func preStopHandler(nso *orchestrationciscocomv1alpha1.NSO) *corev1.LifecycleHandler {
+	drainSeconds := int64(nso.Spec.CommitQueueDrainTimeout.Seconds())
+	return &corev1.LifecycleHandler{
+		Exec: &corev1.ExecAction{
+			Command: []string{"sh", "-c", preStopScript, "pre-stop", fmt.Sprint(drainSeconds)},
+		},
+	}
+}
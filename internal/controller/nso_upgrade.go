@@ -0,0 +1,407 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+const (
+	// Name of the init container restoring the backups of a rolled back upgrade
+	restoreContainerName = "restore-backup"
+
+	// Delay before checking the progress of an upgrade again
+	upgradeCheckInterval = 10 * time.Second
+	// Time allowed to list the packages of an upgraded replica
+	packagesCheckTimeout = time.Minute
+)
+
+// Returns the image reference without its digest, which identifies the NSO
+// version. Pinning the same image to a new digest is not an upgrade.
+func imageWithoutDigest(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i]
+	}
+	return image
+}
+
+// Returns the image of the NSO container of the pod template
+func nsoImage(template *corev1.PodTemplateSpec) string {
+	for _, container := range template.Spec.Containers {
+		if container.Name == nsoContainerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// Function to roll a new NSO version out one replica at a time when the NSO
+// has an upgrade spec. Each replica, from the highest ordinal down, is backed
+// up, restarted with the new image through the StatefulSet partition and its
+// packages checked. A replica failing to do so within the replica timeout
+// rolls the upgrade back: the previous image runs again and the upgraded
+// replicas restore their backup. The desired StatefulSet is changed to match
+// the step the upgrade is at, and the progress is recorded in the status and
+// the Upgrading condition. Returns the delay before checking the progress.
+func (r *NSOReconciler) orchestrateUpgrade(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, statefulSet *appsv1.StatefulSet) (time.Duration, error) {
+	log := logf.FromContext(ctx)
+
+	if nso.Spec.Upgrade == nil {
+		nso.Status.Upgrade = nil
+		meta.RemoveStatusCondition(&nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionUpgrading)
+		return 0, nil
+	}
+
+	existing := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: statefulSet.Name, Namespace: statefulSet.Namespace}, existing)
+	if errors.IsNotFound(err) {
+		nso.Status.Upgrade = nil
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	// A rolled back upgrade is over once the image changes again
+	upgrade := nso.Status.Upgrade
+	desired := nsoImage(&statefulSet.Spec.Template)
+	if upgrade != nil && upgrade.Phase == orchestrationciscocomv1alpha1.UpgradePhaseRolledBack &&
+		imageWithoutDigest(desired) != imageWithoutDigest(upgrade.ToImage) {
+		upgrade = nil
+	}
+
+	if upgrade == nil {
+		current := nsoImage(&existing.Spec.Template)
+		if current == "" || nso.Spec.Replicas == 0 || imageWithoutDigest(current) == imageWithoutDigest(desired) {
+			nso.Status.Upgrade = nil
+			return 0, nil
+		}
+		// Wait for the rolling restart in progress to finish
+		if nso.Status.Restart != nil {
+			setNSOImage(&statefulSet.Spec.Template, current)
+			return upgradeCheckInterval, nil
+		}
+		log.Info("Upgrading NSO", "from", current, "to", desired)
+		r.recordEvent(nso, corev1.EventTypeNormal, "UpgradeStarted", fmt.Sprintf("Upgrading from %s to %s", current, desired))
+		upgrade = &orchestrationciscocomv1alpha1.UpgradeStatus{
+			Phase:            orchestrationciscocomv1alpha1.UpgradePhaseBackingUp,
+			FromImage:        current,
+			ToImage:          desired,
+			Replica:          nso.Spec.Replicas - 1,
+			ReplicaStartTime: metav1.Now(),
+		}
+	}
+	nso.Status.Upgrade = upgrade
+
+	retryAfter := r.advanceUpgrade(ctx, nso, existing)
+	renderUpgrade(nso.Status.Upgrade, statefulSet)
+	return retryAfter, nil
+}
+
+// Function to move the upgrade to its next step once the current one is done,
+// or to roll it back once the replica timeout is exceeded
+func (r *NSOReconciler) advanceUpgrade(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, existing *appsv1.StatefulSet) time.Duration {
+	log := logf.FromContext(ctx)
+	upgrade := nso.Status.Upgrade
+	deadline := upgrade.ReplicaStartTime.Add(nso.Spec.Upgrade.ReplicaTimeout.Duration)
+
+	// The replica upgraded is gone after a scale down, continue with the next
+	if upgrade.Phase != orchestrationciscocomv1alpha1.UpgradePhaseRollingBack &&
+		upgrade.Phase != orchestrationciscocomv1alpha1.UpgradePhaseRolledBack && upgrade.Replica >= nso.Spec.Replicas {
+		return r.nextReplica(nso)
+	}
+	pod := fmt.Sprintf("%s-%d", nso.Name, upgrade.Replica)
+
+	switch upgrade.Phase {
+	case orchestrationciscocomv1alpha1.UpgradePhaseBackingUp:
+		setUpgradingCondition(nso, orchestrationciscocomv1alpha1.ReasonBackingUp, "Backing up pod "+pod)
+		// Keyed by the replica start time, so that a new attempt runs a new backup
+		key := fmt.Sprintf("upgrade/%s/%s@%d", nso.Namespace, pod, upgrade.ReplicaStartTime.Unix())
+		done, file, err := r.backupInBackground(ctx, key, nso.Namespace, pod, deadline)
+		if !done {
+			return upgradeCheckInterval
+		}
+		if err == nil && file == "" {
+			err = fmt.Errorf("ncs-backup did not report the backup file")
+		}
+		if err != nil {
+			return r.replicaNotUpgraded(ctx, nso, deadline, fmt.Sprintf("backup of pod %s failed: %v", pod, err))
+		}
+		log.Info("Backed up NSO replica before upgrading it", "pod", pod, "file", file)
+		upgrade.Backups = append(upgrade.Backups, orchestrationciscocomv1alpha1.ReplicaBackup{Pod: pod, File: file})
+		upgrade.Phase = orchestrationciscocomv1alpha1.UpgradePhaseRollingOut
+		setUpgradingCondition(nso, orchestrationciscocomv1alpha1.ReasonRollingOut,
+			fmt.Sprintf("Restarting pod %s with image %s", pod, upgrade.ToImage))
+		return upgradeCheckInterval
+
+	case orchestrationciscocomv1alpha1.UpgradePhaseRollingOut:
+		updated, err := r.replicaUpdated(ctx, nso, existing, pod)
+		if err != nil {
+			return r.replicaNotUpgraded(ctx, nso, deadline, err.Error())
+		}
+		if !updated {
+			return r.replicaNotUpgraded(ctx, nso, deadline,
+				fmt.Sprintf("pod %s is not running image %s and ready yet", pod, upgrade.ToImage))
+		}
+		upgrade.Phase = orchestrationciscocomv1alpha1.UpgradePhaseVerifying
+		fallthrough
+
+	case orchestrationciscocomv1alpha1.UpgradePhaseVerifying:
+		setUpgradingCondition(nso, orchestrationciscocomv1alpha1.ReasonVerifying, "Checking the packages of pod "+pod)
+		notUp, err := r.packagesNotUp(ctx, nso, pod)
+		if err != nil {
+			return r.replicaNotUpgraded(ctx, nso, deadline, fmt.Sprintf("failed to check the packages of pod %s: %v", pod, err))
+		}
+		if len(notUp) > 0 {
+			return r.replicaNotUpgraded(ctx, nso, deadline,
+				fmt.Sprintf("packages of pod %s not up: %s", pod, strings.Join(notUp, ", ")))
+		}
+		log.Info("Upgraded NSO replica", "pod", pod, "image", upgrade.ToImage)
+		return r.nextReplica(nso)
+
+	case orchestrationciscocomv1alpha1.UpgradePhaseRollingBack:
+		if !rolledBack(existing, upgrade.FromImage) {
+			setUpgradingCondition(nso, orchestrationciscocomv1alpha1.ReasonRollingBack,
+				fmt.Sprintf("Restarting the replicas with image %s and restoring their backup: %s", upgrade.FromImage, upgrade.FailureMessage))
+			return upgradeCheckInterval
+		}
+		log.Info("Rolled back NSO upgrade", "image", upgrade.FromImage)
+		upgrade.Phase = orchestrationciscocomv1alpha1.UpgradePhaseRolledBack
+		fallthrough
+
+	case orchestrationciscocomv1alpha1.UpgradePhaseRolledBack:
+		message := fmt.Sprintf("Upgrade to %s rolled back to %s: %s. Change the image to try again",
+			upgrade.ToImage, upgrade.FromImage, upgrade.FailureMessage)
+		condition := meta.FindStatusCondition(nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionUpgrading)
+		if condition == nil || condition.Reason != orchestrationciscocomv1alpha1.ReasonRolledBack {
+			r.recordEvent(nso, corev1.EventTypeWarning, "UpgradeRolledBack", message)
+		}
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionUpgrading,
+			Status:             metav1.ConditionFalse,
+			Reason:             orchestrationciscocomv1alpha1.ReasonRolledBack,
+			Message:            message,
+			ObservedGeneration: nso.Generation,
+		})
+	}
+	return 0
+}
+
+// Function to move the upgrade to the next replica, or to complete it once
+// all of them are upgraded
+func (r *NSOReconciler) nextReplica(nso *orchestrationciscocomv1alpha1.NSO) time.Duration {
+	upgrade := nso.Status.Upgrade
+	next := min(upgrade.Replica, nso.Spec.Replicas) - 1
+	if next < 0 {
+		message := fmt.Sprintf("Upgraded from %s to %s", upgrade.FromImage, upgrade.ToImage)
+		r.recordEvent(nso, corev1.EventTypeNormal, "UpgradeCompleted", message)
+		meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+			Type:               orchestrationciscocomv1alpha1.ConditionUpgrading,
+			Status:             metav1.ConditionFalse,
+			Reason:             orchestrationciscocomv1alpha1.ReasonUpgradeCompleted,
+			Message:            message,
+			ObservedGeneration: nso.Generation,
+		})
+		nso.Status.Upgrade = nil
+		return 0
+	}
+
+	upgrade.Replica = next
+	upgrade.Phase = orchestrationciscocomv1alpha1.UpgradePhaseBackingUp
+	upgrade.ReplicaStartTime = metav1.Now()
+	setUpgradingCondition(nso, orchestrationciscocomv1alpha1.ReasonBackingUp, fmt.Sprintf("Backing up pod %s-%d", nso.Name, next))
+	return time.Second
+}
+
+// Function to wait for the replica until the deadline, then to roll the
+// upgrade back
+func (r *NSOReconciler) replicaNotUpgraded(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, deadline time.Time, reason string) time.Duration {
+	upgrade := nso.Status.Upgrade
+	if time.Now().Before(deadline) {
+		setUpgradingCondition(nso, string(upgrade.Phase), fmt.Sprintf("Waiting until %s: %s", deadline.UTC().Format(time.RFC3339), reason))
+		return upgradeCheckInterval
+	}
+
+	logf.FromContext(ctx).Info("NSO replica failed to upgrade, rolling back", "reason", reason)
+	upgrade.Phase = orchestrationciscocomv1alpha1.UpgradePhaseRollingBack
+	upgrade.FailureMessage = fmt.Sprintf("replica %d not upgraded within %s, %s",
+		upgrade.Replica, nso.Spec.Upgrade.ReplicaTimeout.Duration, reason)
+	setUpgradingCondition(nso, orchestrationciscocomv1alpha1.ReasonRollingBack,
+		fmt.Sprintf("Restarting the replicas with image %s and restoring their backup: %s", upgrade.FromImage, upgrade.FailureMessage))
+	r.recordEvent(nso, corev1.EventTypeWarning, "UpgradeFailed", upgrade.FailureMessage)
+	return upgradeCheckInterval
+}
+
+// Function to record the progress of the upgrade in the Upgrading condition
+func setUpgradingCondition(nso *orchestrationciscocomv1alpha1.NSO, reason, message string) {
+	meta.SetStatusCondition(&nso.Status.Conditions, metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionUpgrading,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: nso.Generation,
+	})
+}
+
+// Returns whether the pod runs the latest revision of the StatefulSet and is
+// ready
+func (r *NSOReconciler) replicaUpdated(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, statefulSet *appsv1.StatefulSet, name string) (bool, error) {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation || statefulSet.Status.UpdateRevision == "" {
+		return false, nil
+	}
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: nso.Namespace}, pod)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if pod.Labels[appsv1.StatefulSetRevisionLabel] != statefulSet.Status.UpdateRevision {
+		return false, nil
+	}
+	return podReady(pod), nil
+}
+
+// Returns whether every replica of the StatefulSet runs the image again and
+// is ready
+func rolledBack(statefulSet *appsv1.StatefulSet, image string) bool {
+	status := statefulSet.Status
+	replicas := ptr.Deref(statefulSet.Spec.Replicas, 1)
+	return nsoImage(&statefulSet.Spec.Template) == image &&
+		status.ObservedGeneration >= statefulSet.Generation &&
+		status.UpdateRevision == status.CurrentRevision &&
+		status.UpdatedReplicas == replicas && status.ReadyReplicas == replicas
+}
+
+// Returns the names of the packages of the pod whose oper-status is not up,
+// read through RESTCONF like the PackagesHealthy condition
+func (r *NSOReconciler) packagesNotUp(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO, pod string) ([]string, error) {
+	if r.NSOClient == nil {
+		return nil, fmt.Errorf("no NSO client configured")
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, packagesCheckTimeout)
+	defer cancel()
+	restconf, err := r.NSOClient(checkCtx, nso, pod)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := restconf.Packages(checkCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var notUp []string
+	for _, pkg := range packages {
+		if !pkg.Up() {
+			notUp = append(notUp, pkg.Name)
+		}
+	}
+	return notUp, nil
+}
+
+// Function to change the desired StatefulSet to the step the upgrade is at.
+// While upgrading, the partition keeps the replicas not upgraded yet on the
+// previous image. While rolling back, every replica runs the previous image
+// and restores its backup first, whatever the update strategy of the NSO.
+func renderUpgrade(upgrade *orchestrationciscocomv1alpha1.UpgradeStatus, statefulSet *appsv1.StatefulSet) {
+	if upgrade == nil {
+		return
+	}
+
+	var partition int32
+	switch upgrade.Phase {
+	case orchestrationciscocomv1alpha1.UpgradePhaseBackingUp:
+		partition = upgrade.Replica + 1
+	case orchestrationciscocomv1alpha1.UpgradePhaseRollingOut, orchestrationciscocomv1alpha1.UpgradePhaseVerifying:
+		partition = upgrade.Replica
+	default:
+		setNSOImage(&statefulSet.Spec.Template, upgrade.FromImage)
+		addRestoreContainer(&statefulSet.Spec.Template, upgrade)
+		statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+		return
+	}
+
+	setNSOImage(&statefulSet.Spec.Template, upgrade.ToImage)
+	statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: ptr.To(partition)},
+	}
+}
+
+// Function to set the image of the NSO container and the version label of
+// the pods
+func setNSOImage(template *corev1.PodTemplateSpec, image string) {
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == nsoContainerName {
+			template.Spec.Containers[i].Image = image
+		}
+	}
+	if version := imageVersion(image); version != "" && template.Labels[versionLabel] != "" {
+		template.Labels[versionLabel] = version
+	}
+}
+
+// Function to add the init container restoring the backup of the replica
+// before NSO starts. It runs the previous image with the volumes and the
+// environment of the NSO container, and restores a backup only once.
+func addRestoreContainer(template *corev1.PodTemplateSpec, upgrade *orchestrationciscocomv1alpha1.UpgradeStatus) {
+	if len(upgrade.Backups) == 0 {
+		return
+	}
+	var ncs *corev1.Container
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == nsoContainerName {
+			ncs = &template.Spec.Containers[i]
+		}
+	}
+	if ncs == nil {
+		return
+	}
+
+	script := &strings.Builder{}
+	script.WriteString("case \"$(hostname)\" in\n")
+	for _, backup := range upgrade.Backups {
+		fmt.Fprintf(script, "  %s) backup='%s' ;;\n", backup.Pod, strings.ReplaceAll(backup.File, "'", `'\''`))
+	}
+	script.WriteString("  *) exit 0 ;;\nesac\n")
+	script.WriteString("[ -e \"$backup.restored\" ] && exit 0\n")
+	script.WriteString("ncs-backup --restore \"$backup\" --non-interactive && touch \"$backup.restored\"\n")
+
+	restore := corev1.Container{
+		Name:            restoreContainerName,
+		Image:           upgrade.FromImage,
+		ImagePullPolicy: ncs.ImagePullPolicy,
+		Command:         []string{"sh", "-c", script.String()},
+		Env:             ncs.Env,
+		EnvFrom:         ncs.EnvFrom,
+		VolumeMounts:    ncs.VolumeMounts,
+	}
+	template.Spec.InitContainers = append([]corev1.Container{restore}, template.Spec.InitContainers...)
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+// upgradeFixture holds an NSO with two ready replicas running
+// cisco-nso-prod:6.3.1 and an upgrade spec. The packages are checked through
+// RESTCONF while the polling of the replicas is disabled.
+type upgradeFixture struct {
+	g           Gomega
+	r           *NSOReconciler
+	nso         *orchestrationciscocomv1alpha1.NSO
+	executor    *fakeExecutor
+	packages    packageServers
+	statefulSet *fakeStatefulSetController
+}
+
+func newUpgradeFixture(t *testing.T) *upgradeFixture {
+	f := &upgradeFixture{g: NewWithT(t)}
+	f.nso = newTestNSO("nso-upgrade", 2)
+	f.nso.Generation = 1
+	f.nso.Spec.Monitoring = &orchestrationciscocomv1alpha1.MonitoringSpec{Disabled: true}
+	f.nso.Spec.Backup = &orchestrationciscocomv1alpha1.BackupLocation{ClaimName: "nso-backups"}
+	f.nso.Spec.Upgrade = &orchestrationciscocomv1alpha1.UpgradeSpec{
+		ReplicaTimeout: metav1.Duration{Duration: time.Hour},
+	}
+
+	f.r = newTestReconciler(t, f.nso)
+	f.executor = &fakeExecutor{stdout: func(pod string, _ []string) string {
+		return "INFO  Backup /nso/run/backups/" + pod + ".backup.gz created successfully\n"
+	}}
+	f.r.Executor = f.executor
+	f.packages = newPackageServers(t, f.r, f.nso)
+	f.statefulSet = newFakeStatefulSetController(f.g, f.r, f.nso)
+
+	f.reconcile()
+	f.statefulSet.rollOut(0, 1)
+	f.g.Expect(f.executor.commands).To(BeEmpty())
+	return f
+}
+
+func (f *upgradeFixture) reconcile() time.Duration {
+	return reconcileNSO(f.g, f.r, f.nso).RequeueAfter
+}
+
+// Changes the image of the NSO
+func (f *upgradeFixture) upgradeTo(image string) {
+	f.nso.Spec.Image = image
+	f.g.Expect(f.r.Update(context.Background(), f.nso)).To(Succeed())
+}
+
+// Reconciles until the backup running in the background completes
+func (f *upgradeFixture) backUp() {
+	f.g.Eventually(func() orchestrationciscocomv1alpha1.UpgradePhase {
+		f.reconcile()
+		return f.nso.Status.Upgrade.Phase
+	}).ShouldNot(Equal(orchestrationciscocomv1alpha1.UpgradePhaseBackingUp))
+}
+
+func (f *upgradeFixture) upgrading() *metav1.Condition {
+	condition := meta.FindStatusCondition(f.nso.Status.Conditions, orchestrationciscocomv1alpha1.ConditionUpgrading)
+	f.g.Expect(condition).NotTo(BeNil())
+	return condition
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Run("backs up, upgrades and verifies one replica at a time", func(t *testing.T) {
+		f := newUpgradeFixture(t)
+		g := f.g
+		f.upgradeTo("cisco-nso-prod:6.4")
+
+		// The highest replica is backed up before upgrading it
+		f.backUp()
+		g.Expect(f.executor.commands).To(Equal([]string{"default/nso-upgrade-1/ncs: ncs-backup"}))
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseRollingOut))
+		g.Expect(f.nso.Status.Upgrade.FromImage).To(Equal("cisco-nso-prod:6.3.1"))
+		g.Expect(f.nso.Status.Upgrade.Backups).To(Equal([]orchestrationciscocomv1alpha1.ReplicaBackup{
+			{Pod: "nso-upgrade-1", File: "/nso/run/backups/nso-upgrade-1.backup.gz"}}))
+		g.Expect(f.upgrading().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonRollingOut))
+		g.Expect(nsoImage(&f.statefulSet.get().Spec.Template)).To(Equal("cisco-nso-prod:6.4"))
+		g.Expect(f.statefulSet.partition()).To(Equal(int32(1)))
+
+		// The replica has to run the new version
+		f.statefulSet.observe()
+		f.reconcile()
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseRollingOut))
+		g.Expect(f.upgrading().Message).To(ContainSubstring("pod nso-upgrade-1 is not running image cisco-nso-prod:6.4 and ready yet"))
+
+		// Its packages are checked before moving to the next replica
+		g.Expect(f.packages.requests("nso-upgrade-1")).To(BeZero())
+		f.statefulSet.rollOut(1)
+		f.reconcile()
+		g.Expect(f.packages.requests("nso-upgrade-1")).To(Equal(1))
+		g.Expect(f.nso.Status.Upgrade.Replica).To(Equal(int32(0)))
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseBackingUp))
+		g.Expect(f.statefulSet.partition()).To(Equal(int32(1)))
+
+		f.backUp()
+		g.Expect(f.executor.commands[1]).To(Equal("default/nso-upgrade-0/ncs: ncs-backup"))
+		g.Expect(f.statefulSet.partition()).To(Equal(int32(0)))
+
+		// The upgrade completes once every replica is verified
+		f.statefulSet.rollOut(0)
+		f.reconcile()
+		g.Expect(f.nso.Status.Upgrade).To(BeNil())
+		g.Expect(f.upgrading().Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(f.upgrading().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonUpgradeCompleted))
+		g.Expect(f.statefulSet.get().Spec.UpdateStrategy.RollingUpdate).To(BeNil())
+		g.Expect(nsoImage(&f.statefulSet.get().Spec.Template)).To(Equal("cisco-nso-prod:6.4"))
+	})
+
+	t.Run("rolls back and restores the backups when a replica fails", func(t *testing.T) {
+		f := newUpgradeFixture(t)
+		g := f.g
+		f.nso.Spec.Upgrade.ReplicaTimeout = metav1.Duration{Duration: time.Nanosecond}
+		f.upgradeTo("cisco-nso-prod:6.4")
+		f.packages.setPackagesUp(false)
+
+		f.backUp()
+		f.statefulSet.rollOut(1)
+		f.reconcile()
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseRollingBack))
+		g.Expect(f.nso.Status.Upgrade.FailureMessage).To(ContainSubstring("packages of pod nso-upgrade-1 not up: l3vpn"))
+		g.Expect(f.upgrading().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonRollingBack))
+
+		// The previous image runs and restores the backup of the upgraded replica
+		f.reconcile()
+		statefulSet := f.statefulSet.get()
+		g.Expect(nsoImage(&statefulSet.Spec.Template)).To(Equal("cisco-nso-prod:6.3.1"))
+		g.Expect(statefulSet.Spec.UpdateStrategy.RollingUpdate).To(BeNil())
+		restore := statefulSet.Spec.Template.Spec.InitContainers[0]
+		g.Expect(restore.Name).To(Equal(restoreContainerName))
+		g.Expect(restore.Image).To(Equal("cisco-nso-prod:6.3.1"))
+		g.Expect(restore.Command[2]).To(ContainSubstring("nso-upgrade-1) backup='/nso/run/backups/nso-upgrade-1.backup.gz' ;;"))
+		g.Expect(restore.Command[2]).To(ContainSubstring(`ncs-backup --restore "$backup" --non-interactive`))
+
+		// The rollback is reported once the replicas are ready
+		f.statefulSet.rollOut(0, 1)
+		f.reconcile()
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseRolledBack))
+		g.Expect(f.upgrading().Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(f.upgrading().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonRolledBack))
+		g.Expect(f.upgrading().Message).To(ContainSubstring("Upgrade to cisco-nso-prod:6.4 rolled back to cisco-nso-prod:6.3.1"))
+
+		// The upgrade is tried again once the image changes
+		commands := len(f.executor.commands)
+		f.upgradeTo("cisco-nso-prod:6.4.1")
+		f.backUp()
+		g.Expect(f.executor.commands[commands]).To(Equal("default/nso-upgrade-1/ncs: ncs-backup"))
+		g.Expect(f.nso.Status.Upgrade.FromImage).To(Equal("cisco-nso-prod:6.3.1"))
+		g.Expect(f.nso.Status.Upgrade.ToImage).To(Equal("cisco-nso-prod:6.4.1"))
+	})
+
+	t.Run("does not hold the reconcile while the backup runs", func(t *testing.T) {
+		f := newUpgradeFixture(t)
+		g := f.g
+		f.executor.release = make(chan struct{})
+		f.upgradeTo("cisco-nso-prod:6.4")
+
+		g.Expect(f.reconcile()).To(Equal(upgradeCheckInterval))
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseBackingUp))
+		g.Expect(f.upgrading().Message).To(Equal("Backing up pod nso-upgrade-1"))
+		g.Expect(f.statefulSet.partition()).To(Equal(int32(2)))
+
+		// The backup is started only once
+		f.reconcile()
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseBackingUp))
+		g.Eventually(f.executor.ran).Should(Equal([]string{"default/nso-upgrade-1/ncs: ncs-backup"}))
+
+		// The replica is rolled out once the backup completes
+		close(f.executor.release)
+		f.backUp()
+		g.Expect(f.nso.Status.Upgrade.Phase).To(Equal(orchestrationciscocomv1alpha1.UpgradePhaseRollingOut))
+		g.Expect(f.executor.ran()).To(HaveLen(1))
+		g.Expect(f.nso.Status.Upgrade.Backups).To(Equal([]orchestrationciscocomv1alpha1.ReplicaBackup{
+			{Pod: "nso-upgrade-1", File: "/nso/run/backups/nso-upgrade-1.backup.gz"}}))
+	})
+
+	t.Run("rolls out image changes directly without an upgrade spec", func(t *testing.T) {
+		f := newUpgradeFixture(t)
+		g := f.g
+		f.nso.Spec.Upgrade = nil
+		f.upgradeTo("cisco-nso-prod:6.4")
+
+		f.reconcile()
+		g.Expect(f.executor.commands).To(BeEmpty())
+		g.Expect(f.nso.Status.Upgrade).To(BeNil())
+		g.Expect(nsoImage(&f.statefulSet.get().Spec.Template)).To(Equal("cisco-nso-prod:6.4"))
+	})
+}
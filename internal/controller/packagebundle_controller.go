@@ -0,0 +1,640 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/packages"
+)
+
+const (
+	// Label holding the name of the PackageBundle an object was created for
+	packageBundleLabel = "nso.orchestration.cisco.com/package-bundle"
+
+	packagesNameValue      = "nso-packages"
+	packagesComponentValue = "package-download"
+
+	fetchContainerName = "fetch"
+	pruneContainerName = "prune"
+	// Where the download Jobs mount the claim of the bundle and the Secret
+	// holding the credentials of the source
+	packagesMountPath    = "/packages"
+	credentialsMountPath = "/credentials"
+	// Retries of a download or prune Job before it is failed
+	fetchBackoffLimit = 2
+	// User of the distroless manager image the Jobs of the bundles run as
+	fetchUserID = 65532
+	// Length of the download ID in the name of the Jobs
+	downloadIDLength = 10
+	// Longest name of a Job, as it is copied into the job-name label of its
+	// pods
+	maxJobNameLength = 63
+)
+
+// PackageBundleReconciler reconciles a PackageBundle object
+type PackageBundleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Image of the download Jobs. It must hold the manager binary, which
+	// downloads the packages with its fetch-packages command.
+	FetcherImage string
+
+	// Refuses to download the archives of the URL origin without a checksum
+	RequireChecksum bool
+
+	// Records the Events emitted on PackageBundles
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=orchestration.cisco.com.cisco.com,resources=packagebundles,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=orchestration.cisco.com.cisco.com,resources=packagebundles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=orchestration.cisco.com.cisco.com,resources=packagebundles/finalizers,verbs=update
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=create
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+
+// Reconcile downloads the packages of a PackageBundle to its persistent
+// volume claim with a Job, and tracks the progress of the Job in the status.
+// Every change of the source starts a new Job downloading to a new directory
+// of the claim, so that the NSO pods keep the previous packages until the
+// download completes.
+func (r *PackageBundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	bundle := &orchestrationciscocomv1alpha1.PackageBundle{}
+	if err := r.Get(ctx, req.NamespacedName, bundle); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("PackageBundle resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get PackageBundle")
+		return ctrl.Result{}, err
+	}
+	// The Job and the claim are deleted along with the bundle
+	if !bundle.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	original := bundle.DeepCopy()
+
+	if err := r.ensureClaim(ctx, bundle); err != nil {
+		log.Error(err, "Failed to create the packages claim")
+		return ctrl.Result{}, err
+	}
+
+	id, err := downloadID(bundle)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	jobName := fetchJobName(bundle, id)
+	if err := r.deleteStaleJobs(ctx, bundle, jobName, pruneJobName(bundle, id)); err != nil {
+		log.Error(err, "Failed to delete the previous download Jobs")
+		return ctrl.Result{}, err
+	}
+
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: bundle.Namespace}, job)
+	switch {
+	case errors.IsNotFound(err):
+		// The Job of a completed download may be deleted by hand
+		if bundle.Status.Phase == orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded && bundle.Status.StoragePath == id {
+			break
+		}
+		if r.FetcherImage == "" {
+			setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload,
+				"The operator has no package fetcher image, see its --package-fetcher-image flag")
+			return ctrl.Result{}, r.patchStatus(ctx, original, bundle)
+		}
+		if r.RequireChecksum && bundle.Spec.Origin == orchestrationciscocomv1alpha1.OriginURL && bundle.Spec.Source.Checksum == "" {
+			setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload,
+				"The operator requires the checksum of the archives, see source.checksum")
+			return ctrl.Result{}, r.patchStatus(ctx, original, bundle)
+		}
+		job = r.jobForPackageBundle(bundle, jobName, id)
+		if err := controllerutil.SetControllerReference(bundle, job, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Info("Creating the package download Job", "job", jobName)
+		if err := r.Create(ctx, job); err != nil {
+			log.Error(err, "Failed to create the package download Job", "job", jobName)
+			return ctrl.Result{}, err
+		}
+		bundle.Status.JobName = jobName
+		setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhasePending, "Created the download Job "+jobName)
+	case err != nil:
+		log.Error(err, "Failed to get the package download Job", "job", jobName)
+		return ctrl.Result{}, err
+	default:
+		bundle.Status.JobName = jobName
+		if err := r.trackJob(ctx, bundle, job, id); err != nil {
+			log.Error(err, "Failed to check the package download Job", "job", jobName)
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.patchStatus(ctx, original, bundle); err != nil {
+		log.Error(err, "Failed to update PackageBundle status")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.pruneDownloads(ctx, bundle, id); err != nil {
+		log.Error(err, "Failed to remove the previous downloads")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// Function to remove the previous downloads of the bundle from its claim with
+// a Job, once every pod of the target NSO mounts the latest one. The Job is
+// created once per download.
+func (r *PackageBundleReconciler) pruneDownloads(ctx context.Context, bundle *orchestrationciscocomv1alpha1.PackageBundle, id string) error {
+	if bundle.Status.Phase != orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded || bundle.Status.StoragePath != id || r.FetcherImage == "" {
+		return nil
+	}
+
+	jobName := pruneJobName(bundle, id)
+	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: bundle.Namespace}, &batchv1.Job{})
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
+	err = r.Get(ctx, types.NamespacedName{Name: bundle.Spec.TargetName, Namespace: bundle.Namespace}, statefulSet)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && !mountsDownload(statefulSet, bundle) {
+		return nil
+	}
+
+	job := r.jobForPrune(bundle, jobName, id)
+	if err := controllerutil.SetControllerReference(bundle, job, r.Scheme); err != nil {
+		return err
+	}
+	logf.FromContext(ctx).Info("Creating the Job removing the previous downloads", "job", jobName)
+	return r.Create(ctx, job)
+}
+
+// Returns whether every pod of the StatefulSet runs the latest template and
+// mounts the packages of the claim of the bundle from its latest download
+// only
+func mountsDownload(statefulSet *appsv1.StatefulSet, bundle *orchestrationciscocomv1alpha1.PackageBundle) bool {
+	status := statefulSet.Status
+	if status.ObservedGeneration < statefulSet.Generation || status.UpdatedReplicas != status.Replicas ||
+		status.CurrentRevision != status.UpdateRevision {
+		return false
+	}
+
+	podSpec := statefulSet.Spec.Template.Spec
+	volumes := map[string]bool{}
+	for _, volume := range podSpec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == packagesClaimName(bundle.Name) {
+			volumes[volume.Name] = true
+		}
+	}
+	for _, container := range slices.Concat(podSpec.InitContainers, podSpec.Containers) {
+		for _, mount := range container.VolumeMounts {
+			if volumes[mount.Name] && !strings.HasPrefix(mount.SubPath, bundle.Status.StoragePath+"/") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Function to create the persistent volume claim the packages of the bundle
+// are downloaded to. The claim is never updated, as most of its spec is
+// immutable.
+func (r *PackageBundleReconciler) ensureClaim(ctx context.Context, bundle *orchestrationciscocomv1alpha1.PackageBundle) error {
+	claim := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: packagesClaimName(bundle.Name), Namespace: bundle.Namespace}, claim)
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	accessModes := bundle.Spec.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	claim = &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      packagesClaimName(bundle.Name),
+			Namespace: bundle.Namespace,
+			Labels:    packageBundleLabels(bundle),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      accessModes,
+			StorageClassName: bundle.Spec.StorageClassName,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: bundle.Spec.StorageSize},
+			},
+		},
+	}
+	if err := controllerutil.SetControllerReference(bundle, claim, r.Scheme); err != nil {
+		return err
+	}
+	logf.FromContext(ctx).Info("Creating the packages claim", "claim", claim.Name)
+	return r.Create(ctx, claim)
+}
+
+// Function to delete the download and prune Jobs of the previous specs of the
+// bundle. Their pods are deleted in the background.
+func (r *PackageBundleReconciler) deleteStaleJobs(ctx context.Context, bundle *orchestrationciscocomv1alpha1.PackageBundle, jobNames ...string) error {
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(bundle.Namespace), client.MatchingLabels{packageBundleLabel: bundle.Name}); err != nil {
+		return err
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if slices.Contains(jobNames, job.Name) || !metav1.IsControlledBy(job, bundle) {
+			continue
+		}
+		logf.FromContext(ctx).Info("Deleting the previous package Job", "job", job.Name)
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to set the phase of the bundle from the status of its download
+// Job. The result of a completed download is read from the termination
+// message of its pod.
+func (r *PackageBundleReconciler) trackJob(ctx context.Context, bundle *orchestrationciscocomv1alpha1.PackageBundle, job *batchv1.Job, id string) error {
+	switch {
+	case jobHasCondition(job, batchv1.JobComplete):
+		if bundle.Status.Phase == orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded && bundle.Status.StoragePath == id {
+			return nil
+		}
+		message, err := r.terminationMessage(ctx, job, corev1.PodSucceeded)
+		if err != nil {
+			return err
+		}
+		result := &packages.Result{}
+		if err := json.Unmarshal([]byte(message), result); err != nil {
+			setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload,
+				fmt.Sprintf("Invalid result of the download Job %s: %q", job.Name, message))
+			r.recordEvent(bundle, corev1.EventTypeWarning, orchestrationciscocomv1alpha1.ReasonDownloadFailed, bundle.Status.Message)
+			return nil
+		}
+		bundle.Status.Revision = result.Revision
+		bundle.Status.Digest = result.Digest
+		bundle.Status.Packages = result.Packages
+		bundle.Status.StoragePath = id
+		version := "at revision " + result.Revision
+		switch {
+		case result.Revision != "":
+		case bundle.Spec.Origin == orchestrationciscocomv1alpha1.OriginOCI:
+			version = "of the artifact " + result.Digest
+		default:
+			version = "of the archive " + result.Digest
+		}
+		setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded,
+			fmt.Sprintf("Downloaded the packages %s %s", strings.Join(result.Packages, ", "), version))
+		r.recordEvent(bundle, corev1.EventTypeNormal, orchestrationciscocomv1alpha1.ReasonPackagesDownloaded, bundle.Status.Message)
+	case jobHasCondition(job, batchv1.JobFailed):
+		if bundle.Status.Phase == orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload {
+			return nil
+		}
+		message, err := r.terminationMessage(ctx, job, corev1.PodFailed)
+		if err != nil {
+			return err
+		}
+		if message == "" {
+			message = "see the logs of its pods"
+		}
+		setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload,
+			fmt.Sprintf("The download Job %s failed: %s", job.Name, message))
+		r.recordEvent(bundle, corev1.EventTypeWarning, orchestrationciscocomv1alpha1.ReasonDownloadFailed, bundle.Status.Message)
+	case ptr.Deref(job.Status.Ready, 0) > 0:
+		setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseDownloading, "Downloading the packages of "+bundle.Spec.Source.URL)
+	case job.Status.Active > 0:
+		setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhaseContainerCreating, "Starting the pod of the download Job "+job.Name)
+	default:
+		setBundlePhase(bundle, orchestrationciscocomv1alpha1.PackageBundlePhasePending, "Waiting for the pod of the download Job "+job.Name)
+	}
+	return nil
+}
+
+// Returns the termination message of the fetch container of the latest pod
+// of the Job in the phase, empty when there is none
+func (r *PackageBundleReconciler) terminationMessage(ctx context.Context, job *batchv1.Job, phase corev1.PodPhase) (string, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return "", err
+	}
+	slices.SortFunc(pods.Items, func(a, b corev1.Pod) int {
+		return b.CreationTimestamp.Compare(a.CreationTimestamp.Time)
+	})
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != phase {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == fetchContainerName && status.State.Terminated != nil {
+				return strings.TrimSpace(status.State.Terminated.Message), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Returns the Job downloading the packages of the bundle to the id directory
+// of its claim
+func (r *PackageBundleReconciler) jobForPackageBundle(bundle *orchestrationciscocomv1alpha1.PackageBundle, name, id string) *batchv1.Job {
+	args := []string{
+		packages.FetchCommand,
+		"--origin", string(bundle.Spec.Origin),
+		"--url", bundle.Spec.Source.URL,
+		"--ref", bundle.Spec.Source.Branch,
+		"--path", bundle.Spec.Source.Path,
+		"--dest", packagesMountPath + "/" + id,
+	}
+	if bundle.Spec.Source.Checksum != "" {
+		args = append(args, "--checksum", bundle.Spec.Source.Checksum)
+	}
+	if bundle.Spec.InsecureTLS {
+		args = append(args, "--insecure-tls")
+	}
+
+	volumes := []corev1.Volume{packagesVolume(bundle), {
+		Name:         "tmp",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}}
+	mounts := []corev1.VolumeMount{
+		{Name: "packages", MountPath: packagesMountPath},
+		{Name: "tmp", MountPath: "/tmp"},
+	}
+	if secret := credentialsSecret(bundle); secret != "" {
+		args = append(args, "--credentials-dir", credentialsMountPath)
+		volumes = append(volumes, corev1.Volume{
+			Name: "credentials",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: secret, DefaultMode: ptr.To[int32](0o440)},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: "credentials", MountPath: credentialsMountPath, ReadOnly: true})
+	}
+
+	return r.bundleJob(bundle, name, corev1.Container{
+		Name:         fetchContainerName,
+		Args:         args,
+		Env:          []corev1.EnvVar{{Name: "HOME", Value: "/tmp"}},
+		VolumeMounts: mounts,
+	}, volumes)
+}
+
+// Returns the Job removing the downloads of the claim of the bundle other than
+// the id one
+func (r *PackageBundleReconciler) jobForPrune(bundle *orchestrationciscocomv1alpha1.PackageBundle, name, id string) *batchv1.Job {
+	return r.bundleJob(bundle, name, corev1.Container{
+		Name:         pruneContainerName,
+		Args:         []string{packages.PruneCommand, "--dir", packagesMountPath, "--keep", id},
+		VolumeMounts: []corev1.VolumeMount{{Name: "packages", MountPath: packagesMountPath}},
+	}, []corev1.Volume{packagesVolume(bundle)})
+}
+
+// Returns a Job of the bundle running the manager binary in the container,
+// unprivileged
+func (r *PackageBundleReconciler) bundleJob(bundle *orchestrationciscocomv1alpha1.PackageBundle, name string, container corev1.Container, volumes []corev1.Volume) *batchv1.Job {
+	container.Image = r.FetcherImage
+	container.Command = []string{"/manager"}
+	container.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	container.SecurityContext = &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		ReadOnlyRootFilesystem:   ptr.To(true),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+
+	labels := packageBundleLabels(bundle)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: bundle.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](fetchBackoffLimit),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot:   ptr.To(true),
+						RunAsUser:      ptr.To[int64](fetchUserID),
+						RunAsGroup:     ptr.To[int64](fetchUserID),
+						FSGroup:        ptr.To[int64](fetchUserID),
+						SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+					},
+					Containers: []corev1.Container{container},
+					Volumes:    volumes,
+				},
+			},
+		},
+	}
+}
+
+// Returns the volume of the claim holding the packages of the bundle
+func packagesVolume(bundle *orchestrationciscocomv1alpha1.PackageBundle) corev1.Volume {
+	return corev1.Volume{
+		Name: "packages",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: packagesClaimName(bundle.Name)},
+		},
+	}
+}
+
+// Returns the name of the Secret the source is accessed with, empty when
+// there is none
+func credentialsSecret(bundle *orchestrationciscocomv1alpha1.PackageBundle) string {
+	credentials := bundle.Spec.Credentials
+	if credentials == nil {
+		return ""
+	}
+	switch {
+	case credentials.SSHKeySecretRef != "":
+		return credentials.SSHKeySecretRef
+	case credentials.DockerConfigSecretRef != "":
+		return credentials.DockerConfigSecretRef
+	}
+	return credentials.HTTPAuthSecretRef
+}
+
+// Returns the ID of the download of the current spec of the bundle, a hash of
+// the fields the packages depend on. It names the Job and the directory of
+// the claim the packages are downloaded to.
+func downloadID(bundle *orchestrationciscocomv1alpha1.PackageBundle) (string, error) {
+	data, err := json.Marshal(struct {
+		Origin      orchestrationciscocomv1alpha1.OriginType         `json:"origin"`
+		Source      orchestrationciscocomv1alpha1.PackageSource      `json:"source"`
+		Credentials *orchestrationciscocomv1alpha1.AccessCredentials `json:"credentials,omitempty"`
+		InsecureTLS bool                                             `json:"insecureTLS,omitempty"`
+	}{bundle.Spec.Origin, bundle.Spec.Source, bundle.Spec.Credentials, bundle.Spec.InsecureTLS})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:downloadIDLength], nil
+}
+
+// Returns the name of the download Job of the bundle
+func fetchJobName(bundle *orchestrationciscocomv1alpha1.PackageBundle, id string) string {
+	return bundleJobName(bundle, "fetch", id)
+}
+
+// Returns the name of the Job removing the downloads preceding the id one
+func pruneJobName(bundle *orchestrationciscocomv1alpha1.PackageBundle, id string) string {
+	return bundleJobName(bundle, "prune", id)
+}
+
+// Returns the name of a Job of the bundle, with the bundle name shortened to
+// fit the Job name limit
+func bundleJobName(bundle *orchestrationciscocomv1alpha1.PackageBundle, action, id string) string {
+	suffix := "-" + action + "-" + id
+	prefix := bundle.Name
+	if len(prefix)+len(suffix) > maxJobNameLength {
+		prefix = strings.TrimRight(prefix[:maxJobNameLength-len(suffix)], "-.")
+	}
+	return prefix + suffix
+}
+
+// Returns the name of the persistent volume claim holding the packages of the
+// bundle
+func packagesClaimName(bundle string) string {
+	return bundle + "-packages"
+}
+
+// Returns the labels of the objects created for the bundle. They carry the
+// managed-by label so that the pods of the Jobs are cached, but no instance
+// label as they do not belong to an NSO.
+func packageBundleLabels(bundle *orchestrationciscocomv1alpha1.PackageBundle) map[string]string {
+	return map[string]string{
+		nameLabel:          packagesNameValue,
+		componentLabel:     packagesComponentValue,
+		managedByLabel:     managedByValue,
+		packageBundleLabel: bundle.Name,
+	}
+}
+
+// Returns whether the condition of the Job is true
+func jobHasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Function to set the phase of the bundle and the matching Downloaded
+// condition
+func setBundlePhase(bundle *orchestrationciscocomv1alpha1.PackageBundle, phase orchestrationciscocomv1alpha1.PackageBundlePhase, message string) {
+	if bundle.Status.Phase != phase {
+		now := metav1.Now()
+		bundle.Status.LastTransitionTime = &now
+	}
+	bundle.Status.Phase = phase
+	bundle.Status.Message = message
+
+	condition := metav1.Condition{
+		Type:               orchestrationciscocomv1alpha1.ConditionDownloaded,
+		Status:             metav1.ConditionUnknown,
+		Reason:             orchestrationciscocomv1alpha1.ReasonDownloadInProgress,
+		Message:            message,
+		ObservedGeneration: bundle.Generation,
+	}
+	switch phase {
+	case orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonPackagesDownloaded
+	case orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = orchestrationciscocomv1alpha1.ReasonDownloadFailed
+	}
+	meta.SetStatusCondition(&bundle.Status.Conditions, condition)
+}
+
+// Function to record an Event on the PackageBundle, if a recorder is
+// configured
+func (r *PackageBundleReconciler) recordEvent(bundle *orchestrationciscocomv1alpha1.PackageBundle, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(bundle, eventType, reason, message)
+	}
+}
+
+// Function to persist the status changes made during reconcile
+func (r *PackageBundleReconciler) patchStatus(ctx context.Context, original, bundle *orchestrationciscocomv1alpha1.PackageBundle) error {
+	if equality.Semantic.DeepEqual(original.Status, bundle.Status) {
+		return nil
+	}
+	return r.Status().Patch(ctx, bundle, client.MergeFrom(original))
+}
+
+// Maps StatefulSet changes to reconcile requests of the bundles targeting the
+// NSO of the StatefulSet
+func (r *PackageBundleReconciler) bundlesForStatefulSet(ctx context.Context, obj client.Object) []reconcile.Request {
+	bundles := &orchestrationciscocomv1alpha1.PackageBundleList{}
+	if err := r.List(ctx, bundles, client.InNamespace(obj.GetNamespace())); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to list the PackageBundles", "namespace", obj.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, bundle := range bundles.Items {
+		if bundle.Spec.TargetName == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bundle)})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PackageBundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&orchestrationciscocomv1alpha1.PackageBundle{}).
+		Owns(&batchv1.Job{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		// The previous downloads are removed once the NSO pods roll out
+		Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.bundlesForStatefulSet)).
+		Named("packagebundle").
+		Complete(r)
+}
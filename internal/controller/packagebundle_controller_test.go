@@ -0,0 +1,359 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+)
+
+var _ = Describe("PackageBundle Controller", func() {
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "l3vpn", Namespace: "default"}
+
+	var (
+		bundle               *orchestrationciscocomv1alpha1.PackageBundle
+		fakeClient           client.Client
+		recorder             *record.FakeRecorder
+		controllerReconciler *PackageBundleReconciler
+	)
+
+	reconcileBundle := func() {
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fakeClient.Get(ctx, key, bundle)).To(Succeed())
+	}
+
+	downloadJob := func() *batchv1.Job {
+		job := &batchv1.Job{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: bundle.Status.JobName, Namespace: key.Namespace}, job)).To(Succeed())
+		return job
+	}
+
+	downloaded := func() *metav1.Condition {
+		condition := meta.FindStatusCondition(bundle.Status.Conditions, orchestrationciscocomv1alpha1.ConditionDownloaded)
+		Expect(condition).NotTo(BeNil())
+		return condition
+	}
+
+	// Ends the Job with the condition, and creates its pod terminated with
+	// the message
+	finishJob := func(job *batchv1.Job, conditionType batchv1.JobConditionType, phase corev1.PodPhase, message string) {
+		job.Status.Active = 0
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{Type: conditionType, Status: corev1.ConditionTrue})
+		Expect(fakeClient.Status().Update(ctx, job)).To(Succeed())
+		Expect(fakeClient.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      job.Name + "-x7k2p",
+				Namespace: key.Namespace,
+				Labels:    map[string]string{batchv1.JobNameLabel: job.Name},
+			},
+			Status: corev1.PodStatus{
+				Phase: phase,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  fetchContainerName,
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: message}},
+				}},
+			},
+		})).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		testScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+		Expect(orchestrationciscocomv1alpha1.AddToScheme(testScheme)).To(Succeed())
+
+		bundle = &orchestrationciscocomv1alpha1.PackageBundle{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: orchestrationciscocomv1alpha1.PackageBundleSpec{
+				TargetName:  "nso-prod",
+				Origin:      orchestrationciscocomv1alpha1.OriginSCM,
+				Source:      orchestrationciscocomv1alpha1.PackageSource{URL: "git@git.example.com:nso/packages.git", Branch: "v1.0", Path: "packages"},
+				StorageSize: resource.MustParse("1Gi"),
+				Credentials: &orchestrationciscocomv1alpha1.AccessCredentials{SSHKeySecretRef: "git-ssh"},
+			},
+		}
+		fakeClient = fake.NewClientBuilder().
+			WithScheme(testScheme).
+			WithObjects(bundle).
+			WithStatusSubresource(&orchestrationciscocomv1alpha1.PackageBundle{}, &batchv1.Job{}).
+			Build()
+		recorder = record.NewFakeRecorder(10)
+		controllerReconciler = &PackageBundleReconciler{
+			Client:       fakeClient,
+			Scheme:       testScheme,
+			FetcherImage: "example.com/nso-operator:v0.0.1",
+			Recorder:     recorder,
+		}
+	})
+
+	It("should download the packages to the claim with a Job", func() {
+		reconcileBundle()
+
+		claim := &corev1.PersistentVolumeClaim{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "l3vpn-packages", Namespace: key.Namespace}, claim)).To(Succeed())
+		Expect(claim.Spec.AccessModes).To(Equal([]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}))
+		Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("1Gi"))
+		Expect(metav1.IsControlledBy(claim, bundle)).To(BeTrue())
+
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhasePending))
+		Expect(bundle.Status.JobName).To(MatchRegexp(`^l3vpn-fetch-[0-9a-f]{10}$`))
+		Expect(downloaded().Status).To(Equal(metav1.ConditionUnknown))
+		Expect(downloaded().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonDownloadInProgress))
+
+		job := downloadJob()
+		Expect(metav1.IsControlledBy(job, bundle)).To(BeTrue())
+		Expect(job.Labels).To(HaveKeyWithValue(packageBundleLabel, key.Name))
+		Expect(job.Spec.Template.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(job.Spec.Template.Labels).NotTo(HaveKey(instanceLabel))
+		id := bundle.Status.JobName[len("l3vpn-fetch-"):]
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("example.com/nso-operator:v0.0.1"))
+		Expect(container.Args).To(Equal([]string{
+			"fetch-packages",
+			"--origin", "SCM",
+			"--url", "git@git.example.com:nso/packages.git",
+			"--ref", "v1.0",
+			"--path", "packages",
+			"--dest", "/packages/" + id,
+			"--credentials-dir", "/credentials",
+		}))
+		Expect(job.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+			Name: "credentials",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "git-ssh", DefaultMode: ptr.To[int32](0o440)},
+			},
+		}))
+	})
+
+	It("should track the download Job in the status", func() {
+		reconcileBundle()
+		job := downloadJob()
+		id := job.Name[len("l3vpn-fetch-"):]
+
+		job.Status.Active = 1
+		Expect(fakeClient.Status().Update(ctx, job)).To(Succeed())
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseContainerCreating))
+
+		job.Status.Ready = ptr.To[int32](1)
+		Expect(fakeClient.Status().Update(ctx, job)).To(Succeed())
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloading))
+
+		finishJob(job, batchv1.JobComplete, corev1.PodSucceeded,
+			`{"revision":"9fceb02d0ae598e95dc970b74767f19372d61af8","packages":["l3vpn","mpls"]}`)
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded))
+		Expect(bundle.Status.Revision).To(Equal("9fceb02d0ae598e95dc970b74767f19372d61af8"))
+		Expect(bundle.Status.Packages).To(Equal([]string{"l3vpn", "mpls"}))
+		Expect(bundle.Status.StoragePath).To(Equal(id))
+		Expect(downloaded().Status).To(Equal(metav1.ConditionTrue))
+		Expect(recorder.Events).To(Receive(ContainSubstring("PackagesDownloaded Downloaded the packages l3vpn, mpls at revision 9fceb02")))
+
+		By("not downloading the packages again when the Job is deleted")
+		Expect(fakeClient.Delete(ctx, job)).To(Succeed())
+		reconcileBundle()
+		Expect(errors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{}))).To(BeTrue())
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded))
+	})
+
+	It("should report failed downloads until the source changes", func() {
+		reconcileBundle()
+		job := downloadJob()
+		finishJob(job, batchv1.JobComplete, corev1.PodSucceeded, `{"revision":"9fceb02d0ae598e95dc970b74767f19372d61af8","packages":["l3vpn"]}`)
+		reconcileBundle()
+		storagePath := bundle.Status.StoragePath
+
+		By("downloading the new branch to a new directory with a new Job")
+		bundle.Spec.Source.Branch = "v2.0"
+		Expect(fakeClient.Update(ctx, bundle)).To(Succeed())
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhasePending))
+		Expect(bundle.Status.JobName).NotTo(Equal(job.Name))
+		Expect(errors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{}))).To(BeTrue())
+
+		finishJob(downloadJob(), batchv1.JobFailed, corev1.PodFailed, `no branch, tag or commit "v2.0" in the repository`)
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload))
+		Expect(bundle.Status.Message).To(Equal(`The download Job ` + bundle.Status.JobName + ` failed: no branch, tag or commit "v2.0" in the repository`))
+		Expect(downloaded().Status).To(Equal(metav1.ConditionFalse))
+		Expect(downloaded().Reason).To(Equal(orchestrationciscocomv1alpha1.ReasonDownloadFailed))
+		Expect(recorder.Events).To(Receive(ContainSubstring("PackagesDownloaded")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("Warning DownloadFailed")))
+
+		By("keeping the packages of the previous download")
+		Expect(bundle.Status.StoragePath).To(Equal(storagePath))
+		Expect(bundle.Status.Packages).To(Equal([]string{"l3vpn"}))
+
+		By("not retrying the failed Job")
+		reconcileBundle()
+		Expect(recorder.Events).NotTo(Receive())
+		jobs := &batchv1.JobList{}
+		Expect(fakeClient.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+	})
+
+	It("should require the checksum of URL archives when configured", func() {
+		controllerReconciler.RequireChecksum = true
+		bundle.Spec.Origin = orchestrationciscocomv1alpha1.OriginURL
+		bundle.Spec.Source = orchestrationciscocomv1alpha1.PackageSource{URL: "https://artifacts.example.com/nso/packages-1.0.tar.gz"}
+		bundle.Spec.Credentials = &orchestrationciscocomv1alpha1.AccessCredentials{HTTPAuthSecretRef: "artifacts-token"}
+		Expect(fakeClient.Update(ctx, bundle)).To(Succeed())
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseFailedToDownload))
+		Expect(bundle.Status.Message).To(Equal("The operator requires the checksum of the archives, see source.checksum"))
+		jobs := &batchv1.JobList{}
+		Expect(fakeClient.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		By("downloading the archive once its checksum is set")
+		digest := "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+		bundle.Spec.Source.Checksum = digest
+		Expect(fakeClient.Update(ctx, bundle)).To(Succeed())
+		reconcileBundle()
+		job := downloadJob()
+		Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{
+			"fetch-packages",
+			"--origin", "URL",
+			"--url", "https://artifacts.example.com/nso/packages-1.0.tar.gz",
+			"--ref", "",
+			"--path", "",
+			"--dest", "/packages/" + job.Name[len("l3vpn-fetch-"):],
+			"--checksum", digest,
+			"--credentials-dir", "/credentials",
+		}))
+
+		finishJob(job, batchv1.JobComplete, corev1.PodSucceeded, `{"digest":"`+digest+`","packages":["l3vpn"]}`)
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded))
+		Expect(bundle.Status.Digest).To(Equal(digest))
+		Expect(bundle.Status.Revision).To(BeEmpty())
+		Expect(bundle.Status.Message).To(Equal("Downloaded the packages l3vpn of the archive " + digest))
+	})
+
+	It("should pull OCI artifacts with the registry credentials", func() {
+		bundle.Spec.Origin = orchestrationciscocomv1alpha1.OriginOCI
+		bundle.Spec.Source = orchestrationciscocomv1alpha1.PackageSource{URL: "registry.example.com/nso/packages:1.0"}
+		bundle.Spec.Credentials = &orchestrationciscocomv1alpha1.AccessCredentials{DockerConfigSecretRef: "registry-credentials"}
+		Expect(fakeClient.Update(ctx, bundle)).To(Succeed())
+		reconcileBundle()
+		job := downloadJob()
+		Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElements("--origin", "OCI", "--url", "registry.example.com/nso/packages:1.0", "--credentials-dir"))
+		Expect(job.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+			Name: "credentials",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "registry-credentials", DefaultMode: ptr.To[int32](0o440)},
+			},
+		}))
+
+		digest := "sha256:f94c6c16d55d47da2529c609eccf85562500bea427c80040184e6be27a37ead3"
+		finishJob(job, batchv1.JobComplete, corev1.PodSucceeded, `{"digest":"`+digest+`","packages":["l3vpn"]}`)
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded))
+		Expect(bundle.Status.Digest).To(Equal(digest))
+		Expect(bundle.Status.Message).To(Equal("Downloaded the packages l3vpn of the artifact " + digest))
+	})
+
+	It("should remove the previous downloads once the NSO pods mount the latest one", func() {
+		reconcileBundle()
+		finishJob(downloadJob(), batchv1.JobComplete, corev1.PodSucceeded, `{"revision":"9fceb02d0ae598e95dc970b74767f19372d61af8","packages":["l3vpn"]}`)
+
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "nso-prod", Namespace: key.Namespace, Generation: 1},
+			Spec: appsv1.StatefulSetSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         nsoContainerName,
+						VolumeMounts: []corev1.VolumeMount{{Name: "packages-0", MountPath: "/nso/run/packages/l3vpn", SubPath: "0123456789/l3vpn"}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "packages-0",
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "l3vpn-packages"},
+						},
+					}},
+				}},
+			},
+			Status: appsv1.StatefulSetStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, CurrentRevision: "nso-prod-1", UpdateRevision: "nso-prod-1"},
+		}
+		Expect(fakeClient.Create(ctx, statefulSet)).To(Succeed())
+		Expect(controllerReconciler.bundlesForStatefulSet(ctx, statefulSet)).To(Equal([]reconcile.Request{{NamespacedName: key}}))
+		pruneJob := func() error {
+			return fakeClient.Get(ctx, types.NamespacedName{Name: pruneJobName(bundle, bundle.Status.StoragePath), Namespace: key.Namespace}, &batchv1.Job{})
+		}
+
+		By("keeping them while the pods mount a previous download")
+		reconcileBundle()
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded))
+		Expect(errors.IsNotFound(pruneJob())).To(BeTrue())
+
+		By("keeping them while the pods roll out")
+		statefulSet.Generation = 2
+		statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts[0].SubPath = bundle.Status.StoragePath + "/l3vpn"
+		Expect(fakeClient.Update(ctx, statefulSet)).To(Succeed())
+		statefulSet.Status = appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, CurrentRevision: "nso-prod-1", UpdateRevision: "nso-prod-2"}
+		Expect(fakeClient.Status().Update(ctx, statefulSet)).To(Succeed())
+		reconcileBundle()
+		Expect(errors.IsNotFound(pruneJob())).To(BeTrue())
+
+		By("removing them with a Job once every pod mounts the latest download")
+		statefulSet.Status.UpdatedReplicas = 2
+		statefulSet.Status.CurrentRevision = "nso-prod-2"
+		Expect(fakeClient.Status().Update(ctx, statefulSet)).To(Succeed())
+		reconcileBundle()
+		job := &batchv1.Job{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "l3vpn-prune-" + bundle.Status.StoragePath, Namespace: key.Namespace}, job)).To(Succeed())
+		Expect(metav1.IsControlledBy(job, bundle)).To(BeTrue())
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Args).To(Equal([]string{"prune-packages", "--dir", "/packages", "--keep", bundle.Status.StoragePath}))
+		Expect(container.VolumeMounts).To(Equal([]corev1.VolumeMount{{Name: "packages", MountPath: "/packages"}}))
+		Expect(bundle.Status.Phase).To(Equal(orchestrationciscocomv1alpha1.PackageBundlePhaseDownloaded))
+
+		By("deleting the prune Job along with the download Job when the source changes")
+		bundle.Spec.Source.Branch = "v2.0"
+		Expect(fakeClient.Update(ctx, bundle)).To(Succeed())
+		reconcileBundle()
+		Expect(errors.IsNotFound(fakeClient.Get(ctx, client.ObjectKeyFromObject(job), &batchv1.Job{}))).To(BeTrue())
+	})
+
+	It("should shorten the Job name of long bundle names", func() {
+		bundle.Name = "a-very-long-package-bundle-name-for-the-l3vpn-and-mpls-service-packages"
+		name := fetchJobName(bundle, "0123456789")
+		Expect(len(name)).To(BeNumerically("<=", maxJobNameLength))
+		Expect(name).To(Equal("a-very-long-package-bundle-name-for-the-l3vpn-fetch-0123456789"))
+	})
+})
@@ -0,0 +1,80 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// CommandExecutor runs commands inside the containers of running pods
+type CommandExecutor interface {
+	// Runs the command and returns its standard output and error. A command
+	// exiting with a non zero code is reported as an error.
+	Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error)
+}
+
+// podExecutor runs commands through the pods/exec subresource
+type podExecutor struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+// NewPodExecutor returns a CommandExecutor using the given API server config
+func NewPodExecutor(config *rest.Config) (CommandExecutor, error) {
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &podExecutor{config: config, clientset: clientset}, nil
+}
+
+func (e *podExecutor) Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	request := e.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(e.config, "POST", request.URL())
+	if err != nil {
+		return "", "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("command %v failed in pod %s: %w", command, pod, err)
+	}
+	return stdout.String(), stderr.String(), nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package imagepolicy enforces the operator-level policy on the images the
+// NSO pods run: the registries they come from and the signature of the NSO
+// image.
+package imagepolicy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"sigs.k8s.io/yaml"
+)
+
+// Names of the policies, as written in the policy file and in the messages
+// of the violations
+const (
+	PolicyAllowedRegistries = "allowedRegistries"
+	PolicyRequireSignature  = "requireSignature"
+)
+
+// Policy is the image policy of the operator, read from the file given with
+// --image-policy-file. The zero value allows every image.
+type Policy struct {
+	// Registries, or repositories within a registry, the images must come
+	// from, e.g. mirror.example.com or mirror.example.com/cisco. Empty allows
+	// every registry.
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+
+	// Whether the NSO image must carry a cosign signature made by one of the
+	// PublicKeys.
+	RequireSignature bool `json:"requireSignature,omitempty"`
+
+	// PEM encoded ECDSA, RSA or Ed25519 public keys the signatures are
+	// verified with.
+	PublicKeys []string `json:"publicKeys,omitempty"`
+
+	keys []crypto.PublicKey
+}
+
+// Violation is returned for an image the policy does not allow
+type Violation struct {
+	// Name of the policy that failed, e.g. allowedRegistries
+	Policy string
+	Image  string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("image %s violates the %s image policy: %s", v.Image, v.Policy, v.Reason)
+}
+
+// IsViolation returns whether the error, or one of the errors it wraps, is a
+// policy violation rather than e.g. a registry failure
+func IsViolation(err error) bool {
+	var violation *Violation
+	return errors.As(err, &violation)
+}
+
+// Load reads the policy file. An empty path returns a nil policy, which
+// allows every image.
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image policy: %w", err)
+	}
+	return Parse(content)
+}
+
+// Parse returns the policy held by the YAML or JSON content. Unknown fields
+// are rejected, so that typos do not silently weaken the policy.
+func Parse(content []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(content, policy); err != nil {
+		return nil, fmt.Errorf("invalid image policy: %w", err)
+	}
+
+	for i, registry := range policy.AllowedRegistries {
+		registry = normalizeRegistry(registry)
+		if registry == "" {
+			return nil, fmt.Errorf("invalid image policy: empty entry in %s", PolicyAllowedRegistries)
+		}
+		policy.AllowedRegistries[i] = registry
+	}
+
+	for i, key := range policy.PublicKeys {
+		publicKey, err := parsePublicKey([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid image policy: public key %d: %w", i, err)
+		}
+		policy.keys = append(policy.keys, publicKey)
+	}
+	if policy.RequireSignature && len(policy.keys) == 0 {
+		return nil, fmt.Errorf("invalid image policy: %s needs at least one of publicKeys", PolicyRequireSignature)
+	}
+	return policy, nil
+}
+
+// RequiresSignature returns whether the NSO image must be signed. It is safe
+// to call on a nil policy.
+func (p *Policy) RequiresSignature() bool {
+	return p != nil && p.RequireSignature
+}
+
+// CheckImages returns the violations of the allowed registries by the
+// images. It does not contact the registries and is safe to call on a nil
+// policy.
+func (p *Policy) CheckImages(images ...string) error {
+	if p == nil || len(p.AllowedRegistries) == 0 {
+		return nil
+	}
+
+	var errs []error
+	seen := map[string]bool{}
+	for _, image := range images {
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+		if err := p.checkImage(image); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Returns a violation when the image does not come from an allowed registry
+func (p *Policy) checkImage(image string) error {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return &Violation{Policy: PolicyAllowedRegistries, Image: image, Reason: "invalid image reference"}
+	}
+	repository := ref.Context().Name()
+	for _, registry := range p.AllowedRegistries {
+		if repository == registry || strings.HasPrefix(repository, registry+"/") {
+			return nil
+		}
+	}
+	return &Violation{
+		Policy: PolicyAllowedRegistries,
+		Image:  image,
+		Reason: "it must come from one of " + strings.Join(p.AllowedRegistries, ", "),
+	}
+}
+
+// Returns the registry or repository in the form image references are
+// compared in, with Docker Hub spelled as image references resolve it
+func normalizeRegistry(registry string) string {
+	registry = strings.Trim(strings.TrimSpace(registry), "/")
+	host, path, _ := strings.Cut(registry, "/")
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		host = name.DefaultRegistry
+	}
+	if path == "" {
+		return host
+	}
+	return host + "/" + path
+}
+
+// Returns the public key held by the PEM content
+func parsePublicKey(content []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagepolicy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Returns a new ECDSA key and the PEM encoding of its public key
+func newKey() (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	Expect(err).NotTo(HaveOccurred())
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// Pushes a cosign signature of the digest made with the key, signing the
+// given digest in the payload
+func sign(repository name.Repository, digest, signedDigest string, key *ecdsa.PrivateKey) {
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"` + repository.Name() + `"},` +
+		`"image":{"docker-manifest-digest":"` + signedDigest + `"},"type":"cosign container image signature"},"optional":null}`)
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	Expect(err).NotTo(HaveOccurred())
+
+	image, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, "application/vnd.dev.cosign.simplesigning.v1+json"),
+		Annotations: map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(remote.Write(repository.Tag(SignatureTag(digest)), image)).To(Succeed())
+}
+
+var _ = Describe("Image policy", func() {
+	Context("When parsing the policy", func() {
+		It("should normalize the allowed registries", func() {
+			policy, err := Parse([]byte("allowedRegistries:\n- mirror.example.com/cisco/\n- docker.io/library\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.AllowedRegistries).To(Equal([]string{"mirror.example.com/cisco", "index.docker.io/library"}))
+		})
+
+		It("should reject unknown fields", func() {
+			_, err := Parse([]byte("allowedRegistry:\n- mirror.example.com\n"))
+			Expect(err).To(MatchError(ContainSubstring("allowedRegistry")))
+		})
+
+		It("should require a public key to verify signatures", func() {
+			_, err := Parse([]byte("requireSignature: true\n"))
+			Expect(err).To(MatchError(ContainSubstring("requireSignature needs at least one of publicKeys")))
+
+			_, err = Parse([]byte("requireSignature: true\npublicKeys:\n- not a key\n"))
+			Expect(err).To(MatchError(ContainSubstring("no PEM block found")))
+		})
+
+		It("should allow every image without a policy file", func() {
+			policy, err := Load("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.CheckImages("cisco-nso-prod:6.3.1")).To(Succeed())
+			Expect(policy.RequiresSignature()).To(BeFalse())
+		})
+	})
+
+	Context("When checking the allowed registries", func() {
+		var policy *Policy
+
+		BeforeEach(func() {
+			var err error
+			policy, err = Parse([]byte("allowedRegistries:\n- mirror.example.com/cisco\n- registry.example.com:5000\n"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should allow the images of the allowed registries and repositories", func() {
+			Expect(policy.CheckImages(
+				"mirror.example.com/cisco/cisco-nso-prod:6.3.1",
+				"mirror.example.com/cisco/tools/busybox@sha256:"+strings.Repeat("a", 64),
+				"registry.example.com:5000/nso:6.3.1",
+			)).To(Succeed())
+		})
+
+		It("should name the policy the images violate", func() {
+			err := policy.CheckImages(
+				"mirror.example.com/cisco-nso-prod:6.3.1",
+				"mirror.example.com.evil.io/cisco/cisco-nso-prod:6.3.1",
+				"busybox:1.36",
+			)
+			Expect(IsViolation(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring(
+				"image mirror.example.com/cisco-nso-prod:6.3.1 violates the allowedRegistries image policy: " +
+					"it must come from one of mirror.example.com/cisco, registry.example.com:5000")))
+			Expect(err).To(MatchError(ContainSubstring("image mirror.example.com.evil.io/cisco/cisco-nso-prod:6.3.1 violates")))
+			Expect(err).To(MatchError(ContainSubstring("image busybox:1.36 violates")))
+		})
+	})
+
+	Context("When verifying the signature of the NSO image", func() {
+		ctx := context.Background()
+		keychain := authn.NewMultiKeychain()
+
+		var (
+			repository name.Repository
+			digest     string
+			key        *ecdsa.PrivateKey
+			policy     *Policy
+		)
+
+		BeforeEach(func() {
+			server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+			DeferCleanup(server.Close)
+
+			var err error
+			repository, err = name.NewRepository(strings.TrimPrefix(server.URL, "http://") + "/cisco-nso-prod")
+			Expect(err).NotTo(HaveOccurred())
+			image, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(repository.Tag("6.3.1"), image)).To(Succeed())
+			hash, err := image.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			digest = hash.String()
+
+			var publicKey string
+			key, publicKey = newKey()
+			policy, err = Parse([]byte("requireSignature: true\npublicKeys:\n- |\n  " +
+				strings.ReplaceAll(strings.TrimSpace(publicKey), "\n", "\n  ") + "\n"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return the digest of a signed image", func() {
+			sign(repository, digest, digest, key)
+
+			verified, err := policy.VerifySignature(ctx, repository.Tag("6.3.1").String(), keychain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verified).To(Equal(digest))
+
+			By("verifying an image referenced by digest")
+			verified, err = policy.VerifySignature(ctx, repository.Digest(digest).String(), keychain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verified).To(Equal(digest))
+		})
+
+		It("should reject an unsigned image", func() {
+			_, err := policy.VerifySignature(ctx, repository.Tag("6.3.1").String(), keychain)
+			Expect(IsViolation(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("violates the requireSignature image policy: no signature found for digest " + digest)))
+		})
+
+		It("should reject a signature made by another key", func() {
+			otherKey, _ := newKey()
+			sign(repository, digest, digest, otherKey)
+
+			_, err := policy.VerifySignature(ctx, repository.Tag("6.3.1").String(), keychain)
+			Expect(IsViolation(err)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("is verified by the public keys")))
+		})
+
+		It("should reject a signature of another digest", func() {
+			sign(repository, digest, "sha256:"+strings.Repeat("b", 64), key)
+
+			_, err := policy.VerifySignature(ctx, repository.Tag("6.3.1").String(), keychain)
+			Expect(IsViolation(err)).To(BeTrue())
+		})
+
+		It("should not report a registry failure as a violation", func() {
+			_, err := policy.VerifySignature(ctx, "127.0.0.1:1/cisco-nso-prod:6.3.1", keychain)
+			Expect(err).To(HaveOccurred())
+			Expect(IsViolation(err)).To(BeFalse())
+		})
+	})
+})
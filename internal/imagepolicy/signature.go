@@ -0,0 +1,157 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package imagepolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/carlosgrillet/nso-operator/internal/registry"
+)
+
+const (
+	// Annotation of the signature layers holding the base64 signature of the
+	// layer content
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// Upper bound of the size of a signature payload
+	maxPayloadSize = 1 << 20
+)
+
+// Payload is the simple signing payload cosign signs for an image
+type Payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// SignatureTag returns the tag cosign stores the signatures of the image
+// digest under, e.g. sha256-2c26b46b....sig
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// VerifySignature checks that the image carries a cosign signature made by
+// one of the public keys of the policy, as stored by `cosign sign --key`.
+// It returns the digest the signature was verified for, which the image must
+// be pinned to. Missing or invalid signatures are returned as a Violation,
+// other errors are failures to reach the registry.
+func (p *Policy) VerifySignature(ctx context.Context, image string, keychain authn.Keychain) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", &Violation{Policy: PolicyRequireSignature, Image: image, Reason: "invalid image reference"}
+	}
+
+	digest := ref.Identifier()
+	if _, ok := ref.(name.Digest); !ok {
+		if digest, err = registry.ResolveDigest(ctx, image, keychain); err != nil {
+			return "", err
+		}
+	}
+
+	options := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain)}
+	signatures, err := remote.Image(ref.Context().Tag(SignatureTag(digest)), options...)
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return "", &Violation{Policy: PolicyRequireSignature, Image: image, Reason: "no signature found for digest " + digest}
+		}
+		return "", fmt.Errorf("failed to get the signatures of image %q: %w", image, err)
+	}
+	manifest, err := signatures.Manifest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the signatures of image %q: %w", image, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[SignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		blob, err := signatures.LayerByDigest(layer.Digest)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the signatures of image %q: %w", image, err)
+		}
+		content, err := blob.Compressed()
+		if err != nil {
+			return "", fmt.Errorf("failed to get the signatures of image %q: %w", image, err)
+		}
+		payload, err := io.ReadAll(io.LimitReader(content, maxPayloadSize))
+		_ = content.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to get the signatures of image %q: %w", image, err)
+		}
+
+		if p.verifyPayload(payload, signature, digest) {
+			return digest, nil
+		}
+	}
+	return "", &Violation{
+		Policy: PolicyRequireSignature,
+		Image:  image,
+		Reason: "no signature of digest " + digest + " is verified by the public keys",
+	}
+}
+
+// Returns whether one of the public keys verifies the signature of a payload
+// signing the digest
+func (p *Policy) verifyPayload(payload, signature []byte, digest string) bool {
+	content := Payload{}
+	if err := json.Unmarshal(payload, &content); err != nil || content.Critical.Image.DockerManifestDigest != digest {
+		return false
+	}
+
+	hash := sha256.Sum256(payload)
+	for _, key := range p.keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, hash[:], signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nso
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	// RESTCONF paths of the data read by the client
+	VersionPath  = "tailf-ncs-monitoring:ncs-state/version"
+	PackagesPath = "tailf-ncs:packages"
+	DevicesPath  = "tailf-ncs:devices/device"
+	AlarmsPath   = "tailf-ncs-alarms:alarms/alarm-list/alarm"
+	HAStatusPath = "tailf-ncs-high-availability:high-availability/status"
+
+	// Oper-status of a package loaded without error
+	OperStatusUp = "up"
+)
+
+// Package is an NSO package and the outcome of its loading.
+type Package struct {
+	Name    string
+	Version string
+	// up, or the case of the failure, e.g. java-uninitialized
+	OperStatus string
+	// Why the package failed to load
+	ErrorInfo string
+}
+
+// Up returns whether the package is loaded without error
+func (p Package) Up() bool {
+	return p.OperStatus == OperStatusUp
+}
+
+// Device is a device managed by NSO.
+type Device struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Port    int    `json:"port,omitempty"`
+	State   struct {
+		// locked, unlocked, southbound-locked or config-locked
+		AdminState string `json:"admin-state"`
+	} `json:"state"`
+}
+
+// Alarm is an alarm raised by NSO.
+type Alarm struct {
+	Device           string `json:"device"`
+	Type             string `json:"type"`
+	ManagedObject    string `json:"managed-object"`
+	SpecificProblem  string `json:"specific-problem"`
+	Cleared          bool   `json:"is-cleared"`
+	Severity         string `json:"last-perceived-severity"`
+	Text             string `json:"last-alarm-text"`
+	LastStatusChange string `json:"last-status-change"`
+}
+
+// HAStatus is the high availability state of an NSO instance.
+type HAStatus struct {
+	// none, primary, secondary or relay-secondary
+	Mode         string `json:"mode"`
+	CurrentID    string `json:"current-id,omitempty"`
+	AssignedRole string `json:"assigned-role,omitempty"`
+	ReadOnly     bool   `json:"read-only-mode,omitempty"`
+	// Secondaries connected to a primary
+	ConnectedSecondaries []HANode `json:"connected-secondary,omitempty"`
+}
+
+// HANode is a member of an NSO high availability group.
+type HANode struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// ActionResult is the output of the device actions, e.g. sync-from.
+type ActionResult struct {
+	Result bool   `json:"result"`
+	Info   string `json:"info,omitempty"`
+}
+
+// Version returns the NSO version, e.g. 6.3.1
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var result struct {
+		Version string `json:"tailf-ncs-monitoring:version"`
+	}
+	if err := c.do(ctx, http.MethodGet, VersionPath, nil, &result); err != nil {
+		return "", err
+	}
+	return result.Version, nil
+}
+
+// Packages returns the packages loaded by NSO
+func (c *Client) Packages(ctx context.Context) ([]Package, error) {
+	var result struct {
+		Packages struct {
+			Package []struct {
+				Name       string                     `json:"name"`
+				Version    string                     `json:"package-version"`
+				OperStatus map[string]json.RawMessage `json:"oper-status"`
+			} `json:"package"`
+		} `json:"tailf-ncs:packages"`
+	}
+	if err := c.do(ctx, http.MethodGet, PackagesPath, nil, &result); err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	packages := make([]Package, 0, len(result.Packages.Package))
+	for _, item := range result.Packages.Package {
+		pkg := Package{Name: item.Name, Version: item.Version}
+		if raw, ok := item.OperStatus["error-info"]; ok {
+			_ = json.Unmarshal(raw, &pkg.ErrorInfo)
+		}
+		// The oper-status is a choice of empty leaves, named after the
+		// outcome of the loading
+		var cases []string
+		for name := range item.OperStatus {
+			if name != "error-info" {
+				cases = append(cases, name)
+			}
+		}
+		sort.Strings(cases)
+		if _, ok := item.OperStatus[OperStatusUp]; ok {
+			pkg.OperStatus = OperStatusUp
+		} else if len(cases) > 0 {
+			pkg.OperStatus = cases[0]
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// Devices returns the devices managed by NSO, without their configuration
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	var result struct {
+		Devices []Device `json:"tailf-ncs:device"`
+	}
+	err := c.do(ctx, http.MethodGet, DevicesPath+"?fields=name;address;port;state/admin-state", nil, &result)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	return result.Devices, err
+}
+
+// Alarms returns the alarms raised by NSO, cleared ones included
+func (c *Client) Alarms(ctx context.Context) ([]Alarm, error) {
+	var result struct {
+		Alarms []Alarm `json:"tailf-ncs-alarms:alarm"`
+	}
+	err := c.do(ctx, http.MethodGet, AlarmsPath, nil, &result)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	return result.Alarms, err
+}
+
+// HAStatus returns the high availability state of NSO
+func (c *Client) HAStatus(ctx context.Context) (*HAStatus, error) {
+	var result struct {
+		Status HAStatus `json:"tailf-ncs-high-availability:status"`
+	}
+	if err := c.do(ctx, http.MethodGet, HAStatusPath, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Status, nil
+}
+
+// Action invokes the YANG action at the path of the RESTCONF datastore, e.g.
+// tailf-ncs:devices/device=ce0/sync-from, and decodes its output in out when
+// given. The input is sent when not nil.
+func (c *Client) Action(ctx context.Context, path string, input, out any) error {
+	var body any
+	if input != nil {
+		body = map[string]any{"input": input}
+	}
+	var result map[string]json.RawMessage
+	if err := c.do(ctx, http.MethodPost, path, body, &result); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	// The output is wrapped in a member named after the module of the
+	// action, e.g. tailf-ncs:output
+	for _, output := range result {
+		if err := json.Unmarshal(output, out); err != nil {
+			return fmt.Errorf("unexpected output of action %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// SyncFrom reads the configuration of the device into NSO
+func (c *Client) SyncFrom(ctx context.Context, device string) (*ActionResult, error) {
+	result := &ActionResult{}
+	if err := c.Action(ctx, "tailf-ncs:devices/"+ListKey("device", device)+"/sync-from", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
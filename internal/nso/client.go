@@ -0,0 +1,235 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nso talks to the NSO instances through their RESTCONF northbound
+// API.
+package nso
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Media type of the RESTCONF requests and responses
+	MediaType = "application/yang-data+json"
+	// Key of the NSO admin Secret holding the password
+	PasswordKey = "password"
+
+	// Time allowed for a request when the options do not set one
+	defaultTimeout = 30 * time.Second
+	// Upper bound of the size of a response
+	maxResponseSize = 16 << 20
+)
+
+// Options configures the connection to the RESTCONF API of an NSO instance.
+type Options struct {
+	// Root of the RESTCONF API, e.g. https://nso-0.nso.default.svc:8888/restconf
+	URL string
+	// Credentials of the NSO user the requests are made as
+	Username string
+	Password string
+	// PEM encoded certificates the server certificate is verified with. The
+	// system roots are used when empty.
+	CACert []byte
+	// Name the server certificate is verified for, the URL host when empty
+	ServerName string
+	// Skips the verification of the server certificate
+	InsecureSkipVerify bool
+	// Time allowed for each request, 30s when zero
+	Timeout time.Duration
+}
+
+// Client makes typed requests to the RESTCONF API of an NSO instance.
+type Client struct {
+	url        string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// Error is a request rejected by NSO, with the first error of the RESTCONF
+// errors it returned.
+type Error struct {
+	StatusCode int
+	// RESTCONF error-tag, e.g. invalid-value
+	Tag     string
+	Message string
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("RESTCONF request failed with status %d", e.StatusCode)
+	if e.Tag != "" {
+		message += " (" + e.Tag + ")"
+	}
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+	return message
+}
+
+// IsNotFound returns whether the error is a request for data NSO does not hold
+func IsNotFound(err error) bool {
+	var restconfErr *Error
+	return errors.As(err, &restconfErr) && restconfErr.StatusCode == http.StatusNotFound
+}
+
+// New returns a client of the RESTCONF API of the options
+func New(options Options) (*Client, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("no RESTCONF URL given")
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify, // #nosec G402 -- explicitly asked for
+	}
+	if len(options.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(options.CACert) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &Client{
+		url:        strings.TrimSuffix(options.URL, "/"),
+		username:   options.Username,
+		password:   options.Password,
+		httpClient: &http.Client{Transport: transport, Timeout: timeout},
+	}, nil
+}
+
+// PodURL returns the root of the RESTCONF API of an NSO pod, addressed
+// through the DNS record the headless Service gives it
+func PodURL(scheme, pod, service, namespace string, port int32) string {
+	return fmt.Sprintf("%s://%s.%s.%s.svc:%d/restconf", scheme, pod, service, namespace, port)
+}
+
+// PasswordFromSecret returns the NSO admin password held by the Secret
+func PasswordFromSecret(ctx context.Context, reader client.Reader, namespace, name string) (string, error) {
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		return "", err
+	}
+	password, ok := secret.Data[PasswordKey]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no %s key", namespace, name, PasswordKey)
+	}
+	return string(password), nil
+}
+
+// ListKey returns the path segment of the list entry with the given key,
+// e.g. device=ce0
+func ListKey(list, key string) string {
+	return list + "=" + escapeKey(key)
+}
+
+// Returns the key percent-encoded as RESTCONF expects in a path segment
+func escapeKey(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		if b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || strings.IndexByte("-._~", b) >= 0 {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// Function to make a request to a path of the RESTCONF datastore, e.g.
+// tailf-ncs:packages, sending the body as JSON and decoding the response in
+// out when given
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var content io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+"/data/"+path, content)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Accept", MediaType)
+	if body != nil {
+		req.Header.Set("Content-Type", MediaType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("RESTCONF request %s %s failed: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("RESTCONF request %s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return responseError(resp.StatusCode, data)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unexpected response to RESTCONF request %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Returns the error of a rejected request with the first of the RESTCONF
+// errors of the response
+func responseError(statusCode int, data []byte) error {
+	var errs struct {
+		Errors struct {
+			Error []struct {
+				Tag     string `json:"error-tag"`
+				Message string `json:"error-message"`
+			} `json:"error"`
+		} `json:"ietf-restconf:errors"`
+	}
+	restconfErr := &Error{StatusCode: statusCode, Message: http.StatusText(statusCode)}
+	if json.Unmarshal(data, &errs) == nil && len(errs.Errors.Error) > 0 {
+		restconfErr.Tag = errs.Errors.Error[0].Tag
+		if errs.Errors.Error[0].Message != "" {
+			restconfErr.Message = errs.Errors.Error[0].Message
+		}
+	}
+	return restconfErr
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nso
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/carlosgrillet/nso-operator/internal/nso/nsotest"
+)
+
+var _ = Describe("RESTCONF client", func() {
+	ctx := context.Background()
+
+	var (
+		server   *nsotest.Server
+		restconf *Client
+	)
+
+	BeforeEach(func() {
+		server = nsotest.NewServer()
+		DeferCleanup(server.Close)
+
+		var err error
+		restconf, err = New(Options{URL: server.RESTCONFURL(), Username: nsotest.Username, Password: nsotest.Password})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should read the NSO version", func() {
+		server.SetVersion("6.4.2")
+
+		version, err := restconf.Version(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("6.4.2"))
+		Expect(server.Requests()).To(Equal([]string{"GET tailf-ncs-monitoring:ncs-state/version"}))
+	})
+
+	It("should report the oper-status of the packages", func() {
+		server.SetPackages(
+			nsotest.Package{Name: "cisco-ios-cli-6.85", Version: "6.85.3", OperStatus: "up"},
+			nsotest.Package{Name: "l3vpn", Version: "1.0", OperStatus: "java-uninitialized", ErrorInfo: "ClassNotFoundException"},
+		)
+
+		packages, err := restconf.Packages(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(Equal([]Package{
+			{Name: "cisco-ios-cli-6.85", Version: "6.85.3", OperStatus: OperStatusUp},
+			{Name: "l3vpn", Version: "1.0", OperStatus: "java-uninitialized", ErrorInfo: "ClassNotFoundException"},
+		}))
+		Expect(packages[0].Up()).To(BeTrue())
+		Expect(packages[1].Up()).To(BeFalse())
+	})
+
+	It("should list the devices without their configuration", func() {
+		devices, err := restconf.Devices(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(BeEmpty())
+
+		server.SetDevices(nsotest.Device{Name: "ce0", Address: "10.0.0.1", Port: 22, AdminState: "unlocked"})
+		devices, err = restconf.Devices(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(HaveLen(1))
+		Expect(devices[0].Name).To(Equal("ce0"))
+		Expect(devices[0].Port).To(Equal(22))
+		Expect(devices[0].State.AdminState).To(Equal("unlocked"))
+	})
+
+	It("should list the alarms", func() {
+		server.SetAlarms(nsotest.Alarm{
+			Device:   "ce0",
+			Type:     "tailf-ncs-alarms:connection-failure",
+			Severity: "major",
+			Text:     "Failed to connect to device ce0",
+		})
+
+		alarms, err := restconf.Alarms(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alarms).To(Equal([]Alarm{{
+			Device:   "ce0",
+			Type:     "tailf-ncs-alarms:connection-failure",
+			Severity: "major",
+			Text:     "Failed to connect to device ce0",
+		}}))
+	})
+
+	It("should read the high availability status", func() {
+		server.SetHAStatus(nsotest.HAStatus{Mode: "primary", CurrentID: "nso-0", AssignedRole: "primary"})
+
+		status, err := restconf.HAStatus(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Mode).To(Equal("primary"))
+		Expect(status.CurrentID).To(Equal("nso-0"))
+		Expect(status.ReadOnly).To(BeFalse())
+	})
+
+	It("should invoke actions with their input and decode their output", func() {
+		var received json.RawMessage
+		server.HandleAction("tailf-ncs:devices/device=ce%2F0/sync-from", func(input json.RawMessage) (any, error) {
+			return map[string]any{"result": false, "info": "connection refused"}, nil
+		})
+		server.HandleAction("tailf-ncs:devices/check-sync", func(input json.RawMessage) (any, error) {
+			received = input
+			return nil, nil
+		})
+
+		result, err := restconf.SyncFrom(ctx, "ce/0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&ActionResult{Result: false, Info: "connection refused"}))
+
+		Expect(restconf.Action(ctx, "tailf-ncs:devices/check-sync", map[string]any{"outformat": "cli"}, nil)).To(Succeed())
+		Expect(received).To(MatchJSON(`{"outformat":"cli"}`))
+	})
+
+	It("should return the RESTCONF errors", func() {
+		server.HandleAction("tailf-ncs:devices/device=ce0/sync-from", func(json.RawMessage) (any, error) {
+			return nil, errors.New("device ce0 is locked")
+		})
+		_, err := restconf.SyncFrom(ctx, "ce0")
+		Expect(err).To(MatchError("RESTCONF request failed with status 400 (operation-failed): device ce0 is locked"))
+		Expect(IsNotFound(err)).To(BeFalse())
+
+		_, err = restconf.SyncFrom(ctx, "ce1")
+		Expect(IsNotFound(err)).To(BeTrue())
+
+		By("rejecting wrong credentials")
+		server.SetCredentials("admin", "other")
+		_, err = restconf.Version(ctx)
+		Expect(err).To(MatchError(ContainSubstring("status 401 (access-denied)")))
+	})
+
+	It("should time out requests", func() {
+		server.HandleAction("tailf-ncs:devices/device=ce0/sync-from", func(json.RawMessage) (any, error) {
+			time.Sleep(200 * time.Millisecond)
+			return nil, nil
+		})
+		slow, err := New(Options{URL: server.RESTCONFURL(), Username: nsotest.Username, Password: nsotest.Password, Timeout: 50 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = slow.SyncFrom(ctx, "ce0")
+		Expect(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+	})
+
+	Context("When connecting over TLS", func() {
+		var tlsServer *nsotest.Server
+
+		BeforeEach(func() {
+			tlsServer = nsotest.NewTLSServer()
+			DeferCleanup(tlsServer.Close)
+		})
+
+		It("should verify the server certificate with the CA bundle", func() {
+			options := Options{URL: tlsServer.RESTCONFURL(), Username: nsotest.Username, Password: nsotest.Password}
+			untrusted, err := New(options)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = untrusted.Version(ctx)
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+			options.CACert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+			trusted, err := New(options)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trusted.Version(ctx)).To(Equal("6.3.1"))
+
+			By("skipping the verification when asked to")
+			insecure, err := New(Options{URL: tlsServer.RESTCONFURL(), Username: nsotest.Username, Password: nsotest.Password, InsecureSkipVerify: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(insecure.Version(ctx)).To(Equal("6.3.1"))
+		})
+
+		It("should reject a CA bundle without certificates", func() {
+			_, err := New(Options{URL: tlsServer.RESTCONFURL(), CACert: []byte("not a certificate")})
+			Expect(err).To(MatchError("no certificate found in the CA bundle"))
+		})
+	})
+
+	It("should address the pods through the headless Service", func() {
+		Expect(PodURL("https", "nso-1", "nso-svc", "nso", 8888)).To(Equal("https://nso-1.nso-svc.nso.svc:8888/restconf"))
+	})
+
+	It("should read the admin password from its Secret", func() {
+		reader := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "nso-admin", Namespace: "nso"},
+			Data:       map[string][]byte{PasswordKey: []byte("nso-secret")},
+		}).Build()
+
+		password, err := PasswordFromSecret(ctx, reader, "nso", "nso-admin")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password).To(Equal("nso-secret"))
+
+		_, err = PasswordFromSecret(ctx, reader, "nso", "missing")
+		Expect(err).To(HaveOccurred())
+	})
+})
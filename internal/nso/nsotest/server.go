@@ -0,0 +1,334 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nsotest provides a local RESTCONF server answering like NSO, to
+// test the code talking to NSO without running it.
+package nsotest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	// Credentials the server accepts unless changed
+	Username = "admin"
+	Password = "admin"
+
+	dataPrefix = "/restconf/data/"
+)
+
+// Package is an NSO package as reported in tailf-ncs:packages.
+type Package struct {
+	Name    string
+	Version string
+	// up, or the case of the failure, e.g. java-uninitialized
+	OperStatus string
+	ErrorInfo  string
+}
+
+// Device is a device managed by NSO.
+type Device struct {
+	Name       string
+	Address    string
+	Port       int
+	AdminState string
+}
+
+// Alarm is an alarm raised by NSO.
+type Alarm struct {
+	Device   string
+	Type     string
+	Severity string
+	Text     string
+	Cleared  bool
+}
+
+// HAStatus is the high availability state of NSO.
+type HAStatus struct {
+	Mode         string
+	CurrentID    string
+	AssignedRole string
+	ReadOnly     bool
+}
+
+// ActionHandler answers the invocation of an action with its output, or an
+// error returned as an operation-failed RESTCONF error.
+type ActionHandler func(input json.RawMessage) (any, error)
+
+// Server is a RESTCONF server holding the NSO state set by the test. Its
+// requests are recorded as "METHOD path", the path being relative to the
+// RESTCONF datastore.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	username    string
+	password    string
+	unavailable bool
+	version     string
+	packages    []Package
+	devices     []Device
+	alarms      []Alarm
+	ha          HAStatus
+	actions     map[string]ActionHandler
+	requests    []string
+}
+
+// NewServer starts a plain HTTP server for NSO 6.3.1, without packages,
+// devices or alarms
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// NewTLSServer starts a server like NewServer serving HTTPS. Its certificate
+// is s.Certificate().
+func NewTLSServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewTLSServer(s)
+	return s
+}
+
+// Returns a server with the state of a freshly started NSO
+func newServer() *Server {
+	return &Server{
+		username: Username,
+		password: Password,
+		version:  "6.3.1",
+		ha:       HAStatus{Mode: "none"},
+		actions:  map[string]ActionHandler{},
+	}
+}
+
+// RESTCONFURL returns the root of the RESTCONF API of the server
+func (s *Server) RESTCONFURL() string {
+	return s.URL + "/restconf"
+}
+
+// SetCredentials changes the credentials the server accepts
+func (s *Server) SetCredentials(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// SetUnavailable makes the server answer 503, as NSO does while starting
+func (s *Server) SetUnavailable(unavailable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unavailable = unavailable
+}
+
+// SetVersion sets the NSO version
+func (s *Server) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// SetPackages sets the loaded packages
+func (s *Server) SetPackages(packages ...Package) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packages = packages
+}
+
+// SetDevices sets the managed devices
+func (s *Server) SetDevices(devices ...Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = devices
+}
+
+// SetAlarms sets the raised alarms
+func (s *Server) SetAlarms(alarms ...Alarm) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alarms = alarms
+}
+
+// SetHAStatus sets the high availability state
+func (s *Server) SetHAStatus(status HAStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ha = status
+}
+
+// HandleAction answers the invocations of the action at the path of the
+// datastore, e.g. tailf-ncs:devices/device=ce0/sync-from
+func (s *Server) HandleAction(path string, handler ActionHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions[path] = handler
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	path := strings.TrimPrefix(req.URL.EscapedPath(), dataPrefix)
+	s.requests = append(s.requests, req.Method+" "+path)
+	username, password, ok := req.BasicAuth()
+	authorized := ok && username == s.username && password == s.password
+	unavailable := s.unavailable
+	s.mu.Unlock()
+
+	switch {
+	case !authorized:
+		writeError(w, http.StatusUnauthorized, "access-denied", "access denied")
+	case unavailable:
+		writeError(w, http.StatusServiceUnavailable, "resource-denied", "NSO is starting")
+	case !strings.HasPrefix(req.URL.EscapedPath(), dataPrefix):
+		writeError(w, http.StatusNotFound, "invalid-value", "uri keypath not found")
+	case req.Method == http.MethodGet:
+		s.get(w, path)
+	case req.Method == http.MethodPost:
+		s.invoke(w, req, path)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "operation-not-supported", "method not supported")
+	}
+}
+
+// Function to answer a GET request with the data at the path
+func (s *Server) get(w http.ResponseWriter, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data any
+	switch path {
+	case "tailf-ncs-monitoring:ncs-state/version":
+		data = map[string]any{"tailf-ncs-monitoring:version": s.version}
+	case "tailf-ncs:packages":
+		packages := []map[string]any{}
+		for _, pkg := range s.packages {
+			operStatus := map[string]any{pkg.OperStatus: []any{nil}}
+			if pkg.ErrorInfo != "" {
+				operStatus["error-info"] = pkg.ErrorInfo
+			}
+			packages = append(packages, map[string]any{
+				"name":            pkg.Name,
+				"package-version": pkg.Version,
+				"oper-status":     operStatus,
+			})
+		}
+		data = map[string]any{"tailf-ncs:packages": map[string]any{"package": packages}}
+	case "tailf-ncs:devices/device":
+		devices := []map[string]any{}
+		for _, device := range s.devices {
+			devices = append(devices, map[string]any{
+				"name":    device.Name,
+				"address": device.Address,
+				"port":    device.Port,
+				"state":   map[string]any{"admin-state": device.AdminState},
+			})
+		}
+		if len(devices) == 0 {
+			writeError(w, http.StatusNotFound, "invalid-value", "uri keypath not found")
+			return
+		}
+		data = map[string]any{"tailf-ncs:device": devices}
+	case "tailf-ncs-alarms:alarms/alarm-list/alarm":
+		alarms := []map[string]any{}
+		for _, alarm := range s.alarms {
+			alarms = append(alarms, map[string]any{
+				"device":                  alarm.Device,
+				"type":                    alarm.Type,
+				"is-cleared":              alarm.Cleared,
+				"last-perceived-severity": alarm.Severity,
+				"last-alarm-text":         alarm.Text,
+			})
+		}
+		if len(alarms) == 0 {
+			writeError(w, http.StatusNotFound, "invalid-value", "uri keypath not found")
+			return
+		}
+		data = map[string]any{"tailf-ncs-alarms:alarm": alarms}
+	case "tailf-ncs-high-availability:high-availability/status":
+		status := map[string]any{"mode": s.ha.Mode, "read-only-mode": s.ha.ReadOnly}
+		if s.ha.CurrentID != "" {
+			status["current-id"] = s.ha.CurrentID
+		}
+		if s.ha.AssignedRole != "" {
+			status["assigned-role"] = s.ha.AssignedRole
+		}
+		data = map[string]any{"tailf-ncs-high-availability:status": status}
+	default:
+		writeError(w, http.StatusNotFound, "invalid-value", "uri keypath not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// Function to answer a POST request by invoking the action at the path
+func (s *Server) invoke(w http.ResponseWriter, req *http.Request, path string) {
+	s.mu.Lock()
+	handler, ok := s.actions[path]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid-value", "uri keypath not found")
+		return
+	}
+	var body struct {
+		Input json.RawMessage `json:"input"`
+	}
+	if content, err := io.ReadAll(req.Body); err == nil && len(content) > 0 {
+		if err := json.Unmarshal(content, &body); err != nil {
+			writeError(w, http.StatusBadRequest, "malformed-message", err.Error())
+			return
+		}
+	}
+
+	output, err := handler(body.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "operation-failed", err.Error())
+		return
+	}
+	if output == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// The output is named after the module of the action
+	module, _, _ := strings.Cut(path, ":")
+	writeJSON(w, http.StatusOK, map[string]any{module + ":output": output})
+}
+
+// Function to write the data as a RESTCONF JSON response
+func writeJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/yang-data+json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+// Function to write a RESTCONF error response
+func writeError(w http.ResponseWriter, statusCode int, tag, message string) {
+	writeJSON(w, statusCode, map[string]any{
+		"ietf-restconf:errors": map[string]any{
+			"error": []map[string]any{{"error-type": "application", "error-tag": tag, "error-message": message}},
+		},
+	})
+}
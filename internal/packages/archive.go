@@ -0,0 +1,277 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suffixes of the package tarballs unpacked in the source directory
+var packageArchiveSuffixes = []string{".tar.gz", ".tgz"}
+
+// Function to download the gzip compressed tar archive of the source and
+// unpack it into dir. The archive must match the checksum of the source, when
+// set, before anything is unpacked. Returns the sha256 digest of the archive.
+func downloadArchive(ctx context.Context, source Source, dir string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := setHTTPAuth(request, source); err != nil {
+		return "", err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if source.InsecureTLS {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- requested with insecureTLS
+	}
+	response, err := (&http.Client{Transport: transport}).Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", source.URL, err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", source.URL, response.Status)
+	}
+
+	// The archive is kept next to dir until its digest is verified
+	archive, err := os.CreateTemp(filepath.Dir(dir), "archive-")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = archive.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(archive, hash), response.Body); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", source.URL, err)
+	}
+	digest := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if source.Checksum != "" && !strings.EqualFold(source.Checksum, digest) {
+		return "", fmt.Errorf("checksum mismatch: the archive digest is %s, expected %s", digest, source.Checksum)
+	}
+
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := unpackArchive(archive, dir); err != nil {
+		return "", fmt.Errorf("invalid archive %s: %w", source.URL, err)
+	}
+	return digest, nil
+}
+
+// Function to set the credentials of the credentials directory on the
+// request: a bearer token, or a username and password
+func setHTTPAuth(request *http.Request, source Source) error {
+	if source.CredentialsDir == "" {
+		return nil
+	}
+	token, err := readCredential(source.CredentialsDir, TokenFile)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	username, err := readCredential(source.CredentialsDir, UsernameFile)
+	if err != nil {
+		return err
+	}
+	password, err := readCredential(source.CredentialsDir, PasswordFile)
+	if err != nil {
+		return err
+	}
+	if username != "" || password != "" {
+		request.SetBasicAuth(username, password)
+	}
+	return nil
+}
+
+// Function to unpack a gzip compressed tar archive into dir. Only
+// directories, regular files and symbolic links resolving inside dir are
+// unpacked. The files are written through an os.Root of dir, and the links
+// are only created once every file is written, so that no entry is ever
+// written through a link.
+func unpackArchive(archive io.Reader, dir string) error {
+	uncompressed, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("not a gzip compressed tar file: %w", err)
+	}
+	defer func() { _ = uncompressed.Close() }()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = root.Close() }()
+
+	var links []*tar.Header
+	reader := tar.NewReader(uncompressed)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("entry %q is outside of the archive", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := mkdirAll(root, name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := mkdirAll(root, filepath.Dir(name)); err != nil {
+				return err
+			}
+			if err := writeFile(root, name, reader, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), header.Linkname)) {
+				return fmt.Errorf("link %q points outside of the archive", header.Name)
+			}
+			links = append(links, header)
+		}
+	}
+	return createLinks(root, dir, links)
+}
+
+// Function to create the symbolic links of an archive in dir, checking that
+// none is created below another link or resolves outside of dir
+func createLinks(root *os.Root, dir string, links []*tar.Header) error {
+	for _, header := range links {
+		name := filepath.Clean(header.Name)
+		parent := filepath.Dir(name)
+		if err := mkdirAll(root, parent); err != nil {
+			return err
+		}
+		for prefix := parent; prefix != "."; prefix = filepath.Dir(prefix) {
+			info, err := root.Lstat(prefix)
+			if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("entry %q is below the link %q", header.Name, prefix)
+			}
+		}
+		if err := os.Symlink(header.Linkname, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	// A link may resolve through the links created after it
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	for _, header := range links {
+		target, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.Clean(header.Name)))
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("link %q points to a missing file", header.Name)
+		} else if err != nil {
+			return err
+		}
+		if relative, err := filepath.Rel(resolvedDir, target); err != nil || !filepath.IsLocal(relative) {
+			return fmt.Errorf("link %q points outside of the archive", header.Name)
+		}
+	}
+	return nil
+}
+
+// Function to create the directory name of the root and its parents
+func mkdirAll(root *os.Root, name string) error {
+	if name == "." {
+		return nil
+	}
+	if err := mkdirAll(root, filepath.Dir(name)); err != nil {
+		return err
+	}
+	if err := root.Mkdir(name, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// Function to write the content to a new file of the root, readable by
+// everyone so that NSO can load it whatever its user
+func writeFile(root *os.Root, name string, content io.Reader, mode os.FileMode) error {
+	file, err := root.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode|0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Function to unpack the package tarballs of dir, such as the NED tarballs
+// of the NSO releases, in place
+func unpackPackageArchives(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isPackageArchive(entry.Name()) {
+			continue
+		}
+		name := filepath.Join(dir, entry.Name())
+		archive, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = unpackArchive(archive, dir)
+		_ = archive.Close()
+		if err != nil {
+			return fmt.Errorf("invalid package archive %s: %w", entry.Name(), err)
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns whether the file name is the one of a package tarball
+func isPackageArchive(name string) bool {
+	for _, suffix := range packageArchiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
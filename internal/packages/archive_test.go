@@ -0,0 +1,287 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Returns a gzip compressed tar archive of the files, and of the symbolic
+// links when their content starts with "->"
+func tarGz(files map[string]string) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(compressed)
+	for _, name := range names {
+		content := files[name]
+		header := &tar.Header{Name: name, Mode: 0o600, Typeflag: tar.TypeReg, Size: int64(len(content))}
+		if target, ok := bytes.CutPrefix([]byte(content), []byte("->")); ok {
+			header = &tar.Header{Name: name, Mode: 0o777, Typeflag: tar.TypeSymlink, Linkname: string(target)}
+			content = ""
+		}
+		Expect(writer.WriteHeader(header)).To(Succeed())
+		_, err := writer.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(writer.Close()).To(Succeed())
+	Expect(compressed.Close()).To(Succeed())
+	return buffer.Bytes()
+}
+
+// Returns the sha256 digest of the content, as sha256:<hex>
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("Archive download", func() {
+	ctx := context.Background()
+
+	var (
+		archives map[string][]byte
+		server   *httptest.Server
+		storeDir string
+	)
+
+	fetch := func(source Source) (*Result, error) {
+		source.Origin = OriginURL
+		source.URL = server.URL + source.URL
+		return Fetch(ctx, source, filepath.Join(storeDir, "bundle"))
+	}
+
+	BeforeEach(func() {
+		archives = map[string][]byte{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			archive, ok := archives[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(archive)
+		}))
+		DeferCleanup(server.Close)
+		storeDir = GinkgoT().TempDir()
+	})
+
+	It("should unpack the packages of the archive and record its digest", func() {
+		archives["/packages.tar.gz"] = tarGz(map[string]string{
+			"README.md":                                "NSO packages",
+			"packages/l3vpn/package-meta-data.xml":     packageMetaData("l3vpn"),
+			"packages/l3vpn/templates/l3vpn.xml":       "<config/>",
+			"packages/l3vpn/templates/current.xml":     "->l3vpn.xml",
+			"packages/cisco-ios/package-meta-data.xml": packageMetaData("cisco-ios-cli-6.85"),
+		})
+		digest := sha256Digest(archives["/packages.tar.gz"])
+
+		result, err := fetch(Source{URL: "/packages.tar.gz", Path: "packages", Checksum: digest})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&Result{Digest: digest, Packages: []string{"cisco-ios", "l3vpn"}}))
+
+		templates := filepath.Join(storeDir, "bundle", "l3vpn", "templates")
+		Expect(os.ReadFile(filepath.Join(templates, "current.xml"))).To(BeEquivalentTo("<config/>"))
+		info, err := os.Stat(filepath.Join(templates, "l3vpn.xml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o644)))
+
+		By("leaving nothing else in the store")
+		entries, err := os.ReadDir(storeDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("should keep the previous download when the archive does not match the checksum", func() {
+		archives["/packages.tar.gz"] = tarGz(map[string]string{"l3vpn/package-meta-data.xml": packageMetaData("l3vpn")})
+		digest := sha256Digest(archives["/packages.tar.gz"])
+		_, err := fetch(Source{URL: "/packages.tar.gz"})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("refusing a tampered archive")
+		archives["/packages.tar.gz"] = tarGz(map[string]string{"evil/package-meta-data.xml": packageMetaData("evil")})
+		_, err = fetch(Source{URL: "/packages.tar.gz", Checksum: digest})
+		Expect(err).To(MatchError("checksum mismatch: the archive digest is " +
+			sha256Digest(archives["/packages.tar.gz"]) + ", expected " + digest))
+
+		By("refusing a partial archive")
+		partial := tarGz(map[string]string{"mpls/package-meta-data.xml": packageMetaData("mpls")})
+		archives["/partial.tar.gz"] = partial[:len(partial)/2]
+		_, err = fetch(Source{URL: "/partial.tar.gz"})
+		Expect(err).To(MatchError(ContainSubstring("invalid archive " + server.URL + "/partial.tar.gz")))
+
+		By("refusing a missing archive")
+		_, err = fetch(Source{URL: "/missing.tar.gz"})
+		Expect(err).To(MatchError("failed to download " + server.URL + "/missing.tar.gz: 404 Not Found"))
+
+		Expect(filepath.Join(storeDir, "bundle", "l3vpn")).To(BeADirectory())
+		Expect(filepath.Join(storeDir, "bundle", "evil")).NotTo(BeADirectory())
+		entries, err := os.ReadDir(storeDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("should unpack the package tarballs of the archive", func() {
+		archives["/release.tar.gz"] = tarGz(map[string]string{
+			"neds/ncs-6.4-cisco-ios-6.85.tar.gz": string(tarGz(map[string]string{
+				"cisco-ios-cli-6.85/package-meta-data.xml": packageMetaData("cisco-ios-cli-6.85"),
+			})),
+			"neds/ncs-6.4-cisco-iosxr-7.52.tgz": string(tarGz(map[string]string{
+				"cisco-iosxr-cli-7.52/package-meta-data.xml": packageMetaData("cisco-iosxr-cli-7.52"),
+			})),
+			"neds/README.md": "Cisco NEDs",
+		})
+
+		result, err := fetch(Source{URL: "/release.tar.gz", Path: "/neds"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Packages).To(Equal([]string{"cisco-ios-cli-6.85", "cisco-iosxr-cli-7.52"}))
+		Expect(filepath.Join(storeDir, "bundle", "cisco-ios-cli-6.85", "package-meta-data.xml")).To(BeARegularFile())
+		Expect(filepath.Join(storeDir, "bundle", "ncs-6.4-cisco-ios-6.85.tar.gz")).NotTo(BeAnExistingFile())
+
+		By("refusing an invalid package tarball")
+		archives["/release.tar.gz"] = tarGz(map[string]string{"neds/broken.tgz": "not an archive"})
+		_, err = fetch(Source{URL: "/release.tar.gz", Path: "/neds"})
+		Expect(err).To(MatchError(ContainSubstring("invalid package archive broken.tgz: not a gzip compressed tar file")))
+	})
+
+	It("should refuse entries outside of the archive", func() {
+		archives["/escape.tar.gz"] = tarGz(map[string]string{
+			"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+			"../../etc/passwd":            "root::0:0::/:/bin/sh",
+		})
+		_, err := fetch(Source{URL: "/escape.tar.gz"})
+		Expect(err).To(MatchError(ContainSubstring(`entry "../../etc/passwd" is outside of the archive`)))
+
+		archives["/link.tar.gz"] = tarGz(map[string]string{
+			"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+			"l3vpn/passwd":                "->../../etc/passwd",
+		})
+		_, err = fetch(Source{URL: "/link.tar.gz"})
+		Expect(err).To(MatchError(ContainSubstring(`link "l3vpn/passwd" points outside of the archive`)))
+
+		archives["/absolute.tar.gz"] = tarGz(map[string]string{
+			"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+			"l3vpn/passwd":                "->/etc/passwd",
+		})
+		_, err = fetch(Source{URL: "/absolute.tar.gz"})
+		Expect(err).To(MatchError(ContainSubstring(`link "l3vpn/passwd" points outside of the archive`)))
+		Expect(filepath.Join(storeDir, "bundle")).NotTo(BeADirectory())
+
+		By("refusing entries written through the links of the archive")
+		parent := GinkgoT().TempDir()
+		dir := filepath.Join(parent, "source")
+		Expect(os.Mkdir(dir, 0o755)).To(Succeed())
+		err = unpackArchive(bytes.NewReader(tarGz(map[string]string{
+			"x":        "->.",
+			"x/y":      "->..",
+			"x/y/evil": "escaped",
+		})), dir)
+		Expect(err).To(HaveOccurred())
+		Expect(filepath.Join(parent, "evil")).NotTo(BeAnExistingFile())
+
+		By("refusing links resolving outside of the archive through other links")
+		dir = filepath.Join(parent, "links")
+		Expect(os.Mkdir(dir, 0o755)).To(Succeed())
+		err = unpackArchive(bytes.NewReader(tarGz(map[string]string{
+			"x": "->.",
+			"y": "->x/..",
+		})), dir)
+		Expect(err).To(MatchError(`link "y" points outside of the archive`))
+	})
+
+	Context("When the source needs credentials", func() {
+		var credentialsDir string
+
+		BeforeEach(func() {
+			credentialsDir = GinkgoT().TempDir()
+			archive := tarGz(map[string]string{"l3vpn/package-meta-data.xml": packageMetaData("l3vpn")})
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				username, password, ok := r.BasicAuth()
+				if r.Header.Get("Authorization") != "Bearer t0ken" && (!ok || username != "ci" || password != "s3cret") {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write(archive)
+			})
+		})
+
+		It("should authenticate with the username and password", func() {
+			_, err := fetch(Source{URL: "/packages.tar.gz", CredentialsDir: credentialsDir})
+			Expect(err).To(MatchError("failed to download " + server.URL + "/packages.tar.gz: 401 Unauthorized"))
+
+			Expect(os.WriteFile(filepath.Join(credentialsDir, UsernameFile), []byte("ci"), 0o600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(credentialsDir, PasswordFile), []byte("s3cret\n"), 0o600)).To(Succeed())
+			_, err = fetch(Source{URL: "/packages.tar.gz", CredentialsDir: credentialsDir})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should authenticate with the bearer token", func() {
+			Expect(os.WriteFile(filepath.Join(credentialsDir, TokenFile), []byte("t0ken\n"), 0o600)).To(Succeed())
+			_, err := fetch(Source{URL: "/packages.tar.gz", CredentialsDir: credentialsDir})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	It("should accept self-signed certificates with insecureTLS", func() {
+		archive := tarGz(map[string]string{"l3vpn/package-meta-data.xml": packageMetaData("l3vpn")})
+		tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(archive)
+		}))
+		DeferCleanup(tlsServer.Close)
+		source := Source{Origin: OriginURL, URL: tlsServer.URL + "/packages.tar.gz"}
+
+		_, err := Fetch(ctx, source, filepath.Join(storeDir, "bundle"))
+		Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+		source.InsecureTLS = true
+		_, err = Fetch(ctx, source, filepath.Join(storeDir, "bundle"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should write the digest of the archive to the result file", func() {
+		archives["/packages.tar.gz"] = tarGz(map[string]string{"l3vpn/package-meta-data.xml": packageMetaData("l3vpn")})
+		digest := sha256Digest(archives["/packages.tar.gz"])
+		resultFile := filepath.Join(GinkgoT().TempDir(), "termination-log")
+		args := []string{"--origin", OriginURL, "--url", server.URL + "/packages.tar.gz",
+			"--dest", filepath.Join(storeDir, "bundle"), "--result-file", resultFile}
+
+		Expect(Main(append(args, "--checksum", digest))).To(Equal(0))
+		content, err := os.ReadFile(resultFile)
+		Expect(err).NotTo(HaveOccurred())
+		var result Result
+		Expect(json.Unmarshal(content, &result)).To(Succeed())
+		Expect(result).To(Equal(Result{Digest: digest, Packages: []string{"l3vpn"}}))
+		Expect(string(content)).NotTo(ContainSubstring("revision"))
+	})
+})
@@ -0,0 +1,256 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package packages downloads NSO packages from the source of a PackageBundle.
+// It runs in the download Jobs of the bundles, as the FetchCommand of the
+// manager binary, and removes the previous downloads in their prune Jobs, as
+// the PruneCommand.
+package packages
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+)
+
+const (
+	// Subcommand of the manager binary downloading the packages of a bundle
+	FetchCommand = "fetch-packages"
+
+	// Origins of the packages
+	OriginSCM = "SCM"
+	OriginURL = "URL"
+	OriginOCI = "OCI"
+
+	// Files of the credentials directory, named after the keys of the
+	// credentials Secrets
+	SSHKeyFile     = "ssh-privatekey"
+	KnownHostsFile = "known_hosts"
+	UsernameFile   = "username"
+	PasswordFile   = "password"
+	TokenFile      = "token"
+
+	// File of the credentials directory holding the docker config of the
+	// registries, named after the key of the kubernetes.io/dockerconfigjson
+	// Secrets
+	DockerConfigFile = ".dockerconfigjson"
+
+	// File at the root of every NSO package
+	packageMetaDataFile = "package-meta-data.xml"
+)
+
+// Source is the location of the packages of a bundle.
+type Source struct {
+	// Kind of source, e.g. SCM
+	Origin string
+	// URL of the Git repository, or of the archive, or reference of the OCI
+	// artifact
+	URL string
+	// Branch, tag or commit the packages are checked out at, the default
+	// branch when empty
+	Ref string
+	// Directory of the source holding the packages
+	Path string
+	// Expected sha256 digest of the archive, e.g. sha256:<hex>. Not verified
+	// when empty.
+	Checksum string
+	// Directory holding the credentials, one file per key of the Secrets
+	CredentialsDir string
+	// Accepts self-signed certificates
+	InsecureTLS bool
+}
+
+// Result is the outcome of a download, written as JSON in the termination
+// message of the download container.
+type Result struct {
+	// Git commit of the packages
+	Revision string `json:"revision,omitempty"`
+	// sha256 digest of the archive of the packages, or of the manifest of the
+	// OCI artifact
+	Digest string `json:"digest,omitempty"`
+	// Names of the package directories
+	Packages []string `json:"packages"`
+}
+
+// Fetch downloads the packages of the source into the dest directory, one
+// subdirectory per package. The package tarballs of the source directory are
+// unpacked. The packages are first gathered next to dest and replace it once
+// complete, so that dest never holds a partial download.
+func Fetch(ctx context.Context, source Source, dest string) (*Result, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, err
+	}
+	work, err := os.MkdirTemp(filepath.Dir(dest), ".fetch-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(work) }()
+
+	// The path is relative to the root of the source, with or without a
+	// leading slash
+	path := filepath.Join(".", source.Path)
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("path %q is outside of the source", source.Path)
+	}
+
+	checkout := filepath.Join(work, "source")
+	result := &Result{}
+	switch source.Origin {
+	case OriginSCM:
+		result.Revision, err = cloneGit(ctx, source, checkout)
+	case OriginURL:
+		result.Digest, err = downloadArchive(ctx, source, checkout)
+	case OriginOCI:
+		result.Digest, err = pullArtifact(ctx, source, checkout)
+	default:
+		err = fmt.Errorf("unsupported origin %q", source.Origin)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDir := filepath.Join(checkout, path)
+	if _, err := os.Stat(filepath.Join(sourceDir, packageMetaDataFile)); err != nil {
+		if err := unpackPackageArchives(sourceDir); err != nil {
+			return nil, err
+		}
+	}
+	packagesDir := filepath.Join(work, "packages")
+	if result.Packages, err = collectPackages(sourceDir, packagesDir); err != nil {
+		return nil, err
+	}
+	if len(result.Packages) == 0 {
+		return nil, fmt.Errorf("no NSO package found in %s", filepath.Join("/", path))
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(packagesDir, dest); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Function to move the packages of dir to out, and return their names. dir is
+// either a single package or a directory of packages.
+func collectPackages(dir, out string) ([]string, error) {
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, packageMetaDataFile)); err == nil {
+		name, err := packageName(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []string{name}, os.Rename(dir, filepath.Join(out, name))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), packageMetaDataFile)); err != nil {
+			continue
+		}
+		if err := os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(out, entry.Name())); err != nil {
+			return nil, err
+		}
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Returns the name of the package in its meta-data
+func packageName(dir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, packageMetaDataFile))
+	if err != nil {
+		return "", err
+	}
+	var metaData struct {
+		Name string `xml:"name"`
+	}
+	if err := xml.Unmarshal(content, &metaData); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", packageMetaDataFile, err)
+	}
+	if metaData.Name == "" || !filepath.IsLocal(metaData.Name) || filepath.Base(metaData.Name) != metaData.Name {
+		return "", fmt.Errorf("invalid package name %q in %s", metaData.Name, packageMetaDataFile)
+	}
+	return metaData.Name, nil
+}
+
+// Main runs the FetchCommand with its arguments, and returns the exit code.
+// The result, or the error, is written to the result file, by default the
+// termination message of the container.
+func Main(args []string) int {
+	flags := flag.NewFlagSet(FetchCommand, flag.ContinueOnError)
+	var source Source
+	var dest, resultFile string
+	flags.StringVar(&source.Origin, "origin", OriginSCM, "Kind of source of the packages.")
+	flags.StringVar(&source.URL, "url", "", "URL of the source.")
+	flags.StringVar(&source.Checksum, "checksum", "", "Expected sha256 digest of the archive, as sha256:<hex>.")
+	flags.StringVar(&source.Ref, "ref", "", "Git branch, tag or commit to check out.")
+	flags.StringVar(&source.Path, "path", "", "Directory of the source holding the packages.")
+	flags.StringVar(&source.CredentialsDir, "credentials-dir", "", "Directory holding the credentials of the source.")
+	flags.BoolVar(&source.InsecureTLS, "insecure-tls", false, "Accept self-signed certificates.")
+	flags.StringVar(&dest, "dest", "", "Directory the packages are downloaded to.")
+	flags.StringVar(&resultFile, "result-file", "/dev/termination-log", "File the result is written to.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if source.URL == "" || dest == "" {
+		fmt.Fprintln(os.Stderr, "--url and --dest are required")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Downloading the packages of %s\n", source.URL)
+	result, err := Fetch(ctx, source, dest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to download the packages: %v\n", err)
+		_ = os.WriteFile(resultFile, []byte(err.Error()), 0o644)
+		return 1
+	}
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	revision := result.Revision
+	if revision == "" {
+		revision = result.Digest
+	}
+	fmt.Fprintf(os.Stderr, "Downloaded %d packages at %s\n", len(result.Packages), revision)
+	if err := os.WriteFile(resultFile, output, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
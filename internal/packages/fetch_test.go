@@ -0,0 +1,219 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+)
+
+// Returns the meta-data of an NSO package
+func packageMetaData(name string) string {
+	return `<ncs-package xmlns="http://tail-f.com/ns/ncs-packages"><name>` + name + `</name></ncs-package>`
+}
+
+var _ = Describe("Package download", func() {
+	ctx := context.Background()
+
+	var (
+		work     *git.Repository
+		workDir  string
+		bareDir  string
+		storeDir string
+	)
+
+	// Writes the files in the work repository and pushes them in a new
+	// commit to the bare repository
+	commit := func(files map[string]string) plumbing.Hash {
+		for name, content := range files {
+			Expect(os.MkdirAll(filepath.Join(workDir, filepath.Dir(name)), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(workDir, name), []byte(content), 0o644)).To(Succeed())
+		}
+		worktree, err := work.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(worktree.AddGlob(".")).To(Succeed())
+		hash, err := worktree.Commit("Update packages", &git.CommitOptions{
+			Author: &object.Signature{Name: "NSO", Email: "nso@example.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(work.Push(&git.PushOptions{
+			RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"},
+		})).To(Succeed())
+		return hash
+	}
+
+	fetch := func(ref, path string) (*Result, error) {
+		return Fetch(ctx, Source{Origin: OriginSCM, URL: "file://" + bareDir, Ref: ref, Path: path}, filepath.Join(storeDir, "bundle"))
+	}
+
+	BeforeEach(func() {
+		tmp := GinkgoT().TempDir()
+		workDir = filepath.Join(tmp, "work")
+		bareDir = filepath.Join(tmp, "packages.git")
+		storeDir = filepath.Join(tmp, "store")
+
+		_, err := git.PlainInit(bareDir, true)
+		Expect(err).NotTo(HaveOccurred())
+		work, err = git.PlainInit(workDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = work.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"file://" + bareDir}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should keep only the packages of the default branch", func() {
+		hash := commit(map[string]string{
+			"README.md":                                "NSO packages",
+			"packages/README.md":                       "Services and NEDs",
+			"packages/l3vpn/package-meta-data.xml":     packageMetaData("l3vpn"),
+			"packages/l3vpn/templates/l3vpn.xml":       "<config/>",
+			"packages/cisco-ios/package-meta-data.xml": packageMetaData("cisco-ios-cli-6.85"),
+			"packages/scripts/deploy.sh":               "#!/bin/sh",
+		})
+
+		result, err := fetch("", "/packages/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&Result{Revision: hash.String(), Packages: []string{"cisco-ios", "l3vpn"}}))
+
+		entries, err := os.ReadDir(filepath.Join(storeDir, "bundle"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(filepath.Join(storeDir, "bundle", "l3vpn", "templates", "l3vpn.xml")).To(BeARegularFile())
+
+		By("leaving nothing else in the store")
+		entries, err = os.ReadDir(storeDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("should check out branches, tags and commits", func() {
+		first := commit(map[string]string{"l3vpn/package-meta-data.xml": packageMetaData("l3vpn")})
+		_, err := work.CreateTag("v1.0", first, &git.CreateTagOptions{
+			Tagger:  &object.Signature{Name: "NSO", Email: "nso@example.com", When: time.Now()},
+			Message: "First release",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(work.Storer.SetReference(plumbing.NewHashReference("refs/heads/stable", first))).To(Succeed())
+		second := commit(map[string]string{"mpls/package-meta-data.xml": packageMetaData("mpls")})
+
+		result, err := fetch("master", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&Result{Revision: second.String(), Packages: []string{"l3vpn", "mpls"}}))
+
+		for _, ref := range []string{"v1.0", "stable", first.String(), first.String()[:8]} {
+			result, err = fetch(ref, "")
+			Expect(err).NotTo(HaveOccurred(), ref)
+			Expect(result).To(Equal(&Result{Revision: first.String(), Packages: []string{"l3vpn"}}), ref)
+		}
+		Expect(filepath.Join(storeDir, "bundle", "mpls")).NotTo(BeADirectory())
+
+		_, err = fetch("v2.0", "")
+		Expect(err).To(MatchError(`no branch, tag or commit "v2.0" in the repository`))
+	})
+
+	It("should download a single package named after its meta-data", func() {
+		hash := commit(map[string]string{"src/package-meta-data.xml": packageMetaData("l3vpn")})
+
+		result, err := fetch("", "src")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&Result{Revision: hash.String(), Packages: []string{"l3vpn"}}))
+		Expect(filepath.Join(storeDir, "bundle", "l3vpn", "package-meta-data.xml")).To(BeARegularFile())
+	})
+
+	It("should keep the previous download when the source has no packages", func() {
+		commit(map[string]string{
+			"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+			"docs/README.md":              "No package here",
+		})
+		_, err := fetch("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = fetch("", "docs")
+		Expect(err).To(MatchError("no NSO package found in /docs"))
+		_, err = fetch("", "../../etc")
+		Expect(err).To(MatchError(`path "../../etc" is outside of the source`))
+		Expect(filepath.Join(storeDir, "bundle", "l3vpn")).To(BeADirectory())
+	})
+
+	Context("When the source needs credentials", func() {
+		var credentialsDir string
+
+		BeforeEach(func() {
+			credentialsDir = GinkgoT().TempDir()
+		})
+
+		It("should authenticate over HTTP with the username and password", func() {
+			Expect(os.WriteFile(filepath.Join(credentialsDir, UsernameFile), []byte("ci"), 0o600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(credentialsDir, PasswordFile), []byte("s3cret\n"), 0o600)).To(Succeed())
+
+			auth, err := gitAuth(Source{URL: "https://git.example.com/nso/packages.git", CredentialsDir: credentialsDir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth).To(Equal(&githttp.BasicAuth{Username: "ci", Password: "s3cret"}))
+		})
+
+		It("should require the known hosts with an SSH key", func() {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			block, err := ssh.MarshalPrivateKey(key, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(credentialsDir, SSHKeyFile), pem.EncodeToMemory(block), 0o600)).To(Succeed())
+			source := Source{URL: "git@git.example.com:nso/packages.git", CredentialsDir: credentialsDir}
+
+			_, err = gitAuth(source)
+			Expect(err).To(MatchError("the SSH key Secret has no known_hosts key to verify the host key with"))
+
+			signer, err := ssh.NewSignerFromKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			knownHosts := "git.example.com " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+			Expect(os.WriteFile(filepath.Join(credentialsDir, KnownHostsFile), []byte(knownHosts), 0o600)).To(Succeed())
+			auth, err := gitAuth(source)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.String()).To(ContainSubstring("user: git"))
+		})
+	})
+
+	It("should write the result of the command to the result file", func() {
+		hash := commit(map[string]string{"l3vpn/package-meta-data.xml": packageMetaData("l3vpn")})
+		resultFile := filepath.Join(GinkgoT().TempDir(), "termination-log")
+		args := []string{"--url", "file://" + bareDir, "--dest", filepath.Join(storeDir, "bundle"), "--result-file", resultFile}
+
+		Expect(Main(args)).To(Equal(0))
+		content, err := os.ReadFile(resultFile)
+		Expect(err).NotTo(HaveOccurred())
+		var result Result
+		Expect(json.Unmarshal(content, &result)).To(Succeed())
+		Expect(result).To(Equal(Result{Revision: hash.String(), Packages: []string{"l3vpn"}}))
+
+		By("writing the error when the download fails")
+		Expect(Main(append(args, "--ref", "v9"))).To(Equal(1))
+		Expect(os.ReadFile(resultFile)).To(BeEquivalentTo(`no branch, tag or commit "v9" in the repository`))
+	})
+})
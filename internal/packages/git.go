@@ -0,0 +1,144 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// Function to clone the Git repository of the source into dir and check out
+// its ref. Returns the commit checked out.
+func cloneGit(ctx context.Context, source Source, dir string) (string, error) {
+	auth, err := gitAuth(source)
+	if err != nil {
+		return "", err
+	}
+	repository, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:             source.URL,
+		Auth:            auth,
+		NoCheckout:      true,
+		Tags:            git.AllTags,
+		InsecureSkipTLS: source.InsecureTLS,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to clone %s: %w", source.URL, err)
+	}
+
+	commit, err := resolveRef(repository, source.Ref)
+	if err != nil {
+		return "", err
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return "", err
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: commit, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", commit, err)
+	}
+	// Only the files of the commit are kept
+	if err := os.RemoveAll(filepath.Join(dir, git.GitDirName)); err != nil {
+		return "", err
+	}
+	return commit.String(), nil
+}
+
+// Returns the commit of the branch, tag or commit hash, or of the default
+// branch when ref is empty. Branches win over tags of the same name, as with
+// git checkout.
+func resolveRef(repository *git.Repository, ref string) (plumbing.Hash, error) {
+	if ref == "" {
+		head, err := repository.Head()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to find the default branch: %w", err)
+		}
+		return head.Hash(), nil
+	}
+	for _, revision := range []string{"refs/remotes/" + git.DefaultRemoteName + "/" + ref, ref} {
+		if hash, err := repository.ResolveRevision(plumbing.Revision(revision)); err == nil {
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("no branch, tag or commit %q in the repository", ref)
+}
+
+// Returns the authentication of the source from its credentials directory: an
+// SSH key, or a username and password over HTTP. Nil when there are no
+// credentials.
+func gitAuth(source Source) (transport.AuthMethod, error) {
+	if source.CredentialsDir == "" {
+		return nil, nil
+	}
+
+	keyFile := filepath.Join(source.CredentialsDir, SSHKeyFile)
+	if _, err := os.Stat(keyFile); err == nil {
+		endpoint, err := transport.NewEndpoint(source.URL)
+		if err != nil {
+			return nil, err
+		}
+		user := endpoint.User
+		if user == "" {
+			user = "git"
+		}
+		auth, err := gitssh.NewPublicKeysFromFile(user, keyFile, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", SSHKeyFile, err)
+		}
+		// The host key is always verified
+		knownHostsFile := filepath.Join(source.CredentialsDir, KnownHostsFile)
+		if _, err := os.Stat(knownHostsFile); err != nil {
+			return nil, fmt.Errorf("the SSH key Secret has no %s key to verify the host key with", KnownHostsFile)
+		}
+		if auth.HostKeyCallback, err = gitssh.NewKnownHostsCallback(knownHostsFile); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", KnownHostsFile, err)
+		}
+		return auth, nil
+	}
+
+	username, err := readCredential(source.CredentialsDir, UsernameFile)
+	if err != nil {
+		return nil, err
+	}
+	password, err := readCredential(source.CredentialsDir, PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+	if username == "" && password == "" {
+		return nil, nil
+	}
+	return &githttp.BasicAuth{Username: username, Password: password}, nil
+}
+
+// Returns the content of a file of the credentials directory, empty when it
+// does not exist
+func readCredential(dir, name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return strings.TrimRight(string(content), "\r\n"), err
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/carlosgrillet/nso-operator/internal/registry"
+)
+
+// Annotation holding the file name of the layers pushed as files, e.g. by
+// oras push
+const titleAnnotation = "org.opencontainers.image.title"
+
+// Function to pull the OCI artifact of the source, by tag or digest, and
+// extract its package layers into dir. The gzip compressed tar layers are
+// unpacked, and the layers titled as package tarballs are kept as files to be
+// unpacked with the other package tarballs. The layers are verified against
+// their digest as they are read. Returns the digest of the manifest.
+func pullArtifact(ctx context.Context, source Source, dir string) (string, error) {
+	var nameOptions []name.Option
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if source.InsecureTLS {
+		nameOptions = append(nameOptions, name.Insecure)
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- requested with insecureTLS
+	}
+	ref, err := name.ParseReference(source.URL, nameOptions...)
+	if err != nil {
+		return "", fmt.Errorf("invalid OCI artifact %q: %w", source.URL, err)
+	}
+	keychain, err := registryKeychain(source)
+	if err != nil {
+		return "", err
+	}
+
+	artifact, err := remote.Image(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain), remote.WithTransport(transport))
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", source.URL, err)
+	}
+	digest, err := artifact.Digest()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := artifact.Manifest()
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", source.URL, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	for _, descriptor := range manifest.Layers {
+		if err := extractLayer(artifact, descriptor, dir); err != nil {
+			return "", fmt.Errorf("invalid layer %s of %s: %w", descriptor.Digest, source.URL, err)
+		}
+	}
+	return digest.String(), nil
+}
+
+// Returns the keychain of the docker config of the credentials directory,
+// accessing the registry anonymously without one
+func registryKeychain(source Source) (authn.Keychain, error) {
+	if source.CredentialsDir == "" {
+		return authn.NewMultiKeychain(), nil
+	}
+	content, err := os.ReadFile(filepath.Join(source.CredentialsDir, DockerConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return authn.NewMultiKeychain(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return registry.NewKeychain(content)
+}
+
+// Function to extract a layer of the artifact into dir. Other layers, such
+// as the documentation of the artifact, are skipped.
+func extractLayer(artifact v1.Image, descriptor v1.Descriptor, dir string) error {
+	title := descriptor.Annotations[titleAnnotation]
+	switch {
+	case isTarGzipLayer(descriptor.MediaType):
+	case isPackageArchive(title):
+		if filepath.Base(title) != title || !filepath.IsLocal(title) {
+			return fmt.Errorf("title %q is not a file name", title)
+		}
+	default:
+		return nil
+	}
+
+	layer, err := artifact.LayerByDigest(descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	content, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = content.Close() }()
+	if isTarGzipLayer(descriptor.MediaType) {
+		return unpackArchive(content, dir)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = root.Close() }()
+	return writeFile(root, title, content, 0o644)
+}
+
+// Returns whether the media type is the one of a gzip compressed tar layer,
+// e.g. application/vnd.oci.image.layer.v1.tar+gzip
+func isTarGzipLayer(mediaType types.MediaType) bool {
+	return mediaType == types.DockerLayer || strings.HasSuffix(string(mediaType), ".tar+gzip")
+}
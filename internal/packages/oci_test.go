@@ -0,0 +1,174 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OCI artifact download", func() {
+	ctx := context.Background()
+
+	var (
+		host           string
+		storeDir       string
+		credentialsDir string
+	)
+
+	// Pushes an artifact of the layers to the repository, and returns its
+	// digest
+	push := func(repository string, layers ...mutate.Addendum) string {
+		artifact := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+		artifact = mutate.ConfigMediaType(artifact, "application/vnd.cisco.nso.packages.config.v1+json")
+		artifact, err := mutate.Append(artifact, layers...)
+		Expect(err).NotTo(HaveOccurred())
+		ref, err := name.ParseReference(host + "/" + repository)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, artifact, remote.WithAuth(&authn.Basic{Username: "nso", Password: "nso-secret"}))).To(Succeed())
+		digest, err := artifact.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		return digest.String()
+	}
+
+	fetch := func(reference string) (*Result, error) {
+		source := Source{Origin: OriginOCI, URL: host + "/" + reference, CredentialsDir: credentialsDir}
+		return Fetch(ctx, source, filepath.Join(storeDir, "bundle"))
+	}
+
+	BeforeEach(func() {
+		// In-memory registry only accepting the nso/nso-secret credentials
+		handler := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if username, password, ok := req.BasicAuth(); !ok || username != "nso" || password != "nso-secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(w, req)
+		}))
+		DeferCleanup(server.Close)
+		host = strings.TrimPrefix(server.URL, "http://")
+		storeDir = GinkgoT().TempDir()
+
+		credentialsDir = GinkgoT().TempDir()
+		dockerConfig := `{"auths":{"` + host + `":{"username":"nso","password":"nso-secret"}}}`
+		Expect(os.WriteFile(filepath.Join(credentialsDir, DockerConfigFile), []byte(dockerConfig), 0o600)).To(Succeed())
+	})
+
+	It("should extract the package layers of the artifact and record its digest", func() {
+		digest := push("nso/packages:1.0",
+			mutate.Addendum{Layer: static.NewLayer(tarGz(map[string]string{
+				"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+				"l3vpn/templates/l3vpn.xml":   "<config/>",
+			}), types.OCILayer)},
+			mutate.Addendum{
+				Layer:       static.NewLayer(tarGz(map[string]string{"cisco-ios-cli-6.85/package-meta-data.xml": packageMetaData("cisco-ios-cli-6.85")}), "application/vnd.oci.image.layer.v1.tar"),
+				Annotations: map[string]string{titleAnnotation: "ncs-6.4-cisco-ios-6.85.tar.gz"},
+			},
+			mutate.Addendum{
+				Layer:       static.NewLayer([]byte("NSO packages"), "text/markdown"),
+				Annotations: map[string]string{titleAnnotation: "README.md"},
+			},
+		)
+
+		result, err := fetch("nso/packages:1.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&Result{Digest: digest, Packages: []string{"cisco-ios-cli-6.85", "l3vpn"}}))
+		Expect(filepath.Join(storeDir, "bundle", "cisco-ios-cli-6.85", "package-meta-data.xml")).To(BeARegularFile())
+		Expect(filepath.Join(storeDir, "bundle", "l3vpn", "templates", "l3vpn.xml")).To(BeARegularFile())
+
+		By("pulling the artifact by digest")
+		result, err = fetch("nso/packages@" + digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Digest).To(Equal(digest))
+	})
+
+	It("should extract the packages of the path of the layers", func() {
+		digest := push("nso/packages:1.0", mutate.Addendum{Layer: static.NewLayer(tarGz(map[string]string{
+			"packages/l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+			"packages/mpls/package-meta-data.xml":  packageMetaData("mpls"),
+		}), types.OCILayer)})
+
+		result, err := Fetch(ctx, Source{Origin: OriginOCI, URL: host + "/nso/packages:1.0", Path: "packages", CredentialsDir: credentialsDir},
+			filepath.Join(storeDir, "bundle"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(&Result{Digest: digest, Packages: []string{"l3vpn", "mpls"}}))
+	})
+
+	It("should keep the previous download when the artifact can not be pulled", func() {
+		push("nso/packages:1.0", mutate.Addendum{Layer: static.NewLayer(tarGz(map[string]string{
+			"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+		}), types.OCILayer)})
+		_, err := fetch("nso/packages:1.0")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = fetch("nso/packages:2.0")
+		Expect(err).To(MatchError(ContainSubstring("failed to pull " + host + "/nso/packages:2.0")))
+		Expect(err).To(MatchError(ContainSubstring("MANIFEST_UNKNOWN")))
+
+		By("failing without the credentials of the registry")
+		_, err = Fetch(ctx, Source{Origin: OriginOCI, URL: host + "/nso/packages:1.0"}, filepath.Join(storeDir, "bundle"))
+		Expect(err).To(MatchError(ContainSubstring("401 Unauthorized")))
+
+		By("refusing a layer titled outside of the source")
+		push("nso/packages:evil", mutate.Addendum{
+			Layer:       static.NewLayer([]byte("not a package"), "application/octet-stream"),
+			Annotations: map[string]string{titleAnnotation: "../evil.tar.gz"},
+		})
+		_, err = fetch("nso/packages:evil")
+		Expect(err).To(MatchError(ContainSubstring(`title "../evil.tar.gz" is not a file name`)))
+
+		_, err = fetch("nso/Packages:1.0")
+		Expect(err).To(MatchError(ContainSubstring(`invalid OCI artifact "` + host + `/nso/Packages:1.0"`)))
+		Expect(filepath.Join(storeDir, "bundle", "l3vpn")).To(BeADirectory())
+	})
+
+	It("should write the digest of the artifact to the result file", func() {
+		digest := push("nso/packages:1.0", mutate.Addendum{Layer: static.NewLayer(tarGz(map[string]string{
+			"l3vpn/package-meta-data.xml": packageMetaData("l3vpn"),
+		}), types.OCILayer)})
+		resultFile := filepath.Join(GinkgoT().TempDir(), "termination-log")
+		args := []string{"--origin", OriginOCI, "--url", host + "/nso/packages:1.0", "--credentials-dir", credentialsDir,
+			"--dest", filepath.Join(storeDir, "bundle"), "--result-file", resultFile}
+
+		Expect(Main(args)).To(Equal(0))
+		content, err := os.ReadFile(resultFile)
+		Expect(err).NotTo(HaveOccurred())
+		var result Result
+		Expect(json.Unmarshal(content, &result)).To(Succeed())
+		Expect(result).To(Equal(Result{Digest: digest, Packages: []string{"l3vpn"}}))
+	})
+})
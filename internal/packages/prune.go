@@ -0,0 +1,83 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// Subcommand of the manager binary removing the previous downloads of a
+	// bundle
+	PruneCommand = "prune-packages"
+
+	// Directory created by ext filesystems at the root of the volumes
+	lostAndFoundDir = "lost+found"
+)
+
+// Prune removes the entries of dir other than the keep directories, that is
+// the previous downloads of the bundle and the work directories of the
+// downloads that were interrupted. It returns the names of the removed
+// entries.
+func Prune(dir string, keep []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, entry := range entries {
+		if entry.Name() == lostAndFoundDir || slices.Contains(keep, entry.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry.Name())
+	}
+	return removed, nil
+}
+
+// PruneMain runs the PruneCommand with its arguments, and returns the exit
+// code.
+func PruneMain(args []string) int {
+	flags := flag.NewFlagSet(PruneCommand, flag.ContinueOnError)
+	var dir, keep string
+	flags.StringVar(&dir, "dir", "", "Directory holding the downloads of the bundle.")
+	flags.StringVar(&keep, "keep", "", "Comma-separated downloads to keep.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if dir == "" || keep == "" {
+		fmt.Fprintln(os.Stderr, "--dir and --keep are required")
+		return 2
+	}
+
+	removed, err := Prune(dir, strings.Split(keep, ","))
+	for _, name := range removed {
+		fmt.Fprintf(os.Stderr, "Removed %s\n", filepath.Join(dir, name))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to remove the previous downloads: %v\n", err)
+		return 1
+	}
+	return 0
+}
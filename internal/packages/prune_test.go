@@ -0,0 +1,61 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packages
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Package pruning", func() {
+	var dir string
+
+	entries := func() []string {
+		list, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, entry := range list {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		for _, name := range []string{"0123456789/l3vpn", "abcdef0123/l3vpn", ".fetch-1234/source", "lost+found"} {
+			Expect(os.MkdirAll(filepath.Join(dir, name), 0o755)).To(Succeed())
+		}
+	})
+
+	It("should remove every download but the kept ones", func() {
+		removed, err := Prune(dir, []string{"abcdef0123"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(ConsistOf("0123456789", ".fetch-1234"))
+		Expect(entries()).To(ConsistOf("abcdef0123", "lost+found"))
+	})
+
+	It("should require the directory and the downloads to keep", func() {
+		Expect(PruneMain([]string{"--dir", dir})).To(Equal(2))
+		Expect(entries()).To(HaveLen(4))
+
+		Expect(PruneMain([]string{"--dir", dir, "--keep", "0123456789,abcdef0123"})).To(Equal(0))
+		Expect(entries()).To(ConsistOf("0123456789", "abcdef0123", "lost+found"))
+	})
+})
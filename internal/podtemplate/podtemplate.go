@@ -0,0 +1,88 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package podtemplate applies the podTemplate override of an NSO over the pod
+// template generated by the operator.
+package podtemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// Apply strategic-merge-patches the override over the template. Fields that
+// are not part of a pod template are rejected, so that typos are not silently
+// dropped.
+func Apply(template *corev1.PodTemplateSpec, override []byte) (*corev1.PodTemplateSpec, error) {
+	original, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, override, corev1.PodTemplateSpec{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid podTemplate: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	result := &corev1.PodTemplateSpec{}
+	if err := decoder.Decode(result); err != nil {
+		return nil, fmt.Errorf("invalid podTemplate: %w", err)
+	}
+	return result, nil
+}
+
+// Protected lists what an override can not change in the generated template
+type Protected struct {
+	// Labels that must keep their value, e.g. the selector labels
+	Labels map[string]string
+	// Container that can not be removed or renamed
+	Container string
+	// Image the container must keep, when set, e.g. a pinned digest
+	Image string
+}
+
+// Validate returns an error when the template lost the fields the operator
+// relies on: the protected labels, the container it runs commands in and,
+// when set, the image of that container.
+func Validate(template *corev1.PodTemplateSpec, protected Protected) error {
+	keys := make([]string, 0, len(protected.Labels))
+	for key := range protected.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := template.Labels[key]; !ok || value != protected.Labels[key] {
+			return fmt.Errorf("podTemplate can not change the label %s=%s", key, protected.Labels[key])
+		}
+	}
+
+	for _, c := range template.Spec.Containers {
+		if c.Name != protected.Container {
+			continue
+		}
+		if protected.Image != "" && c.Image != protected.Image {
+			return fmt.Errorf("podTemplate can not change the image %s of the %s container", protected.Image, protected.Container)
+		}
+		return nil
+	}
+	return fmt.Errorf("podTemplate can not remove or rename the %s container", protected.Container)
+}
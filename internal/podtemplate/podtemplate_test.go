@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podtemplate
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("PodTemplate", func() {
+	var (
+		template  *corev1.PodTemplateSpec
+		protected Protected
+	)
+
+	BeforeEach(func() {
+		protected = Protected{Labels: map[string]string{"app": "nso"}, Container: "ncs"}
+		template = &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "nso"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "ncs", Image: "cisco-nso-prod:6.3.1", Env: []corev1.EnvVar{{Name: "ADMIN_USERNAME", Value: "admin"}}},
+					{Name: "log-shipper", Image: "fluent-bit:3.0"},
+				},
+			},
+		}
+	})
+
+	It("should merge the containers of the override by name", func() {
+		result, err := Apply(template, []byte(`{
+			"metadata": {"annotations": {"sidecar.istio.io/inject": "false"}},
+			"spec": {
+				"containers": [{"name": "ncs", "resources": {"limits": {"memory": "4Gi"}}}],
+				"nodeSelector": {"nso": "true"}
+			}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Annotations).To(HaveKeyWithValue("sidecar.istio.io/inject", "false"))
+		Expect(result.Spec.NodeSelector).To(HaveKeyWithValue("nso", "true"))
+		Expect(result.Spec.Containers).To(HaveLen(2))
+
+		ncs := result.Spec.Containers[0]
+		Expect(ncs.Name).To(Equal("ncs"))
+		Expect(ncs.Image).To(Equal("cisco-nso-prod:6.3.1"))
+		Expect(ncs.Env).To(Equal(template.Spec.Containers[0].Env))
+		Expect(ncs.Resources.Limits[corev1.ResourceMemory]).To(Equal(resource.MustParse("4Gi")))
+		Expect(result.Spec.Containers[1]).To(Equal(template.Spec.Containers[1]))
+		Expect(Validate(result, protected)).To(Succeed())
+
+		By("leaving the template untouched")
+		Expect(template.Spec.Containers[0].Resources.Limits).To(BeEmpty())
+	})
+
+	It("should reject the fields that are not part of a pod template", func() {
+		_, err := Apply(template, []byte(`{"spec": {"containers": [{"name": "ncs", "imagePullPolcy": "Always"}]}}`))
+		Expect(err).To(MatchError(ContainSubstring(`invalid podTemplate: json: unknown field "imagePullPolcy"`)))
+
+		_, err = Apply(template, []byte(`{"spec": {"replicas": 3}}`))
+		Expect(err).To(MatchError(ContainSubstring(`unknown field "replicas"`)))
+
+		_, err = Apply(template, []byte(`not json`))
+		Expect(err).To(MatchError(ContainSubstring("invalid podTemplate")))
+	})
+
+	It("should reject a template dropping a selector label", func() {
+		result, err := Apply(template, []byte(`{"metadata": {"labels": {"app": "other"}}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Validate(result, protected)).To(MatchError("podTemplate can not change the label app=nso"))
+
+		result, err = Apply(template, []byte(`{"metadata": {"labels": {"app": null}}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Validate(result, protected)).To(MatchError("podTemplate can not change the label app=nso"))
+	})
+
+	It("should reject a template changing a protected label", func() {
+		template.Labels["app.kubernetes.io/managed-by"] = "nso-operator"
+		protected.Labels = map[string]string{"app": "nso", "app.kubernetes.io/managed-by": "nso-operator"}
+
+		result, err := Apply(template, []byte(`{"metadata": {"labels": {"app.kubernetes.io/managed-by": "helm"}}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Validate(result, protected)).To(MatchError("podTemplate can not change the label app.kubernetes.io/managed-by=nso-operator"))
+	})
+
+	It("should reject a template changing the protected image", func() {
+		protected.Image = "cisco-nso-prod:6.3.1"
+
+		result, err := Apply(template, []byte(`{"spec": {"containers": [{"name": "ncs", "resources": {"limits": {"memory": "4Gi"}}}]}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Validate(result, protected)).To(Succeed())
+
+		result, err = Apply(template, []byte(`{"spec": {"containers": [{"name": "ncs", "image": "cisco-nso-prod:6.4"}]}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Validate(result, protected)).To(MatchError("podTemplate can not change the image cisco-nso-prod:6.3.1 of the ncs container"))
+	})
+
+	It("should reject a template without the ncs container", func() {
+		result, err := Apply(template, []byte(`{"spec": {"containers": [{"name": "ncs", "$patch": "delete"}]}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Spec.Containers).To(HaveLen(1))
+		Expect(Validate(result, protected)).To(MatchError("podTemplate can not remove or rename the ncs container"))
+
+		result, err = Apply(template, []byte(`{"spec": {"$setElementOrder/containers": [{"name": "nso"}, {"name": "log-shipper"}],
+			"containers": [{"name": "nso", "image": "cisco-nso-prod:6.3.1"}, {"name": "ncs", "$patch": "delete"}]}}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(Validate(result, protected)).To(MatchError("podTemplate can not remove or rename the ncs container"))
+	})
+})
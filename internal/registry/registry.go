@@ -0,0 +1,144 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry queries the container registries the NSO images are
+// pulled from.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Keychain resolves the registry credentials held by the content of
+// kubernetes.io/dockerconfigjson Secrets, as the kubelet does for
+// imagePullSecrets. Registries without credentials are accessed anonymously.
+type Keychain struct {
+	auths map[string]authn.AuthConfig
+}
+
+var _ authn.Keychain = &Keychain{}
+
+// dockerConfig is the content of the .dockerconfigjson key of a Secret
+type dockerConfig struct {
+	Auths map[string]authn.AuthConfig `json:"auths"`
+}
+
+// NewKeychain returns a Keychain with the credentials of the given
+// .dockerconfigjson contents. The first one holding credentials for a
+// registry wins, matching the order of imagePullSecrets.
+func NewKeychain(dockerConfigs ...[]byte) (*Keychain, error) {
+	keychain := &Keychain{auths: map[string]authn.AuthConfig{}}
+	for _, content := range dockerConfigs {
+		config := dockerConfig{}
+		if err := json.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("invalid docker config: %w", err)
+		}
+		for server, auth := range config.Auths {
+			host := registryHost(server)
+			if _, ok := keychain.auths[host]; !ok {
+				keychain.auths[host] = auth
+			}
+		}
+	}
+	return keychain, nil
+}
+
+// KeychainFromSecrets returns a Keychain with the credentials of the image
+// pull Secrets. The reader must return the Secret data, which the manager
+// cache strips. Missing Secrets are skipped, as the kubelet does.
+func KeychainFromSecrets(ctx context.Context, reader client.Reader, namespace string, refs []corev1.LocalObjectReference) (*Keychain, error) {
+	var configs [][]byte
+	for _, ref := range refs {
+		secret := &corev1.Secret{}
+		err := reader.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if content, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+			configs = append(configs, content)
+		}
+	}
+	return NewKeychain(configs...)
+}
+
+// Resolve implements authn.Keychain
+func (k *Keychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	auth, ok := k.auths[registryHost(resource.RegistryStr())]
+	if !ok {
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(auth), nil
+}
+
+// Returns the registry host of a docker config server key, which may be a URL
+// such as https://index.docker.io/v1/
+func registryHost(server string) string {
+	host := server
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	switch host {
+	case "docker.io", "registry-1.docker.io":
+		return name.DefaultRegistry
+	}
+	return host
+}
+
+// ResolveDigest returns the digest of the manifest the image reference points
+// to, e.g. sha256:2c26b46b...
+func ResolveDigest(ctx context.Context, image string, keychain authn.Keychain) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %q: %w", image, err)
+	}
+
+	options := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain)}
+	descriptor, err := remote.Head(ref, options...)
+	if err != nil {
+		// Not every registry returns the digest on HEAD requests
+		fullDescriptor, getErr := remote.Get(ref, options...)
+		if getErr != nil {
+			return "", fmt.Errorf("failed to resolve image %q: %w", image, getErr)
+		}
+		descriptor = &fullDescriptor.Descriptor
+	}
+	return descriptor.Digest.String(), nil
+}
+
+// PinnedReference returns the image reference pinned to the digest. The tag is
+// kept for readability, the digest is what the image is pulled by.
+func PinnedReference(image, digest string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	return image + "@" + digest
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	ctx := context.Background()
+
+	var (
+		server *httptest.Server
+		host   string
+	)
+
+	BeforeEach(func() {
+		// In-memory registry only accepting the nso/nso-secret credentials
+		handler := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if username, password, ok := req.BasicAuth(); !ok || username != "nso" || password != "nso-secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(w, req)
+		}))
+		DeferCleanup(server.Close)
+		host = strings.TrimPrefix(server.URL, "http://")
+	})
+
+	credentials := func(server string) []byte {
+		return []byte(`{"auths":{"` + server + `":{"username":"nso","password":"nso-secret"}}}`)
+	}
+
+	It("should resolve a tag to the digest of its manifest", func() {
+		keychain, err := NewKeychain(credentials(host))
+		Expect(err).NotTo(HaveOccurred())
+
+		image, err := random.Image(1024, 1)
+		Expect(err).NotTo(HaveOccurred())
+		ref, err := name.ParseReference(host + "/cisco-nso-prod:6.3.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, image, remote.WithAuthFromKeychain(keychain))).To(Succeed())
+		expected, err := image.Digest()
+		Expect(err).NotTo(HaveOccurred())
+
+		digest, err := ResolveDigest(ctx, ref.String(), keychain)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(expected.String()))
+
+		By("failing without credentials")
+		_, err = ResolveDigest(ctx, ref.String(), authn.NewMultiKeychain())
+		Expect(err).To(HaveOccurred())
+
+		By("failing for unknown tags")
+		_, err = ResolveDigest(ctx, host+"/cisco-nso-prod:6.4", keychain)
+		Expect(err).To(MatchError(ContainSubstring("failed to resolve image")))
+	})
+
+	It("should match the docker config servers to the image registries", func() {
+		keychain, err := NewKeychain(
+			credentials("https://index.docker.io/v1/"),
+			credentials("registry.example.com:5000"),
+			[]byte(`{"auths":{"registry.example.com:5000":{"username":"other","password":"other"}}}`),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, image := range []string{"cisco-nso-prod:6.3.1", "registry.example.com:5000/nso/cisco-nso-prod"} {
+			ref, err := name.ParseReference(image)
+			Expect(err).NotTo(HaveOccurred())
+			authenticator, err := keychain.Resolve(ref.Context())
+			Expect(err).NotTo(HaveOccurred())
+			config, err := authenticator.Authorization()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Username).To(Equal("nso"), image)
+		}
+
+		ref, err := name.ParseReference("ghcr.io/example/nso")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keychain.Resolve(ref.Context())).To(Equal(authn.Anonymous))
+
+		_, err = NewKeychain([]byte("not json"))
+		Expect(err).To(MatchError(ContainSubstring("invalid docker config")))
+	})
+
+	It("should pin an image reference to a digest", func() {
+		digest := "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+		Expect(PinnedReference("cisco-nso-prod:6.3.1", digest)).To(Equal("cisco-nso-prod:6.3.1@" + digest))
+		Expect(PinnedReference("cisco-nso-prod:6.3.1@sha256:0000", digest)).To(Equal("cisco-nso-prod:6.3.1@" + digest))
+	})
+})
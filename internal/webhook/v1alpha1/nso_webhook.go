@@ -0,0 +1,235 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/imagepolicy"
+	"github.com/carlosgrillet/nso-operator/internal/podtemplate"
+	"github.com/carlosgrillet/nso-operator/internal/registry"
+)
+
+const (
+	// Name of the NSO container in the pods generated by the operator
+	nsoContainerName = "ncs"
+	// Labels the operator finds the NSO pods by, and its managed-by value
+	instanceLabel  = "app.kubernetes.io/instance"
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "nso-operator"
+	// Time allowed to verify the signature of the NSO image, within the
+	// default timeout of the webhook
+	signatureVerifyTimeout = 8 * time.Second
+)
+
+// log is for logging in this package.
+var nsolog = logf.Log.WithName("nso-resource")
+
+// SetupNSOWebhookWithManager registers the webhook for NSO in the manager.
+// The images of the NSO instances are checked against the image policy, nil
+// allows every image.
+func SetupNSOWebhookWithManager(mgr ctrl.Manager, policy *imagepolicy.Policy) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&orchestrationciscocomv1alpha1.NSO{}).
+		WithValidator(&NSOCustomValidator{ImagePolicy: policy, Reader: mgr.GetAPIReader()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-orchestration-cisco-com-cisco-com-v1alpha1-nso,mutating=false,failurePolicy=fail,sideEffects=None,groups=orchestration.cisco.com.cisco.com,resources=nsos,verbs=create;update;delete,versions=v1alpha1,name=vnso-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// NSOCustomValidator struct is responsible for validating the NSO resource
+// when it is created, updated, or deleted.
+type NSOCustomValidator struct {
+	// Registries the NSO images must come from and signature the NSO image
+	// must carry. Nil allows every image.
+	ImagePolicy *imagepolicy.Policy
+
+	// Reads the imagePullSecrets used to verify the signature of the NSO image
+	Reader client.Reader
+}
+
+var _ webhook.CustomValidator = &NSOCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type NSO.
+// It rejects a podTemplate override that can not be applied, container
+// names that clash in the NSO pods and images the image policy does not allow.
+func (v *NSOCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	nso, ok := obj.(*orchestrationciscocomv1alpha1.NSO)
+	if !ok {
+		return nil, fmt.Errorf("expected a NSO object but got %T", obj)
+	}
+	nsolog.Info("Validation for NSO upon creation", "name", nso.GetName())
+
+	return nil, errors.Join(validatePodTemplate(nso), validateContainers(nso), v.validateImages(ctx, nso))
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type NSO.
+// It rejects a podTemplate override that can not be applied, container
+// names that clash in the NSO pods and images the image policy does not
+// allow. Fields that did not change are let through, so that e.g. finalizers
+// can still be removed.
+func (v *NSOCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldNSO, ok := oldObj.(*orchestrationciscocomv1alpha1.NSO)
+	if !ok {
+		return nil, fmt.Errorf("expected a NSO object but got %T", oldObj)
+	}
+	nso, ok := newObj.(*orchestrationciscocomv1alpha1.NSO)
+	if !ok {
+		return nil, fmt.Errorf("expected a NSO object but got %T", newObj)
+	}
+	nsolog.Info("Validation for NSO upon update", "name", nso.GetName())
+
+	var errs []error
+	if !equality.Semantic.DeepEqual(oldNSO.Spec.PodTemplate, nso.Spec.PodTemplate) ||
+		!equality.Semantic.DeepEqual(oldNSO.Spec.LabelSelector, nso.Spec.LabelSelector) {
+		errs = append(errs, validatePodTemplate(nso))
+	}
+	if !equality.Semantic.DeepEqual(oldNSO.Spec.InitContainers, nso.Spec.InitContainers) ||
+		!equality.Semantic.DeepEqual(oldNSO.Spec.Sidecars, nso.Spec.Sidecars) {
+		errs = append(errs, validateContainers(nso))
+	}
+	if oldNSO.Spec.Image != nso.Spec.Image ||
+		!equality.Semantic.DeepEqual(oldNSO.Spec.InitContainers, nso.Spec.InitContainers) ||
+		!equality.Semantic.DeepEqual(oldNSO.Spec.Sidecars, nso.Spec.Sidecars) ||
+		!equality.Semantic.DeepEqual(oldNSO.Spec.PodTemplate, nso.Spec.PodTemplate) {
+		errs = append(errs, v.validateImages(ctx, nso))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type NSO.
+// It rejects the deletion of NSO instances with deletion protection turned on.
+func (v *NSOCustomValidator) ValidateDelete(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	nso, ok := obj.(*orchestrationciscocomv1alpha1.NSO)
+	if !ok {
+		return nil, fmt.Errorf("expected a NSO object but got %T", obj)
+	}
+	nsolog.Info("Validation for NSO upon deletion", "name", nso.GetName())
+
+	if nso.Spec.DeletionProtection {
+		return nil, fmt.Errorf("NSO %s/%s has deletion protection enabled, set spec.deletionProtection to false before deleting it",
+			nso.Namespace, nso.Name)
+	}
+	return nil, nil
+}
+
+// Returns an error when the podTemplate override of the NSO can not be
+// applied or changes the fields the operator relies on. It is checked against
+// a minimal pod template, the operator checks it again on the full one.
+func validatePodTemplate(nso *orchestrationciscocomv1alpha1.NSO) error {
+	if nso.Spec.PodTemplate == nil || len(nso.Spec.PodTemplate.Raw) == 0 {
+		return nil
+	}
+
+	minimal := minimalPodTemplate(nso)
+	template, err := podtemplate.Apply(minimal, nso.Spec.PodTemplate.Raw)
+	if err != nil {
+		return err
+	}
+	protected := podtemplate.Protected{Labels: minimal.Labels, Container: nsoContainerName}
+	if nso.Spec.PinImageDigest {
+		protected.Image = nso.Spec.Image
+	}
+	return podtemplate.Validate(template, protected)
+}
+
+// Returns the pod template holding the fields of the NSO the podTemplate
+// override is checked against
+func minimalPodTemplate(nso *orchestrationciscocomv1alpha1.NSO) *corev1.PodTemplateSpec {
+	// The selector labels win, like in the labels the operator sets
+	labels := map[string]string{instanceLabel: nso.Name}
+	maps.Copy(labels, nso.Spec.LabelSelector)
+	labels[managedByLabel] = managedByValue
+	return &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec: corev1.PodSpec{
+			InitContainers: nso.Spec.InitContainers,
+			Containers:     append([]corev1.Container{{Name: nsoContainerName, Image: nso.Spec.Image}}, nso.Spec.Sidecars...),
+		},
+	}
+}
+
+// Returns an error naming the image policy the images of the NSO violate,
+// those added by the podTemplate override included. The signature of the NSO
+// image is verified with the credentials of its imagePullSecrets.
+func (v *NSOCustomValidator) validateImages(ctx context.Context, nso *orchestrationciscocomv1alpha1.NSO) error {
+	if v.ImagePolicy == nil {
+		return nil
+	}
+
+	template := minimalPodTemplate(nso)
+	if nso.Spec.PodTemplate != nil && len(nso.Spec.PodTemplate.Raw) > 0 {
+		// An override that can not be applied is reported by validatePodTemplate
+		if merged, err := podtemplate.Apply(template, nso.Spec.PodTemplate.Raw); err == nil {
+			template = merged
+		}
+	}
+	var images []string
+	for _, container := range append(append([]corev1.Container{}, template.Spec.InitContainers...), template.Spec.Containers...) {
+		images = append(images, container.Image)
+	}
+	if err := v.ImagePolicy.CheckImages(images...); err != nil {
+		return err
+	}
+
+	if !v.ImagePolicy.RequiresSignature() {
+		return nil
+	}
+	keychain, err := registry.NewKeychain()
+	if v.Reader != nil {
+		keychain, err = registry.KeychainFromSecrets(ctx, v.Reader, nso.Namespace, nso.Spec.ImagePullSecrets)
+	}
+	if err != nil {
+		return err
+	}
+	verifyCtx, cancel := context.WithTimeout(ctx, signatureVerifyTimeout)
+	defer cancel()
+	if _, err := v.ImagePolicy.VerifySignature(verifyCtx, nso.Spec.Image, keychain); err != nil {
+		if imagepolicy.IsViolation(err) {
+			return err
+		}
+		return fmt.Errorf("failed to verify the %s image policy: %w", imagepolicy.PolicyRequireSignature, err)
+	}
+	return nil
+}
+
+// Returns an error when an init container or sidecar uses the name of the NSO
+// container or of another one, as they all end up in the same pod
+func validateContainers(nso *orchestrationciscocomv1alpha1.NSO) error {
+	names := map[string]bool{nsoContainerName: true}
+	for _, container := range append(append([]corev1.Container{}, nso.Spec.InitContainers...), nso.Spec.Sidecars...) {
+		if names[container.Name] {
+			return fmt.Errorf("container name %q is used more than once in the NSO pods", container.Name)
+		}
+		names[container.Name] = true
+	}
+	return nil
+}
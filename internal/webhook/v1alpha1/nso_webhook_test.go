@@ -0,0 +1,233 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	orchestrationciscocomv1alpha1 "github.com/carlosgrillet/nso-operator/api/v1alpha1"
+	"github.com/carlosgrillet/nso-operator/internal/imagepolicy"
+)
+
+var _ = Describe("NSO Webhook", func() {
+	var (
+		obj       *orchestrationciscocomv1alpha1.NSO
+		validator NSOCustomValidator
+	)
+
+	BeforeEach(func() {
+		obj = &orchestrationciscocomv1alpha1.NSO{
+			ObjectMeta: metav1.ObjectMeta{Name: "nso-prod", Namespace: "default"},
+		}
+		validator = NSOCustomValidator{}
+	})
+
+	Context("When creating or updating NSO under Validating Webhook", func() {
+		BeforeEach(func() {
+			obj.Spec.Image = "cisco-nso-prod:6.3.1"
+			obj.Spec.LabelSelector = map[string]string{"app": "nso-prod"}
+		})
+
+		It("Should admit a podTemplate adding pod settings and sidecars", func() {
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"spec":{` +
+				`"hostAliases":[{"ip":"10.0.0.1","hostnames":["nso.lab"]}],` +
+				`"shareProcessNamespace":true,` +
+				`"containers":[{"name":"log-shipper","image":"fluent-bit:3.0"}]}}`)}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny a podTemplate changing a selector label", func() {
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"app":"other"}}}`)}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("can not change the label app=nso-prod")))
+		})
+
+		It("Should deny a podTemplate changing the labels the operator finds the pods by", func() {
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"app.kubernetes.io/instance":"other"}}}`)}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("can not change the label app.kubernetes.io/instance=")))
+		})
+
+		It("Should deny a podTemplate changing the NSO image when its digest is pinned", func() {
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(
+				`{"spec":{"containers":[{"name":"ncs","image":"cisco-nso-prod:6.4"}]}}`)}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.PinImageDigest = true
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("can not change the image cisco-nso-prod:6.3.1 of the ncs container")))
+		})
+
+		It("Should deny a podTemplate removing the ncs container", func() {
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(
+				`{"spec":{"containers":[{"name":"ncs","$patch":"delete"}]}}`)}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("can not remove or rename the ncs container")))
+		})
+
+		It("Should deny a podTemplate with unknown fields", func() {
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"spec":{"hostAliasses":[]}}`)}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("unknown field")))
+		})
+
+		It("Should deny sidecars named after the ncs container or another container", func() {
+			obj.Spec.Sidecars = []corev1.Container{{Name: "ncs", Image: "fluent-bit:3.0"}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(`container name "ncs" is used more than once`)))
+
+			obj.Spec.InitContainers = []corev1.Container{{Name: "seed-cdb", Image: "busybox"}}
+			obj.Spec.Sidecars = []corev1.Container{{Name: "seed-cdb", Image: "fluent-bit:3.0"}}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(`container name "seed-cdb" is used more than once`)))
+
+			obj.Spec.Sidecars[0].Name = "log-shipper"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should only check the podTemplate when it changes", func() {
+			oldObj := obj.DeepCopy()
+			oldObj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"app":"other"}}}`)}
+			obj.Spec.PodTemplate = oldObj.Spec.PodTemplate
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.LabelSelector = map[string]string{"app": "nso-new"}
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(HaveOccurred())
+		})
+	})
+
+	Context("When enforcing the image policy", func() {
+		BeforeEach(func() {
+			policy, err := imagepolicy.Parse([]byte("allowedRegistries:\n- mirror.example.com/cisco\n"))
+			Expect(err).NotTo(HaveOccurred())
+			validator.ImagePolicy = policy
+			obj.Spec.Image = "mirror.example.com/cisco/cisco-nso-prod:6.3.1"
+			obj.Spec.LabelSelector = map[string]string{"app": "nso-prod"}
+		})
+
+		It("Should admit the images of the allowed registries", func() {
+			obj.Spec.Sidecars = []corev1.Container{{Name: "log-shipper", Image: "mirror.example.com/cisco/fluent-bit:3.0"}}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny the NSO image naming the policy it violates", func() {
+			obj.Spec.Image = "cisco-nso-prod:6.3.1"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(
+				"image cisco-nso-prod:6.3.1 violates the allowedRegistries image policy: it must come from one of mirror.example.com/cisco")))
+		})
+
+		It("Should deny init containers, sidecars and podTemplate containers from other registries", func() {
+			obj.Spec.InitContainers = []corev1.Container{{Name: "seed-cdb", Image: "busybox:1.36"}}
+			obj.Spec.Sidecars = []corev1.Container{{Name: "log-shipper", Image: "fluent-bit:3.0"}}
+			obj.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(
+				`{"spec":{"containers":[{"name":"exporter","image":"quay.io/prometheus/node-exporter"}]}}`)}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("image busybox:1.36 violates")))
+			Expect(err).To(MatchError(ContainSubstring("image fluent-bit:3.0 violates")))
+			Expect(err).To(MatchError(ContainSubstring("image quay.io/prometheus/node-exporter violates")))
+		})
+
+		It("Should only check the images when they change", func() {
+			oldObj := obj.DeepCopy()
+			oldObj.Spec.Image = "cisco-nso-prod:6.3.1"
+			obj.Spec.Image = oldObj.Spec.Image
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.Image = "cisco-nso-prod:6.4"
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().To(HaveOccurred())
+		})
+
+		It("Should deny an unsigned NSO image when signatures are required", func() {
+			server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+			DeferCleanup(server.Close)
+			host := strings.TrimPrefix(server.URL, "http://")
+			image, err := random.Image(1024, 1)
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := name.ParseReference(host + "/cisco-nso-prod:6.3.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(remote.Write(ref, image)).To(Succeed())
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+			policy, err := imagepolicy.Parse([]byte(fmt.Sprintf("requireSignature: true\npublicKeys:\n- %q\n",
+				pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))))
+			Expect(err).NotTo(HaveOccurred())
+			validator.ImagePolicy = policy
+
+			obj.Spec.Image = ref.String()
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("violates the requireSignature image policy: no signature found")))
+		})
+	})
+
+	Context("When deleting NSO under Validating Webhook", func() {
+		It("Should deny deletion if deletion protection is enabled", func() {
+			obj.Spec.DeletionProtection = true
+			_, err := validator.ValidateDelete(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("default/nso-prod has deletion protection enabled")))
+		})
+
+		It("Should admit deletion if deletion protection is disabled", func() {
+			Expect(validator.ValidateDelete(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should be rejected by the API server while protected", func() {
+			obj.Spec = orchestrationciscocomv1alpha1.NSOSpec{
+				Image:              "cisco-nso-prod:6.3.1",
+				ServiceName:        "nso-prod",
+				Replicas:           1,
+				LabelSelector:      map[string]string{"app": "nso-prod"},
+				Ports:              []corev1.ServicePort{{Name: "http", Port: 8080}},
+				NsoConfigRef:       "nso-config",
+				DeletionProtection: true,
+				AdminCredentials: orchestrationciscocomv1alpha1.Credentials{
+					Username:          "admin",
+					PasswordSecretRef: "nso-admin",
+				},
+			}
+			Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, obj)).NotTo(Succeed())
+
+			By("turning deletion protection off in a separate update")
+			obj.Spec.DeletionProtection = false
+			Expect(k8sClient.Update(ctx, obj)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+		})
+	})
+})